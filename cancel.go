@@ -0,0 +1,56 @@
+package frontman
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// interruptContext returns a context that is cancelled when frontman gets interrupted.
+// cancel must be called to release the context
+func (fm *Frontman) interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-fm.InterruptChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// closeOnDone closes c as soon as ctx is done, which aborts blocking reads and writes.
+// The returned func stops watching ctx and must be called once c isn't used anymore
+func closeOnDone(ctx context.Context, c io.Closer) (stop func()) {
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stopped:
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+// contextDeadline returns now+timeout or the deadline of ctx, whichever comes first
+func contextDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// contextError replaces err with the reason ctx was done, as errors of closed connections tell nothing about it
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("got unexpected timeout")
+	case context.Canceled:
+		return fmt.Errorf("check was cancelled")
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package frontman
+
+import (
+	"sync"
+)
+
+// instance manipulation (RFC 3229) of the check list: the hub replies with 226 IM Used and an InputDelta
+// relative to the version in If-None-Match if it supports it
+const inputDeltaIM = "checks-delta"
+
+// InputDelta lists the checks changed since a version of the check list
+type InputDelta struct {
+	Added   Input    `json:"added"`
+	Changed Input    `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// checkCatalog keeps the check list received from the hub indexed by UUID,
+// so conditional and delta updates only touch the changed checks
+type checkCatalog struct {
+	lock   sync.Mutex
+	etag   string // version of the check list, empty if unknown
+	checks map[string]Check
+	order  []string // UUIDs in the order of the hub
+}
+
+func newCheckCatalog() *checkCatalog {
+	return &checkCatalog{
+		checks: make(map[string]Check),
+	}
+}
+
+// version returns the ETag of the check list
+func (c *checkCatalog) version() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.etag
+}
+
+// invalidate forgets the version, so the hub sends the full check list
+func (c *checkCatalog) invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.etag = ""
+}
+
+// replace sets the full check list
+func (c *checkCatalog) replace(checks []Check, etag string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.etag = etag
+	c.checks = make(map[string]Check, len(checks))
+	c.order = make([]string, 0, len(checks))
+	c.put(checks)
+}
+
+// adds or replaces checks, the lock must be held
+func (c *checkCatalog) put(checks []Check) {
+	for _, check := range checks {
+		uuid := check.uniqueID()
+		if _, ok := c.checks[uuid]; !ok {
+			c.order = append(c.order, uuid)
+		}
+		c.checks[uuid] = check
+	}
+}
+
+// apply updates the check list with a delta and returns the number of checks added or changed
+func (c *checkCatalog) apply(delta *InputDelta, etag string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.etag = etag
+	added, changed := delta.Added.asChecks(), delta.Changed.asChecks()
+	c.put(added)
+	c.put(changed)
+
+	if len(delta.Removed) > 0 {
+		for _, uuid := range delta.Removed {
+			delete(c.checks, uuid)
+		}
+		order := c.order[:0]
+		for _, uuid := range c.order {
+			if _, ok := c.checks[uuid]; ok {
+				order = append(order, uuid)
+			}
+		}
+		c.order = order
+	}
+	return len(added) + len(changed)
+}
+
+// list returns the checks in the order of the hub
+func (c *checkCatalog) list() []Check {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	checks := make([]Check, 0, len(c.order))
+	for _, uuid := range c.order {
+		checks = append(checks, c.checks[uuid])
+	}
+	return checks
+}
@@ -0,0 +1,75 @@
+package frontman
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputFromHubConditional(t *testing.T) {
+	var requests []http.Header
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header)
+		switch r.Header.Get("If-None-Match") {
+		case "":
+			w.Header().Set("ETag", `"v1"`)
+			_ = json.NewEncoder(w).Encode(Input{ServiceChecks: []ServiceCheck{
+				{UUID: "a", Check: ServiceCheckData{Connect: "a.example.com", Protocol: "icmp", Service: "ping"}},
+				{UUID: "b", Check: ServiceCheckData{Connect: "b.example.com", Protocol: "icmp", Service: "ping"}},
+				{UUID: "c", Check: ServiceCheckData{Connect: "c.example.com", Protocol: "icmp", Service: "ping"}},
+			}})
+		case `"v1"`:
+			if len(requests) == 2 {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v2"`)
+			w.Header().Set("IM", inputDeltaIM)
+			w.WriteHeader(http.StatusIMUsed)
+			_ = json.NewEncoder(w).Encode(InputDelta{
+				Added:   Input{WebChecks: []WebCheck{{UUID: "d", Check: WebCheckData{URL: "http://d.example.com", Method: "get"}}}},
+				Changed: Input{ServiceChecks: []ServiceCheck{{UUID: "b", Check: ServiceCheckData{Connect: "b2.example.com", Protocol: "icmp", Service: "ping"}}}},
+				Removed: []string{"a"},
+			})
+		default:
+			// not a delta
+			w.Header().Set("ETag", `"v3"`)
+			_ = json.NewEncoder(w).Encode(Input{})
+		}
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	fm := helperCreateFrontman(t, cfg)
+
+	checks, err := fm.inputFromHub()
+	require.Nil(t, err)
+	require.Len(t, checks, 3)
+	assert.Equal(t, "", requests[0].Get("A-IM"))
+
+	checks, err = fm.inputFromHub()
+	require.Nil(t, err)
+	require.Len(t, checks, 3)
+	assert.Equal(t, inputDeltaIM, requests[1].Get("A-IM"))
+
+	checks, err = fm.inputFromHub()
+	require.Nil(t, err)
+	require.Len(t, checks, 3)
+	assert.Equal(t, "b", checks[0].uniqueID())
+	assert.Equal(t, "b2.example.com", checks[0].(ServiceCheck).Check.Connect)
+	assert.Equal(t, "c", checks[1].uniqueID())
+	assert.Equal(t, "d", checks[2].uniqueID())
+	assert.Equal(t, `"v2"`, fm.catalog.version())
+
+	checks, err = fm.inputFromHub()
+	require.Nil(t, err)
+	assert.Len(t, checks, 0)
+	assert.Equal(t, `"v3"`, fm.catalog.version())
+
+	assert.Equal(t, uint64(5), fm.stats.ChecksFetchedFromHub)
+}
@@ -0,0 +1,88 @@
+package frontman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checks not seen for this long are forgotten, so removed checks don't pile up
+const changeStateTTL = 24 * time.Hour
+
+// changeFilter suppresses results which don't change the state of their check.
+// The state is the message and the success measurements. Used by pollResultsChan only, so it isn't locked
+type changeFilter struct {
+	heartbeat time.Duration
+
+	checks    map[string]*reportedCheck
+	lastPrune time.Time
+}
+
+type reportedCheck struct {
+	state      string
+	reportedAt time.Time
+	seenAt     time.Time
+}
+
+func newChangeFilter(cfg *ChangeOnlyConfig) *changeFilter {
+	return &changeFilter{
+		heartbeat: secToDuration(cfg.HeartbeatInterval),
+		checks:    make(map[string]*reportedCheck),
+	}
+}
+
+// resultState returns the parts of a result that are reported as a change
+func resultState(res *Result) string {
+	var keys []string
+	for key := range res.Measurements {
+		if key == "success" || strings.HasSuffix(key, ".success") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v", res.Message)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n%s=%v", key, res.Measurements[key])
+	}
+	return b.String()
+}
+
+// report returns true if the result changed the state of its check or the heartbeat is due
+func (f *changeFilter) report(res *Result, now time.Time) bool {
+	if res.CheckUUID == "" {
+		// e.g. hostInfo
+		return true
+	}
+	f.prune(now)
+
+	key := res.CheckType + "/" + res.CheckUUID
+	state := resultState(res)
+	c, ok := f.checks[key]
+	if !ok {
+		f.checks[key] = &reportedCheck{state: state, reportedAt: now, seenAt: now}
+		return true
+	}
+
+	c.seenAt = now
+	if c.state != state || (f.heartbeat > 0 && now.Sub(c.reportedAt) >= f.heartbeat) {
+		c.state = state
+		c.reportedAt = now
+		return true
+	}
+	return false
+}
+
+func (f *changeFilter) prune(now time.Time) {
+	if now.Sub(f.lastPrune) < time.Hour {
+		return
+	}
+	f.lastPrune = now
+	for key, c := range f.checks {
+		if now.Sub(c.seenAt) > changeStateTTL {
+			delete(f.checks, key)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package frontman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeFilter(t *testing.T) {
+	f := newChangeFilter(&ChangeOnlyConfig{HeartbeatInterval: 60})
+	now := time.Unix(1600000000, 0)
+
+	result := func(success int, message interface{}, connectTime float64) *Result {
+		return &Result{
+			CheckUUID: "tcp",
+			CheckType: "serviceCheck",
+			Message:   message,
+			Measurements: map[string]interface{}{
+				"net.tcp.ssh.22.success":       success,
+				"net.tcp.ssh.22.connectTime_s": connectTime,
+			},
+		}
+	}
+
+	assert.True(t, f.report(result(1, nil, 0.1), now), "first result")
+	assert.False(t, f.report(result(1, nil, 0.2), now.Add(10*time.Second)), "only a value changed")
+	assert.True(t, f.report(result(0, "connection refused", 0), now.Add(20*time.Second)), "success flipped")
+	assert.False(t, f.report(result(0, "connection refused", 0), now.Add(30*time.Second)))
+	assert.True(t, f.report(result(0, "timeout", 0), now.Add(40*time.Second)), "message changed")
+	assert.False(t, f.report(result(0, "timeout", 0), now.Add(90*time.Second)))
+	assert.True(t, f.report(result(0, "timeout", 0), now.Add(100*time.Second)), "heartbeat")
+
+	// other checks and results without check are independent
+	other := result(1, nil, 0.1)
+	other.CheckUUID = "other"
+	assert.True(t, f.report(other, now.Add(100*time.Second)))
+	assert.True(t, f.report(&Result{CheckType: "hostInfo"}, now))
+	assert.True(t, f.report(&Result{CheckType: "hostInfo"}, now))
+
+	// unseen checks are forgotten
+	f.report(other, now.Add(changeStateTTL+2*time.Hour))
+	assert.Len(t, f.checks, 1)
+}
+
+func TestPollResultsChanChangeOnly(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.ChangeOnly.Enabled = true
+	fm := helperCreateFrontman(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		fm.resultsChan <- helperSinkResults()[0]
+	}
+	close(fm.resultsChan)
+	fm.pollResultsChan()
+
+	assert.Len(t, fm.results, 1)
+	assert.Equal(t, uint64(2), fm.stats.CheckResultsSuppressed)
+}
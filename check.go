@@ -1,6 +1,7 @@
 package frontman
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 
@@ -8,11 +9,15 @@ import (
 )
 
 type Check interface {
-	// run always returns a *Result, even in case of failure
-	run(fm *Frontman) (*Result, error)
+	// run always returns a *Result, even in case of failure.
+	// Cancelling ctx aborts the check
+	run(ctx context.Context, fm *Frontman) (*Result, error)
 
 	// uniqueUD returns the check UUID
 	uniqueID() string
+
+	// schedule returns when the check runs in continuous mode
+	schedule() CheckSchedule
 }
 
 type Input struct {
@@ -24,6 +29,8 @@ type Input struct {
 type ServiceCheck struct {
 	UUID  string           `json:"checkUuid"`
 	Check ServiceCheckData `json:"check"`
+
+	CheckSchedule
 }
 
 type ServiceCheckData struct {
@@ -31,11 +38,25 @@ type ServiceCheckData struct {
 	Service  string      `json:"service,omitempty"`
 	Protocol string      `json:"protocol,omitempty"`
 	Port     json.Number `json:"port,omitempty"`
+
+	// values used by the generic "udp" service
+	Payload                string `json:"payload,omitempty"`
+	PayloadFormat          string `json:"payloadFormat,omitempty"`          // text (default), hex
+	ExpectedResponse       string `json:"expectedResponse,omitempty"`       // regular expression or hex encoded prefix
+	ExpectedResponseFormat string `json:"expectedResponseFormat,omitempty"` // regex (default), hex
+
+	// values used by the "radius" service
+	RadiusSecret        string `json:"radiusSecret,omitempty"`
+	RadiusUsername      string `json:"radiusUsername,omitempty"`
+	RadiusPassword      string `json:"radiusPassword,omitempty"`
+	RadiusExpectedReply string `json:"radiusExpectedReply,omitempty"` // accept (default), reject
 }
 
 type WebCheck struct {
 	UUID  string       `json:"checkUuid"`
 	Check WebCheckData `json:"check"`
+
+	CheckSchedule
 }
 
 type WebCheckData struct {
@@ -55,6 +76,11 @@ type WebCheckData struct {
 type SNMPCheck struct {
 	UUID  string        `json:"checkUuid"`
 	Check SNMPCheckData `json:"check"`
+
+	CheckSchedule
+
+	// set for checks requested by other frontmen through the HTTP listener
+	stateless bool
 }
 
 type SNMPCheckData struct {
@@ -71,12 +97,26 @@ type SNMPCheckData struct {
 	AuthenticationPassword string   `json:"authentication_password,omitempty"` // v3
 	PrivacyProtocol        string   `json:"privacy_protocol,omitempty"`        // v3
 	PrivacyPassword        string   `json:"privacy_password,omitempty"`        // v3
+	ContextName            string   `json:"context_name,omitempty"`            // v3
+	ContextEngineID        string   `json:"context_engine_id,omitempty"`       // v3, hex encoded
+
+	// request settings, zero values keep the defaults
+	Retries        int `json:"retries,omitempty"`         // retries of a request after the timeout
+	MaxRepetitions int `json:"max_repetitions,omitempty"` // GETBULK max-repetitions, 1-255. Lower it for agents failing on large responses
+	NonRepeaters   int `json:"non_repeaters,omitempty"`   // GETBULK non-repeaters
 
 	// values used by "oid" preset
 	Oid       string `json:"oid,omitempty"`
 	Name      string `json:"name,omitempty"`
 	ValueType string `json:"value_type,omitempty"` /// auto (default), hex, delta, delta_per_sec
 	Unit      string `json:"unit,omitempty"`
+
+	// values used by "bandwidth" and "porterrors" presets
+	InterfaceFilter *SNMPInterfaceFilter `json:"interface_filter,omitempty"`
+
+	// values used by "table" preset
+	Columns     []SNMPTableColumn `json:"columns,omitempty"`
+	LabelColumn string            `json:"label_column,omitempty"` // name of the column used to label the rows
 }
 
 // used to keep track of in-progress checks being run
@@ -0,0 +1,106 @@
+package frontman
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// inputFileState identifies a version of the input file
+type inputFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func (s inputFileState) equal(other inputFileState) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+func statInputFile(path string) (inputFileState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return inputFileState{}, err
+	}
+	return inputFileState{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
+
+// watchInputFile watches the input file and signals a change on the returned channel.
+// A change is signaled once the file didn't change for delay, so a file being written is not read half-way
+func (fm *Frontman) watchInputFile(path string, delay time.Duration) <-chan struct{} {
+	if delay <= 0 {
+		delay = time.Second
+	}
+	changed := make(chan struct{}, 1)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logrus.Errorf("watchInputFile: changes of %s are not noticed: %s", path, err)
+		return changed
+	}
+	// watch the directory, as the file is often replaced instead of written
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		logrus.Errorf("watchInputFile: changes of %s are not noticed: %s", path, err)
+		return changed
+	}
+	name := filepath.Clean(path)
+
+	go func() {
+		defer watcher.Close()
+
+		last, _ := statInputFile(path)
+		var settled <-chan time.Time
+		for {
+			select {
+			case <-fm.InterruptChan:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name {
+					settled = time.After(delay)
+				}
+				continue
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("watchInputFile: %s", err)
+				continue
+			case <-settled:
+				settled = nil
+			}
+
+			state, err := statInputFile(path)
+			if err != nil {
+				// keep the checks of the last version until the file is back
+				logrus.Debugf("watchInputFile: %s", err)
+				continue
+			}
+			if !state.equal(last) {
+				last = state
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed
+}
+
+// appends every result as JSON line to the output file, used in continuous file mode instead of sending to the hub
+func (fm *Frontman) sendResultsChanToFileContinuous(output *fileSink) {
+	for res := range fm.resultsChan {
+		fm.writeToSinks(res)
+		if err := output.write([]Result{res}); err != nil {
+			logrus.Errorf("Failed to write result to the output file: %s", err)
+		}
+	}
+
+	logrus.Debugf("sendResultsChanToFileContinuous resultsChan closed, returning")
+}
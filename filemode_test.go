@@ -0,0 +1,93 @@
+package frontman
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchInputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.json")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`{"serviceChecks":[]}`), 0644))
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	fm := helperCreateFrontman(t, cfg)
+	defer close(fm.InterruptChan)
+
+	changed := fm.watchInputFile(path, 20*time.Millisecond)
+
+	select {
+	case <-changed:
+		t.Fatal("unchanged file reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	later := time.Now().Add(time.Minute)
+	require.Nil(t, ioutil.WriteFile(path, []byte(`{"serviceChecks":[{"checkUuid":"a"}]}`), 0644))
+	require.Nil(t, os.Chtimes(path, later, later))
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change not reported")
+	}
+
+	// a missing file keeps the last version
+	require.Nil(t, os.Remove(path))
+	select {
+	case <-changed:
+		t.Fatal("removed file reported")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the file is replaced by a new one
+	tmp := filepath.Join(filepath.Dir(path), "input.json.tmp")
+	require.Nil(t, ioutil.WriteFile(tmp, []byte(`{"serviceChecks":[{"checkUuid":"b"}]}`), 0644))
+	require.Nil(t, os.Rename(tmp, path))
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("replaced file not reported")
+	}
+}
+
+func TestSendResultsChanToFileContinuous(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.out")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	require.Nil(t, err)
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	fm := helperCreateFrontman(t, cfg)
+	line, err := json.Marshal(helperSinkResults()[0])
+	require.Nil(t, err)
+	// 3 results fit into a file
+	output := newFileSinkFromFile(f, int64(3*(len(line)+1)), 1)
+
+	for i := 0; i < 5; i++ {
+		fm.resultsChan <- helperSinkResults()[0]
+	}
+	close(fm.resultsChan)
+	fm.sendResultsChanToFileContinuous(output)
+	require.Nil(t, output.close())
+
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	var res Result
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &res))
+	assert.Equal(t, "tcp check", res.CheckUUID)
+
+	assert.Len(t, lines, 2)
+
+	// the first results were rotated to results.out.1
+	rotated, err := ioutil.ReadFile(path + ".1")
+	require.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(rotated), "\n"))
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/cloudradar-monitoring/frontman/pkg/mib"
 	"github.com/cloudradar-monitoring/frontman/pkg/stats"
 )
 
@@ -38,6 +39,9 @@ type Frontman struct {
 	selfUpdater *selfupdate.Updater
 
 	hubClient    *http.Client
+	hubAuth      *hubAuth
+	hubBackoff   *hubBackoff
+	hubFormat    *hubFormat
 	hostInfoSent bool
 
 	// local cached results in case the hub is temporarily offline
@@ -62,6 +66,18 @@ type Frontman struct {
 	// in-progress checks
 	ipc inProgressChecks
 
+	// checks of the hub by UUID with the version for conditional and delta updates
+	catalog *checkCatalog
+
+	// limits the checks to run if Config.CheckPolicy has rules
+	policy *checkPolicy
+
+	// dispatches the checks to the queue when due in continuous mode
+	scheduler *checkScheduler
+
+	// limits the checks running at the same time
+	pool *checkPool
+
 	// completed check results to be sent to hub
 	results []Result
 
@@ -70,9 +86,27 @@ type Frontman struct {
 
 	resultsLock sync.RWMutex
 
-	previousSNMPBandwidthMeasure  []snmpBandwidthMeasure
-	previousSNMPOidDeltaMeasure   []snmpOidDeltaMeasure
-	previousSNMPPorterrorsMeasure []snmpPorterrorsMeasure
+	// further outputs of the results and their background writers in continuous mode
+	sinks           []resultSink
+	sinkWorkers     []*sinkWorker
+	sinkWorkersLock sync.RWMutex
+
+	// drops results without state changes if Config.ChangeOnly is enabled
+	changeFilter *changeFilter
+
+	// persistent connection to the hub if Config.HubStream.URL is set
+	stream *hubStream
+
+	// keeps results on disk until sent if Config.ResultSpool.Dir is set, replaces results
+	spool *resultSpool
+	// results waiting to be written to the spool
+	spoolQueue chan Result
+
+	// previous samples of snmp counters, persisted to Config.SNMPStateFile
+	snmpCounters *snmpCounterStore
+
+	// MIB objects loaded from Config.SNMPMIBDir
+	mibs *mib.Store
 
 	TerminateQueue sync.WaitGroup
 
@@ -128,9 +162,50 @@ func New(cfg *Config, cfgPath, version string) (*Frontman, error) {
 
 	fm.configureLogger()
 
+	fm.catalog = newCheckCatalog()
+	fm.scheduler = newCheckScheduler(secToDuration(fm.Config.Sleep))
+	fm.pool = newCheckPool(&fm.Config.WorkerPool)
+
 	fm.initHubClient()
+	fm.hubAuth = newHubAuth(fm.Config, fm.hubClient)
+	fm.hubBackoff = newHubBackoff(&fm.Config.HubRetry)
+	fm.hubFormat = newHubFormat(fm.Config)
+
+	fm.loadSNMPMIBs()
+
+	fm.snmpCounters = newSNMPCounterStore(fm.Config.SNMPStateFile)
+	if err := fm.snmpCounters.load(); err != nil {
+		logrus.Errorf("Could not read snmp state file: %s", err)
+	}
+
+	fm.sinks = fm.newSinks()
+
+	if fm.Config.ChangeOnly.Enabled {
+		fm.changeFilter = newChangeFilter(&fm.Config.ChangeOnly)
+	}
+
+	if fm.Config.HubStream.URL != "" {
+		fm.stream = newHubStream(fm, &fm.Config.HubStream)
+	}
+
+	if fm.Config.ResultSpool.Dir != "" {
+		spool, err := openResultSpool(fm.Config.ResultSpool.Dir, fm.Config.ResultSpool.MaxBytes, secToDuration(fm.Config.ResultSpool.MaxAge))
+		if err != nil {
+			logrus.Errorf("Could not open result spool, keeping results in memory: %s", err)
+		} else {
+			fm.spool = spool
+			fm.spoolQueue = make(chan Result, spoolQueueSize)
+		}
+	}
+
+	policy, err := newCheckPolicy(&fm.Config.CheckPolicy)
+	if err != nil {
+		logrus.Error(err.Error())
+		return nil, err
+	}
+	fm.policy = policy
 
-	err := fm.configureAutomaticSelfUpdates()
+	err = fm.configureAutomaticSelfUpdates()
 	if err != nil {
 		logrus.Error(err.Error())
 		return nil, err
@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,7 +20,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-type ErrorHubTooManyRequests struct{}
+type ErrorHubTooManyRequests struct {
+	retryAfter time.Duration
+}
 
 func (e ErrorHubTooManyRequests) Error() string {
 	return "Hub replied with a 429 error code"
@@ -31,8 +35,18 @@ func (e ErrorMissingHubOrInput) Error() string {
 }
 
 type ErrorHubGeneral struct {
-	err  int
-	text string
+	err        int
+	text       string
+	retryAfter time.Duration
+}
+
+// ErrorHubUnavailable is returned instead of requesting the hub while requests are delayed after failures
+type ErrorHubUnavailable struct {
+	wait time.Duration
+}
+
+func (e ErrorHubUnavailable) Error() string {
+	return fmt.Sprintf("Hub requests are paused after failures, retrying in %.0fs", e.wait.Seconds())
 }
 
 type ErrorHubResetContent struct{}
@@ -45,7 +59,7 @@ func (e ErrorHubGeneral) Error() string {
 	return fmt.Sprintf("Hub replied with error %s", e.text)
 }
 
-// serviceCheckEmergencyTimeout used to protect from unhandled timeouts
+// serviceCheckEmergencyTimeout is the deadline of service and SNMP checks, it aborts probes not finished by their own timeouts
 const serviceCheckEmergencyTimeout = time.Second * 30
 
 func InputFromFile(filename string) (*Input, error) {
@@ -66,11 +80,14 @@ func (fm *Frontman) initHubClient() {
 	transport := &http.Transport{
 		ResponseHeaderTimeout: 15 * time.Second,
 	}
-	if fm.rootCAs != nil {
+	if fm.rootCAs != nil || fm.Config.HubClientCert != "" {
 		transport.TLSClientConfig = &tls.Config{
 			RootCAs: fm.rootCAs,
 		}
 	}
+	if fm.Config.HubClientCert != "" {
+		transport.TLSClientConfig.GetClientCertificate = fm.hubClientCertificate
+	}
 	if fm.Config.HubProxy != "" {
 		proxyURL, err := url.Parse(fm.Config.HubProxy)
 		if err != nil {
@@ -110,14 +127,24 @@ func (fm *Frontman) CheckHubCredentials(ctx context.Context, fieldHubURL, fieldH
 		err := errors.Errorf("wrong scheme '%s', URL must start with http:// or https://", u.Scheme)
 		return newFieldError(fieldHubURL, err)
 	}
+	if fm.Config.HubClientCert != "" {
+		if _, err := fm.hubClientCertificate(nil); err != nil {
+			return newFieldError("hub_client_cert", err)
+		}
+	}
+
 	req, _ := http.NewRequest("HEAD", fm.Config.HubURL, nil)
 	req.Header.Add("User-Agent", fm.userAgent())
-	if fm.Config.HubUser != "" {
-		req.SetBasicAuth(fm.Config.HubUser, fm.Config.HubPassword)
-	}
 
 	ctx, cancelFn := context.WithTimeout(ctx, time.Minute)
 	req = req.WithContext(ctx)
+	if err := fm.hubAuth.authorize(req); err != nil {
+		cancelFn()
+		if fm.hubAuth.method() == hubAuthOAuth2 {
+			return newFieldError("hub_oauth2_token_url", err)
+		}
+		return newFieldError("hub_token_file", err)
+	}
 	resp, err := fm.hubClient.Do(req)
 	cancelFn()
 	if err = fm.checkClientError(resp, err, fieldHubUser, fieldHubPassword); err != nil {
@@ -144,6 +171,12 @@ func (fm *Frontman) checkClientError(resp *http.Response, err error, fieldHubUse
 
 	_ = resp.Body.Close()
 	if resp.StatusCode == http.StatusUnauthorized {
+		switch fm.hubAuth.method() {
+		case hubAuthOAuth2:
+			return errors.Errorf("unable to authorize with the OAuth2 token of hub_oauth2_client_id (HTTP %d). %s", resp.StatusCode, responseBody)
+		case hubAuthBearer:
+			return errors.Errorf("unable to authorize with the provided hub token (HTTP %d). %s", resp.StatusCode, responseBody)
+		}
 		if fm.Config.HubUser == "" {
 			return newEmptyFieldError(fieldHubUser)
 		} else if fm.Config.HubPassword == "" {
@@ -156,7 +189,9 @@ func (fm *Frontman) checkClientError(resp *http.Response, err error, fieldHubUse
 	return nil
 }
 
-func (fm *Frontman) inputFromHub() (*Input, error) {
+// inputFromHub returns the checks of the hub. The hub may reply with 304 Not Modified
+// or the changes since the version of the catalog
+func (fm *Frontman) inputFromHub() ([]Check, error) {
 	if fm.Config.HubURL == "" {
 		return nil, newEmptyFieldError("hub_url")
 	} else if u, err := url.Parse(fm.Config.HubURL); err != nil {
@@ -167,7 +202,6 @@ func (fm *Frontman) inputFromHub() (*Input, error) {
 		return nil, newFieldError("hub_url", err)
 	}
 
-	i := Input{}
 	r, err := http.NewRequest("GET", fm.Config.HubURL, nil)
 	if err != nil {
 		return nil, err
@@ -175,12 +209,23 @@ func (fm *Frontman) inputFromHub() (*Input, error) {
 
 	r.Header.Add("User-Agent", fm.userAgent())
 
-	if fm.Config.HubUser != "" {
-		r.SetBasicAuth(fm.Config.HubUser, fm.Config.HubPassword)
+	if etag := fm.catalog.version(); etag != "" {
+		r.Header.Set("If-None-Match", etag)
+		r.Header.Set("A-IM", inputDeltaIM)
+	}
+
+	// authorize first, a failure must not leave the probe of an open circuit pending
+	if err := fm.hubAuth.authorize(r); err != nil {
+		return nil, err
+	}
+
+	if err := fm.hubBackoff.allow(time.Now()); err != nil {
+		return nil, err
 	}
 
 	resp, err := fm.hubClient.Do(r)
 	if err != nil {
+		fm.hubBackoff.failure(time.Now(), 0)
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 			err = fmt.Errorf("hub request timeout of %d seconds exceeded", fm.Config.HubRequestTimeout)
 			err = errors.Wrap(err, netErr.Error())
@@ -195,35 +240,68 @@ func (fm *Frontman) inputFromHub() (*Input, error) {
 	}
 
 	defer resp.Body.Close()
+	fm.hubFormat.announce(resp.Header)
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		fm.hubAuth.invalidate()
+	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
 		logrus.Debugf("inputFromHub failed: hub replied with error %s", resp.Status)
+		delay := retryAfter(resp, time.Now())
+		fm.hubBackoff.failure(time.Now(), delay)
 		if resp.StatusCode == http.StatusTooManyRequests {
-			return nil, ErrorHubTooManyRequests{}
+			return nil, ErrorHubTooManyRequests{delay}
 		}
 		if resp.StatusCode >= 400 {
-			return nil, ErrorHubGeneral{resp.StatusCode, resp.Status}
+			return nil, ErrorHubGeneral{resp.StatusCode, resp.Status, delay}
 		}
 		return nil, errors.New(resp.Status)
 	}
+	fm.hubBackoff.success()
+
+	if resp.StatusCode == http.StatusNotModified {
+		logrus.Debugf("inputFromHub: checks not modified since %s", fm.catalog.version())
+		return fm.catalog.list(), nil
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(body, &i)
-	if err != nil {
+	if err := fm.verifyHubSignature(body, resp.Header.Get(hubSignatureHeader)); err != nil {
 		return nil, err
 	}
 
+	etag := resp.Header.Get("ETag")
+	var fetched int
+	if resp.StatusCode == http.StatusIMUsed && strings.EqualFold(resp.Header.Get("IM"), inputDeltaIM) {
+		delta := InputDelta{}
+		if err := json.Unmarshal(body, &delta); err != nil {
+			// request the full list next time
+			fm.catalog.invalidate()
+			return nil, err
+		}
+		fetched = fm.catalog.apply(&delta, etag)
+		logrus.Debugf("inputFromHub: %d checks added or changed, %d removed", fetched, len(delta.Removed))
+	} else {
+		i := Input{}
+		if err := json.Unmarshal(body, &i); err != nil {
+			return nil, err
+		}
+		checks := i.asChecks()
+		fetched = len(checks)
+		fm.catalog.replace(checks, etag)
+	}
+
 	// Update frontman statistics
 	fm.statsLock.Lock()
 	fm.stats.BytesFetchedFromHubTotal += uint64(len(body))
-	fm.stats.ChecksFetchedFromHub += uint64(len(i.ServiceChecks)) + uint64(len(i.WebChecks)) + uint64(len(i.SNMPChecks))
+	fm.stats.ChecksFetchedFromHub += uint64(fetched)
 	fm.statsLock.Unlock()
 
-	return &i, nil
+	return fm.catalog.list(), nil
 }
 
 // Run runs all checks continuously and sends result to hub or file
@@ -262,11 +340,32 @@ func (fm *Frontman) Run(inputFilePath string, outputFile *os.File) {
 		logrus.Info("Running in node mode, no checks from hub will be processed")
 	} else {
 		go fm.updateInputChecksContinuous(inputFilePath)
+		go fm.scheduleChecksContinuous()
 		go fm.processInputContinuous(true)
-		go fm.sendResultsChanToHubQueue()
-		go fm.pollResultsChan()
+		fm.startSinkWorkers()
+		if outputFile != nil {
+			logrus.Infof("Running in file mode, results are written to %s", outputFile.Name())
+			output := newFileSinkFromFile(outputFile, fm.Config.FileMode.OutputMaxBytes, fm.Config.FileMode.OutputMaxFiles)
+			go fm.sendResultsChanToFileContinuous(output)
+		} else {
+			if fm.spool != nil {
+				fm.startResultSpoolWriter()
+				go fm.sendSpooledResultsContinuous()
+			} else {
+				go fm.sendResultsChanToHubQueue()
+			}
+			go fm.pollResultsChan()
+			if fm.stream != nil {
+				go fm.stream.runContinuous()
+			}
+		}
+
+		if fm.Config.SNMPTrap.Listen != "" {
+			go fm.runSNMPTrapReceiver(fm.resultsChan)
+		}
 	}
 	go fm.writeQueueStatsContinuous()
+	fm.startSNMPCounterStateWriter()
 
 	for {
 		select {
@@ -286,6 +385,19 @@ func (fm *Frontman) updateInputChecks(inputFilePath string) {
 	fm.addUniqueChecks(checks)
 }
 
+// updates the checks of the scheduler from input file or the hub
+func (fm *Frontman) updateScheduledChecks(inputFilePath string) error {
+	checks, err := fm.fetchInputChecks(inputFilePath)
+	fm.handleHubError(err)
+	if err != nil {
+		// keep running the known checks
+		return err
+	}
+
+	fm.scheduler.update(checks, time.Now())
+	return nil
+}
+
 // RunOnce runs all checks once and send result to hub or file
 func (fm *Frontman) RunOnce(inputFilePath string, outputFile *os.File) error {
 
@@ -295,6 +407,8 @@ func (fm *Frontman) RunOnce(inputFilePath string, outputFile *os.File) error {
 	fm.processInput(fm.checks, true)
 	fm.checksLock.Unlock()
 
+	fm.writeSNMPCounterState()
+
 	logrus.Debugf("RunOnce")
 
 	// close it so we can iterate it in sendResultsChanToFile and sendResultsChanToHub
@@ -320,15 +434,12 @@ func (fm *Frontman) handleHubError(err error) {
 		time.Sleep(10 * time.Second)
 		os.Exit(0)
 	case ErrorHubGeneral:
+		// the next request is delayed by hubBackoff
 		logrus.Warnln("ErrorHubGeneral", err)
-		// sleep until the next data submission is due
-		delay := secToDuration(fm.Config.Sleep)
-		logrus.Debugf("handleHubError sleeping for %v", delay)
-		time.Sleep(delay)
 	case ErrorHubTooManyRequests:
 		logrus.Warnln(err)
-		// for error code 429, wait 10 seconds and try again
-		time.Sleep(10 * time.Second)
+	case ErrorHubUnavailable:
+		logrus.Debugln(err)
 	case nil:
 		return
 	default:
@@ -352,15 +463,14 @@ func (input *Input) asChecks() []Check {
 
 // fetchInputChecks reads checks from a json file or the hub
 func (fm *Frontman) fetchInputChecks(inputFilePath string) ([]Check, error) {
-	var input *Input
-	var err error
-
 	if inputFilePath != "" {
-		input, err = InputFromFile(inputFilePath)
+		input, err := InputFromFile(inputFilePath)
 		if err != nil {
 			return nil, fmt.Errorf("InputFromFile(%s) error: %s", inputFilePath, err.Error())
 		}
-		return input.asChecks(), nil
+		checks := input.asChecks()
+		logrus.Debugf("fetchInputChecks read %v checks from %s", len(checks), inputFilePath)
+		return checks, nil
 	}
 
 	if fm.Config.HubURL == "" {
@@ -368,10 +478,10 @@ func (fm *Frontman) fetchInputChecks(inputFilePath string) ([]Check, error) {
 	}
 
 	// in case input file not specified this means we should request HUB instead
-	input, err = fm.inputFromHub()
+	checks, err := fm.inputFromHub()
 	if err != nil {
 		switch err.(type) {
-		case ErrorHubGeneral, ErrorHubTooManyRequests:
+		case ErrorHubGeneral, ErrorHubTooManyRequests, ErrorHubUnavailable:
 			return nil, err
 		}
 		if fm.Config.HubUser != "" {
@@ -382,7 +492,6 @@ func (fm *Frontman) fetchInputChecks(inputFilePath string) ([]Check, error) {
 		return nil, fmt.Errorf("inputFromHub: %s", err.Error())
 	}
 
-	checks := input.asChecks()
 	diag := fmt.Sprintf("fetchInputChecks read %v checks from hub", len(checks))
 	if len(checks) > 0 {
 		logrus.Info(diag)
@@ -401,14 +510,17 @@ func (fm *Frontman) addUniqueChecks(new []Check) {
 	fm.resultsLock.RLock()
 	defer fm.resultsLock.RUnlock()
 
+	queued := fm.checkIDsInQueue()
+	inResults := fm.checkIDsInResultsQueue()
+
 	oldLen := len(fm.checks)
 	for _, c := range new {
 		uuid := c.uniqueID()
-		if fm.hasCheckInQueue(uuid) {
+		if _, ok := queued[uuid]; ok {
 			logrus.Infof("Skipping request for check %v. Check is in queue.", uuid)
 			continue
 		}
-		if fm.hasCheckInResultsQueue(uuid) {
+		if _, ok := inResults[uuid]; ok {
 			logrus.Infof("Skipping request for check %v. Check is in results queue.", uuid)
 			continue
 		}
@@ -417,28 +529,27 @@ func (fm *Frontman) addUniqueChecks(new []Check) {
 			continue
 		}
 		fm.checks = append(fm.checks, c)
+		queued[uuid] = struct{}{}
 	}
 	logrus.Debugf("addUniqueChecks: queue size %v, new %v, new queue size %v", oldLen, len(new), len(fm.checks))
 }
 
-// returns true if uuid is currently in the check queue
-func (fm *Frontman) hasCheckInQueue(uuid string) bool {
+// returns the UUIDs currently in the check queue
+func (fm *Frontman) checkIDsInQueue() map[string]struct{} {
+	ids := make(map[string]struct{}, len(fm.checks))
 	for _, v := range fm.checks {
-		if v.uniqueID() == uuid {
-			return true
-		}
+		ids[v.uniqueID()] = struct{}{}
 	}
-	return false
+	return ids
 }
 
-// returns true if uuid is currently in the results queue
-func (fm *Frontman) hasCheckInResultsQueue(uuid string) bool {
+// returns the UUIDs currently in the results queue
+func (fm *Frontman) checkIDsInResultsQueue() map[string]struct{} {
+	ids := make(map[string]struct{}, len(fm.results))
 	for _, v := range fm.results {
-		if v.CheckUUID == uuid {
-			return true
-		}
+		ids[v.CheckUUID] = struct{}{}
 	}
-	return false
+	return ids
 }
 
 // takes the oldest check from queue that is not in progress
@@ -458,6 +569,12 @@ func (fm *Frontman) updateInputChecksContinuous(inputFilePath string) {
 	sleepTime := secToDuration(fm.Config.Sleep)
 	interval := time.Duration(0)
 
+	// reload the input file as soon as it changes
+	var inputChanged <-chan struct{}
+	if inputFilePath != "" {
+		inputChanged = fm.watchInputFile(inputFilePath, secToDuration(fm.Config.FileMode.InputReloadDelay))
+	}
+
 	for {
 		select {
 		case <-fm.InterruptChan:
@@ -465,10 +582,15 @@ func (fm *Frontman) updateInputChecksContinuous(inputFilePath string) {
 			fm.TerminateQueue.Wait()
 			return
 
+		case <-inputChanged:
+			logrus.Infof("updateInputChecksContinuous input file %s changed, reloading", inputFilePath)
+			_ = fm.updateScheduledChecks(inputFilePath)
+
 		case <-time.After(interval):
 			interval = sleepTime
 			if err := fm.HealthCheck(); err != nil {
 				fm.HealthCheckPassedPreviously = false
+				fm.scheduler.setPaused(true)
 				logrus.WithError(err).Errorln("⚠️ Health checks are not passed. Skipping other checks. ⚠️")
 				select {
 				case <-fm.InterruptChan:
@@ -478,17 +600,30 @@ func (fm *Frontman) updateInputChecksContinuous(inputFilePath string) {
 				}
 			} else if !fm.HealthCheckPassedPreviously {
 				fm.HealthCheckPassedPreviously = true
+				fm.scheduler.setPaused(false)
 				logrus.Infoln("All health checks are positive. Resuming normal operation.")
 			}
 
-			logrus.Infof("updateInputChecksContinuous running updateInputChecks")
-			fm.updateInputChecks(inputFilePath)
+			if inputFilePath == "" && fm.stream.connected() {
+				logrus.Debugf("updateInputChecksContinuous the hub pushes the checks over the stream, not polling")
+				continue
+			}
+
+			logrus.Infof("updateInputChecksContinuous running updateScheduledChecks")
+			if err := fm.updateScheduledChecks(inputFilePath); err != nil {
+				// retry as soon as the hub backoff allows it
+				if wait := fm.hubBackoff.wait(time.Now()); wait > 0 && wait < sleepTime {
+					interval = wait
+				}
+			}
 		}
 	}
 }
 
 // local is false if check originated from a remote node
 func (fm *Frontman) processInputContinuous(local bool) {
+	ctx, cancel := fm.interruptContext()
+	defer cancel()
 
 	sleepDurationAfterEachCheck := secToDuration(fm.Config.SleepDurationAfterCheck)
 	sleepDurationForEmptyQueue := secToDuration(fm.Config.SleepDurationEmptyQueue)
@@ -499,11 +634,19 @@ func (fm *Frontman) processInputContinuous(local bool) {
 			sleepDuration = sleepDurationAfterEachCheck
 			fm.ipc.add(currentCheck.uniqueID())
 
+			// wait for the worker pool here instead of starting goroutines for all due checks
+			slot, err := fm.acquireSlot(ctx, currentCheck)
+			if err != nil {
+				fm.ipc.remove(currentCheck.uniqueID())
+				logrus.Infof("processInputContinuous got interrupt, stopping")
+				return
+			}
+
 			fm.TerminateQueue.Add(1)
 			go func(check Check) {
 				defer fm.TerminateQueue.Done()
 
-				res, _ := fm.runCheck(check, local)
+				res, _ := fm.runCheck(ctx, check, local, slot)
 				fm.resultsChan <- *res
 
 				fm.ipc.remove(check.uniqueID())
@@ -544,14 +687,20 @@ func (fm *Frontman) processInput(checks []Check, local bool) {
 
 // runs all checks in checkList and sends results to resultsChan
 func (fm *Frontman) runChecks(checkList []Check, local bool) int {
+	ctx, cancel := fm.interruptContext()
+	defer cancel()
 
+	// wait for these checks only, TerminateQueue also tracks the goroutines running until frontman is interrupted
+	var wg sync.WaitGroup
 	succeed := int32(0)
 	for _, check := range checkList {
+		wg.Add(1)
 		fm.TerminateQueue.Add(1)
 		go func(check Check) {
 			defer fm.TerminateQueue.Done()
+			defer wg.Done()
 
-			res, err := fm.runCheck(check, local)
+			res, err := fm.runCheck(ctx, check, local, nil)
 			if err == nil {
 				atomic.AddInt32(&succeed, 1)
 			}
@@ -560,13 +709,32 @@ func (fm *Frontman) runChecks(checkList []Check, local bool) int {
 		}(check)
 	}
 
-	fm.TerminateQueue.Wait()
+	wg.Wait()
 
 	return int(succeed)
 }
 
-func (fm *Frontman) runCheck(check Check, local bool) (*Result, error) {
-	res, err := check.run(fm)
+// runCheck runs the check in the slot of the worker pool already acquired for it, or in a new one if slot is nil
+func (fm *Frontman) runCheck(ctx context.Context, check Check, local bool, slot *poolSlot) (*Result, error) {
+	if err := fm.policy.allow(ctx, check); err != nil {
+		if slot != nil {
+			fm.releaseSlot(slot)
+		}
+		logrus.Warnf("runChecks: %s: %s", check.uniqueID(), err.Error())
+		fm.statsLock.Lock()
+		fm.stats.ChecksDenied++
+		fm.statsLock.Unlock()
+		checkType, _ := checkTypeAndHost(check)
+		return &Result{
+			Node:      fm.Config.NodeName,
+			CheckType: checkType,
+			CheckUUID: check.uniqueID(),
+			Timestamp: time.Now().Unix(),
+			Message:   err.Error(),
+		}, err
+	}
+
+	res, err := fm.runCheckInPool(ctx, check, slot)
 	if err == nil {
 		return res, nil
 	}
@@ -575,10 +743,15 @@ func (fm *Frontman) runCheck(check Check, local bool) (*Result, error) {
 	if fm.Config.FailureConfirmation > 0 {
 		logrus.Debugf("runChecks failed, retrying up to %d times: %s: %s", fm.Config.FailureConfirmation, check.uniqueID(), err.Error())
 
+	retries:
 		for i := 1; i <= fm.Config.FailureConfirmation; i++ {
-			time.Sleep(time.Duration(fm.Config.FailureConfirmationDelay*1000) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				break retries
+			case <-time.After(time.Duration(fm.Config.FailureConfirmationDelay*1000) * time.Millisecond):
+			}
 			logrus.Debugf("Retry %d for failed check %s", i, check.uniqueID())
-			res, err = check.run(fm)
+			res, err = fm.runCheckInPool(ctx, check, nil)
 			if err == nil {
 				recovered = true
 				break
@@ -589,7 +762,7 @@ func (fm *Frontman) runCheck(check Check, local bool) (*Result, error) {
 		res.Message = err.Error()
 	}
 	if !recovered && local {
-		fm.askNodes(check, res)
+		fm.askNodes(ctx, check, res)
 	}
 
 	if !recovered {
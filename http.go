@@ -39,6 +39,11 @@ func (fm *Frontman) checkHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// the requesting frontman keeps no counter state on this node
+	for i := range inputConfig.SNMPChecks {
+		inputConfig.SNMPChecks[i].stateless = true
+	}
+
 	fm.resultsLock.Lock()
 
 	// perform the checks, collect result and pass it back as json
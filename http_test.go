@@ -2,12 +2,16 @@ package frontman
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/soniah/gosnmp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPingHandler(t *testing.T) {
@@ -107,3 +111,41 @@ func TestHttpCheckInvalidHost(t *testing.T) {
 	assert.Equal(t, "webcheck_broken", dec["checkUuid"])
 	assert.Equal(t, 0., measurements["http.get.success"])
 }
+
+func TestHttpCheckHandlerSNMP(t *testing.T) {
+	agent := helperStartGetNextAgent(t, []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "test switch"},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(1234)},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: "switch-1"},
+	})
+	defer agent.Close()
+
+	checks := fmt.Sprintf(`{
+		"snmpChecks": [{
+			"checkUUID": "snmp_oid",
+			"check": { "connect": "127.0.0.1", "port": %d, "timeout": 1, "protocol": "v2", "community": "public", "preset": "oid", "oid": ".1.3.6.1.2.1.1.5.0"}
+		  }]
+	  }`, agent.LocalAddr().(*net.UDPAddr).Port)
+
+	cfg := NewConfig()
+	fm := helperCreateFrontman(t, cfg)
+
+	req, err := http.NewRequest("POST", "/check", strings.NewReader(checks))
+	assert.Equal(t, nil, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(fm.checkHandler)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var f []map[string]interface{}
+	assert.Equal(t, nil, json.Unmarshal(rr.Body.Bytes(), &f))
+	require.Len(t, f, 1)
+
+	measurements := f[0]["measurements"].(map[string]interface{})
+	assert.Equal(t, "snmpCheck", f[0]["checkType"])
+	assert.Equal(t, "snmp_oid", f[0]["checkUuid"])
+	assert.Equal(t, 1., measurements["snmpCheck.oid.success"])
+	assert.Equal(t, "switch-1", measurements[".1.3.6.1.2.1.1.5.0"].(map[string]interface{})["value"])
+}
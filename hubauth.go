@@ -0,0 +1,177 @@
+package frontman
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// methods to authorize the requests to the hub, by precedence
+const (
+	hubAuthOAuth2 = "oauth2"
+	hubAuthBearer = "bearer"
+	hubAuthBasic  = "basic"
+	hubAuthNone   = "none"
+)
+
+// OAuth2 tokens are refreshed this long before they expire
+const oauth2RefreshMargin = 30 * time.Second
+
+// hubAuth authorizes the requests to the hub with hub_user and hub_password,
+// a static bearer token or an OAuth2 token from the client credentials grant (RFC 6749 section 4.4)
+type hubAuth struct {
+	cfg *Config
+
+	// requests the OAuth2 tokens, shares proxy and TLS settings with the hub client
+	client *http.Client
+
+	lock   sync.Mutex
+	token  string
+	expiry time.Time // zero if the token doesn't expire
+}
+
+func newHubAuth(cfg *Config, client *http.Client) *hubAuth {
+	return &hubAuth{cfg: cfg, client: client}
+}
+
+// method returns the configured authorization method
+func (a *hubAuth) method() string {
+	switch {
+	case a.cfg.HubOAuth2TokenURL != "":
+		return hubAuthOAuth2
+	case a.cfg.HubToken != "" || a.cfg.HubTokenFile != "":
+		return hubAuthBearer
+	case a.cfg.HubUser != "":
+		return hubAuthBasic
+	}
+	return hubAuthNone
+}
+
+// authorize sets the Authorization header of a request to the hub
+func (a *hubAuth) authorize(req *http.Request) error {
+	switch a.method() {
+	case hubAuthOAuth2:
+		token, err := a.oauth2Token(req.Context())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case hubAuthBearer:
+		token, err := a.staticToken()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case hubAuthBasic:
+		req.SetBasicAuth(a.cfg.HubUser, a.cfg.HubPassword)
+	}
+	return nil
+}
+
+// invalidate drops the OAuth2 token after the hub refused it, the next request gets a new one
+func (a *hubAuth) invalidate() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.token = ""
+}
+
+// staticToken returns hub_token or the content of hub_token_file, read on every request so it can be rotated
+func (a *hubAuth) staticToken() (string, error) {
+	if a.cfg.HubTokenFile == "" {
+		return a.cfg.HubToken, nil
+	}
+	b, err := ioutil.ReadFile(a.cfg.HubTokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read hub_token_file")
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", errors.New("hub_token_file is empty")
+	}
+	return token, nil
+}
+
+type oauth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oauth2Token returns the current token and requests a new one shortly before it expires
+func (a *hubAuth) oauth2Token(ctx context.Context) (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	if a.token != "" && (a.expiry.IsZero() || now.Before(a.expiry.Add(-oauth2RefreshMargin))) {
+		return a.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.cfg.HubOAuth2Scopes) > 0 {
+		form.Set("scope", strings.Join(a.cfg.HubOAuth2Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", a.cfg.HubOAuth2TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.cfg.HubOAuth2ClientID), url.QueryEscape(a.cfg.HubOAuth2ClientSecret))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "OAuth2 token request failed")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "OAuth2 token request failed")
+	}
+	var token oauth2TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", errors.Wrap(err, "invalid OAuth2 token response")
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		if token.Error != "" {
+			return "", fmt.Errorf("OAuth2 token request failed (HTTP %d): %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+		}
+		return "", fmt.Errorf("OAuth2 token request failed (HTTP %d)", resp.StatusCode)
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", fmt.Errorf("unsupported OAuth2 token type %s", token.TokenType)
+	}
+
+	a.token = token.AccessToken
+	a.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	logrus.Debugf("hub auth: got an OAuth2 token expiring in %d seconds", token.ExpiresIn)
+	return a.token, nil
+}
+
+// hubClientCertificate loads hub_client_cert and hub_client_key on every TLS handshake,
+// so renewed certificates are used without a restart
+func (fm *Frontman) hubClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(fm.Config.HubClientCert, fm.Config.HubClientKey)
+	if err != nil {
+		logrus.Errorf("Failed to load the hub client certificate: %s", err)
+		return nil, err
+	}
+	return &cert, nil
+}
@@ -0,0 +1,178 @@
+package frontman
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubAuthBearerToken(t *testing.T) {
+	var authorization string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	cfg.HubUser = "user"
+	cfg.HubToken = "secret"
+	fm := helperCreateFrontman(t, cfg)
+
+	_, err := fm.inputFromHub()
+	require.Nil(t, err)
+	assert.Equal(t, "Bearer secret", authorization)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.Nil(t, ioutil.WriteFile(tokenFile, []byte("rotated\n"), 0600))
+	fm.Config.HubTokenFile = tokenFile
+	require.Nil(t, fm.postResultsToHub([]Result{{CheckUUID: "a"}}))
+	assert.Equal(t, "Bearer rotated", authorization)
+
+	require.Nil(t, os.Remove(tokenFile))
+	err = fm.CheckHubCredentials(context.Background(), "hub_url", "hub_user", "hub_password")
+	assert.Contains(t, err.Error(), "hub_token_file field verification failed")
+}
+
+func TestHubAuthOAuth2(t *testing.T) {
+	var tokenRequests int32
+	var expiresIn int64 = 3600
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokenRequests, 1)
+		id, secret, _ := r.BasicAuth()
+		_ = r.ParseForm()
+		if id != "frontman" || secret != "s3cret" || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(oauth2TokenResponse{Error: "invalid_client"})
+			return
+		}
+		assert.Equal(t, "checks results", r.Form.Get("scope"))
+		_ = json.NewEncoder(w).Encode(oauth2TokenResponse{
+			AccessToken: fmt.Sprintf("token%d", n),
+			TokenType:   "Bearer",
+			ExpiresIn:   atomic.LoadInt64(&expiresIn),
+		})
+	}))
+	defer tokenServer.Close()
+
+	var revoked int32
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token1" && atomic.LoadInt32(&revoked) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	cfg.HubOAuth2TokenURL = tokenServer.URL
+	cfg.HubOAuth2ClientID = "frontman"
+	cfg.HubOAuth2ClientSecret = "s3cret"
+	cfg.HubOAuth2Scopes = []string{"checks", "results"}
+	cfg.HubRetry.InitialDelay = 0
+	fm := helperCreateFrontman(t, cfg)
+
+	// the token is reused until the hub refuses it
+	require.Nil(t, fm.CheckHubCredentials(context.Background(), "hub_url", "hub_user", "hub_password"))
+	_, err := fm.inputFromHub()
+	require.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenRequests))
+
+	atomic.StoreInt32(&revoked, 1)
+	_, err = fm.inputFromHub()
+	require.NotNil(t, err)
+	_, err = fm.inputFromHub()
+	require.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokenRequests))
+
+	// tokens about to expire are refreshed
+	atomic.StoreInt64(&expiresIn, 10)
+	fm.hubAuth.invalidate()
+	require.Nil(t, fm.postResultsToHub([]Result{{CheckUUID: "a"}}))
+	require.Nil(t, fm.postResultsToHub([]Result{{CheckUUID: "a"}}))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&tokenRequests))
+
+	fm.Config.HubOAuth2ClientSecret = "wrong"
+	fm.hubAuth.invalidate()
+	err = fm.CheckHubCredentials(context.Background(), "hub_url", "hub_user", "hub_password")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "OAuth2 token request failed (HTTP 401): invalid_client")
+}
+
+// writes a self-signed certificate and its key as PEM files
+func helperWriteCertificate(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "frontman"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile, cert
+}
+
+func TestHubAuthClientCertificate(t *testing.T) {
+	certFile, keyFile, cert := helperWriteCertificate(t, t.TempDir())
+
+	hub := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	hub.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	hub.StartTLS()
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	cfg.HubClientCert = certFile
+	cfg.HubClientKey = keyFile
+	fm := helperCreateFrontman(t, cfg)
+	// trust the certificate of the test server
+	fm.rootCAs = x509.NewCertPool()
+	fm.rootCAs.AddCert(hub.Certificate())
+	fm.initHubClient()
+
+	require.Nil(t, fm.CheckHubCredentials(context.Background(), "hub_url", "hub_user", "hub_password"))
+	_, err := fm.inputFromHub()
+	require.Nil(t, err)
+
+	fm.Config.HubClientKey = certFile
+	err = fm.CheckHubCredentials(context.Background(), "hub_url", "hub_user", "hub_password")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "hub_client_cert field verification failed")
+}
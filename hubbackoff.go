@@ -0,0 +1,151 @@
+package frontman
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// hubBackoff delays requests to the hub after failures, shared by fetching checks and posting results.
+// The delay grows exponentially with every failure in a row, Retry-After of the hub is honored.
+// After several failures in a row the circuit opens and only a single request probes the hub after the timeout
+type hubBackoff struct {
+	initialDelay    time.Duration
+	maxDelay        time.Duration
+	jitter          float64
+	circuitFailures int
+	circuitTimeout  time.Duration
+
+	lock     sync.Mutex
+	failures int       // failures in a row
+	retryAt  time.Time // no requests before
+	open     bool
+	probing  bool // a request probes the hub while the circuit is open
+}
+
+func newHubBackoff(cfg *HubRetryConfig) *hubBackoff {
+	return &hubBackoff{
+		initialDelay:    secToDuration(cfg.InitialDelay),
+		maxDelay:        secToDuration(cfg.MaxDelay),
+		jitter:          cfg.Jitter,
+		circuitFailures: cfg.CircuitBreakerFailures,
+		circuitTimeout:  secToDuration(cfg.CircuitBreakerTimeout),
+	}
+}
+
+// allow returns ErrorHubUnavailable if the hub must not be requested now.
+// Every allowed request must be followed by success or failure
+func (b *hubBackoff) allow(now time.Time) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if now.Before(b.retryAt) {
+		return ErrorHubUnavailable{b.retryAt.Sub(now)}
+	}
+	if b.open {
+		if b.probing {
+			return ErrorHubUnavailable{}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// paused returns ErrorHubUnavailable if requests would not be allowed now, without counting as a request
+func (b *hubBackoff) paused(now time.Time) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if now.Before(b.retryAt) {
+		return ErrorHubUnavailable{b.retryAt.Sub(now)}
+	}
+	if b.open && b.probing {
+		return ErrorHubUnavailable{}
+	}
+	return nil
+}
+
+// wait returns how long requests are delayed from now
+func (b *hubBackoff) wait(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if now.Before(b.retryAt) {
+		return b.retryAt.Sub(now)
+	}
+	return 0
+}
+
+func (b *hubBackoff) success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.open {
+		logrus.Infof("Hub is reachable again after %d failures", b.failures)
+	}
+	b.failures = 0
+	b.retryAt = time.Time{}
+	b.open = false
+	b.probing = false
+}
+
+// failure delays the next request and returns the delay.
+// retryAfter is the delay requested by the hub, 0 if none
+func (b *hubBackoff) failure(now time.Time, retryAfter time.Duration) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	delay := b.initialDelay
+	for i := 1; i < b.failures && delay < b.maxDelay; i++ {
+		delay *= 2
+	}
+	if b.maxDelay > 0 && delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+	if b.jitter > 0 && delay > 0 {
+		// spread the retries of many frontmen
+		spread := time.Duration(float64(delay) * b.jitter)
+		delay = delay - spread + time.Duration(rand.Int63n(int64(spread)+1))
+	}
+
+	if b.circuitFailures > 0 && b.failures >= b.circuitFailures {
+		if !b.open {
+			logrus.Warnf("Hub failed %d times in a row, pausing requests for %v. Checks keep running", b.failures, b.circuitTimeout)
+		}
+		b.open = true
+		if delay < b.circuitTimeout {
+			delay = b.circuitTimeout
+		}
+	}
+
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	b.retryAt = now.Add(delay)
+	return delay
+}
+
+// parses the Retry-After header given as seconds or HTTP date, 0 if missing or invalid
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	header := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package frontman
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubBackoff(t *testing.T) {
+	b := newHubBackoff(&HubRetryConfig{
+		InitialDelay:           1,
+		MaxDelay:               10,
+		CircuitBreakerFailures: 6,
+		CircuitBreakerTimeout:  60,
+	})
+	now := time.Now()
+
+	assert.Nil(t, b.allow(now))
+	for _, expected := range []int{1, 2, 4, 8, 10} {
+		assert.Equal(t, time.Duration(expected)*time.Second, b.failure(now, 0))
+		assert.IsType(t, ErrorHubUnavailable{}, b.allow(now))
+	}
+
+	// Retry-After beyond the backoff delay is honored
+	b.success()
+	assert.Equal(t, 30*time.Second, b.failure(now, 30*time.Second))
+	assert.IsType(t, ErrorHubUnavailable{}, b.allow(now.Add(29*time.Second)))
+	assert.Nil(t, b.allow(now.Add(30*time.Second)))
+	b.success()
+
+	// the circuit opens after 6 failures in a row
+	for i := 0; i < 5; i++ {
+		b.failure(now, 0)
+	}
+	assert.Equal(t, 60*time.Second, b.failure(now, 0))
+
+	// a single request probes the hub
+	later := now.Add(time.Minute)
+	assert.Nil(t, b.allow(later))
+	assert.IsType(t, ErrorHubUnavailable{}, b.allow(later))
+	assert.IsType(t, ErrorHubUnavailable{}, b.paused(later))
+
+	b.failure(later, 0)
+	assert.IsType(t, ErrorHubUnavailable{}, b.allow(later.Add(59*time.Second)))
+	assert.Nil(t, b.allow(later.Add(time.Minute)))
+	b.success()
+	assert.Nil(t, b.allow(later.Add(time.Minute)))
+	assert.Nil(t, b.allow(later.Add(time.Minute)))
+}
+
+func TestHubBackoffJitter(t *testing.T) {
+	b := newHubBackoff(&HubRetryConfig{InitialDelay: 10, MaxDelay: 10, Jitter: 0.5})
+	for i := 0; i < 20; i++ {
+		delay := b.failure(time.Now(), 0)
+		assert.True(t, delay >= 5*time.Second && delay <= 10*time.Second, "delay %v", delay)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	resp := &http.Response{Header: http.Header{}}
+	assert.Equal(t, time.Duration(0), retryAfter(resp, now))
+
+	resp.Header.Set("Retry-After", "120")
+	assert.Equal(t, 120*time.Second, retryAfter(resp, now))
+
+	resp.Header.Set("Retry-After", now.Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Hour.Seconds(), retryAfter(resp, now).Seconds(), 1)
+
+	resp.Header.Set("Retry-After", "soon")
+	assert.Equal(t, time.Duration(0), retryAfter(resp, now))
+}
+
+func TestInputFromHubRetryAfter(t *testing.T) {
+	var requests int32
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	fm := helperCreateFrontman(t, cfg)
+
+	_, err := fm.inputFromHub()
+	require.IsType(t, ErrorHubTooManyRequests{}, err)
+	assert.Equal(t, 120*time.Second, err.(ErrorHubTooManyRequests).retryAfter)
+
+	// the hub isn't requested again before Retry-After passed
+	_, err = fm.inputFromHub()
+	assert.IsType(t, ErrorHubUnavailable{}, err)
+	err = fm.postResultsToHub([]Result{{CheckUUID: "a"}})
+	assert.IsType(t, ErrorHubUnavailable{}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	// the results are sent once the hub is requested again
+	assert.Len(t, fm.offlineResultsBuffer, 1)
+}
+
+func TestHubBackoffAuthorizeFailure(t *testing.T) {
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	cfg.HubTokenFile = filepath.Join(t.TempDir(), "token")
+	fm := helperCreateFrontman(t, cfg)
+	// the circuit is open and the hub may be probed
+	fm.hubBackoff.open = true
+
+	_, err := fm.inputFromHub()
+	require.NotNil(t, err)
+	assert.NotEqual(t, ErrorHubUnavailable{}, err)
+	assert.NotNil(t, fm.postResultsToHub([]Result{{CheckUUID: "a"}}))
+
+	// the failed authorization didn't take the probe
+	require.Nil(t, ioutil.WriteFile(cfg.HubTokenFile, []byte("secret"), 0600))
+	_, err = fm.inputFromHub()
+	require.Nil(t, err)
+	assert.False(t, fm.hubBackoff.open)
+}
@@ -0,0 +1,360 @@
+package frontman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	HubEncodingJSON    = "json"
+	HubEncodingMsgPack = "msgpack"
+	HubEncodingCBOR    = "cbor"
+	HubEncodingAuto    = "auto"
+
+	HubCompressionNone   = "none"
+	HubCompressionGzip   = "gzip"
+	HubCompressionZstd   = "zstd"
+	HubCompressionBrotli = "br"
+	HubCompressionAuto   = "auto"
+)
+
+const (
+	jsonContentType    = "application/json"
+	msgpackContentType = "application/msgpack"
+	cborContentType    = "application/cbor"
+)
+
+// media types of the encodings, by preference in auto mode
+var hubEncodingTypes = []struct {
+	encoding string
+	types    []string
+}{
+	{HubEncodingMsgPack, []string{msgpackContentType, "application/x-msgpack", "application/vnd.msgpack"}},
+	{HubEncodingCBOR, []string{cborContentType}},
+	{HubEncodingJSON, []string{jsonContentType}},
+}
+
+// hubFormat chooses the encoding and compression of the results sent to the hub.
+// In auto mode the hub announces what it accepts with the Accept-Post and Accept-Encoding (RFC 7694) response headers
+type hubFormat struct {
+	encoding    string
+	compression string
+
+	lock              sync.Mutex
+	acceptedTypes     []string
+	acceptedEncodings []string
+	rejected          []string // encodings and compressions the hub refused despite the announcement
+}
+
+func newHubFormat(cfg *Config) *hubFormat {
+	f := &hubFormat{
+		encoding:    cfg.HubEncoding,
+		compression: cfg.HubCompression,
+	}
+	if f.encoding == "" {
+		f.encoding = HubEncodingJSON
+	}
+	if f.compression == "" {
+		// hub_gzip predates hub_compression
+		f.compression = HubCompressionNone
+		if cfg.HubGzip {
+			f.compression = HubCompressionGzip
+		}
+	}
+	return f
+}
+
+// splits a header list and strips parameters like q=0.5
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if i := strings.Index(t, ";"); i >= 0 {
+				t = t[:i]
+			}
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// announce keeps the formats the hub accepts according to a response
+func (f *hubFormat) announce(h http.Header) {
+	types := headerTokens(h, "Accept-Post")
+	encodings := headerTokens(h, "Accept-Encoding")
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(types) > 0 {
+		f.acceptedTypes = types
+	}
+	if len(encodings) > 0 {
+		f.acceptedEncodings = encodings
+	}
+}
+
+// reject stops using the negotiated formats after the hub refused them
+func (f *hubFormat) reject(encoding, compression string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.encoding == HubEncodingAuto && encoding != HubEncodingJSON {
+		f.rejected = append(f.rejected, encoding)
+	}
+	if f.compression == HubCompressionAuto && compression != HubCompressionNone {
+		f.rejected = append(f.rejected, compression)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the encoding and compression to use for the next request
+func (f *hubFormat) current() (encoding, compression string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	encoding, compression = f.encoding, f.compression
+	if encoding == HubEncodingAuto {
+		encoding = HubEncodingJSON
+	found:
+		for _, e := range hubEncodingTypes {
+			if contains(f.rejected, e.encoding) {
+				continue
+			}
+			for _, t := range e.types {
+				if contains(f.acceptedTypes, t) {
+					encoding = e.encoding
+					break found
+				}
+			}
+		}
+	}
+	if compression == HubCompressionAuto {
+		compression = HubCompressionNone
+		for _, c := range []string{HubCompressionZstd, HubCompressionBrotli, HubCompressionGzip} {
+			if contains(f.acceptedEncodings, c) && !contains(f.rejected, c) {
+				compression = c
+				break
+			}
+		}
+	}
+	return encoding, compression
+}
+
+// negotiated returns true if a rejected request may succeed with other formats
+func (f *hubFormat) negotiated() bool {
+	return f.encoding == HubEncodingAuto || f.compression == HubCompressionAuto
+}
+
+// marshalResults encodes the results for the hub and returns the content type
+func (fm *Frontman) marshalResults(results []Result) ([]byte, string, error) {
+	payload := Results{Results: results}
+	encoding, _ := fm.hubFormat.current()
+
+	b, err := json.Marshal(payload)
+	if err != nil || encoding == HubEncodingJSON {
+		return b, jsonContentType, err
+	}
+
+	// the binary encodings carry the same structure as JSON, including the MarshalJSON of the measurements
+	v, err := jsonValue(b)
+	if err != nil {
+		return nil, "", err
+	}
+	switch encoding {
+	case HubEncodingMsgPack:
+		var buffer bytes.Buffer
+		enc := msgpack.NewEncoder(&buffer)
+		enc.SetSortMapKeys(true)
+		enc.UseCompactInts(true)
+		if err := enc.Encode(v); err != nil {
+			return nil, "", err
+		}
+		return buffer.Bytes(), msgpackContentType, nil
+	case HubEncodingCBOR:
+		b, err := cborEncMode.Marshal(v)
+		return b, cborContentType, err
+	}
+	return b, jsonContentType, nil
+}
+
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// cbor decodes maps as map[interface{}]interface{} by default, which JSON can't marshal
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// jsonValue decodes JSON into generic values with the numbers as integers where possible
+func jsonValue(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return jsonNumbers(v), nil
+}
+
+func jsonNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonNumbers(e)
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// compressResults compresses the encoded results and returns the content encoding, empty for none
+func (fm *Frontman) compressResults(b []byte) ([]byte, string, error) {
+	_, compression := fm.hubFormat.current()
+
+	switch compression {
+	case HubCompressionGzip:
+		var buffer bytes.Buffer
+		zw := gzip.NewWriter(&buffer)
+		if _, err := zw.Write(b); err != nil {
+			_ = zw.Close()
+			return nil, "", err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", err
+		}
+		return buffer.Bytes(), "gzip", nil
+	case HubCompressionZstd:
+		return zstdEncoder.EncodeAll(b, nil), HubCompressionZstd, nil
+	case HubCompressionBrotli:
+		var buffer bytes.Buffer
+		bw := brotli.NewWriter(&buffer)
+		if _, err := bw.Write(b); err != nil {
+			_ = bw.Close()
+			return nil, "", err
+		}
+		if err := bw.Close(); err != nil {
+			return nil, "", err
+		}
+		return buffer.Bytes(), HubCompressionBrotli, nil
+	}
+	return b, "", nil
+}
+
+// decodeResults decodes a request body encoded by marshalResults and compressResults
+func decodeResults(contentType, contentEncoding string, body []byte) (*Results, error) {
+	var err error
+	switch strings.ToLower(contentEncoding) {
+	case "":
+	case "gzip":
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(body)); err == nil {
+			var buffer bytes.Buffer
+			_, err = buffer.ReadFrom(zr)
+			body = buffer.Bytes()
+		}
+	case HubCompressionZstd:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(nil); err == nil {
+			body, err = zr.DecodeAll(body, nil)
+			zr.Close()
+		}
+	case HubCompressionBrotli:
+		var buffer bytes.Buffer
+		_, err = buffer.ReadFrom(brotli.NewReader(bytes.NewReader(body)))
+		body = buffer.Bytes()
+	default:
+		return nil, errUnsupportedEncoding(contentEncoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var v interface{}
+	switch mediaType {
+	case "", jsonContentType:
+		var res Results
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, err
+		}
+		return &res, nil
+	case msgpackContentType, "application/x-msgpack", "application/vnd.msgpack":
+		err = msgpack.Unmarshal(body, &v)
+	case cborContentType:
+		err = cborDecMode.Unmarshal(body, &v)
+	default:
+		return nil, errUnsupportedEncoding(contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the generic values have the same structure as JSON
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res Results
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type errUnsupportedEncoding string
+
+func (e errUnsupportedEncoding) Error() string {
+	return "unsupported encoding " + string(e)
+}
+
+// encodingOf returns the encoding of a content type written by marshalResults
+func encodingOf(contentType string) string {
+	for _, e := range hubEncodingTypes {
+		if contains(e.types, contentType) {
+			return e.encoding
+		}
+	}
+	return HubEncodingJSON
+}
+
+// stops using the negotiated formats the hub refused with 415 Unsupported Media Type
+func (fm *Frontman) handleUnsupportedMediaType(encoding, compression string) {
+	if !fm.hubFormat.negotiated() {
+		return
+	}
+	logrus.Warnf("Hub refused %s encoded results with %s compression, not using them anymore", encoding, compression)
+	fm.hubFormat.reject(encoding, compression)
+}
@@ -0,0 +1,122 @@
+package frontman
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalResultsEncodings(t *testing.T) {
+	results := helperSinkResults()
+	results[0].Check = ServiceCheckData{Connect: "example.com", Port: "22", Protocol: "tcp", Service: "ssh"}
+	results[1].Message = "timeout"
+	results[1].Measurements["ifInOctets_per_s"] = jsonFloat64(math.NaN())
+	results[1].Measurements["ifInUcastPkts"] = uint64(math.MaxUint64)
+	// enough repetitions for zstd to find matches
+	for i := 0; i < 50; i++ {
+		results = append(results, results[i%2])
+	}
+
+	// what the hub gets for JSON
+	b, err := json.Marshal(Results{Results: results})
+	require.Nil(t, err)
+	var expected Results
+	require.Nil(t, json.Unmarshal(b, &expected))
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	for _, encoding := range []string{HubEncodingJSON, HubEncodingMsgPack, HubEncodingCBOR} {
+		for _, compression := range []string{HubCompressionNone, HubCompressionGzip, HubCompressionZstd, HubCompressionBrotli} {
+			t.Run(encoding+"/"+compression, func(t *testing.T) {
+				cfg.HubEncoding = encoding
+				cfg.HubCompression = compression
+				fm := helperCreateFrontman(t, cfg)
+
+				b, contentType, err := fm.marshalResults(results)
+				require.Nil(t, err)
+				body, contentEncoding, err := fm.compressResults(b)
+				require.Nil(t, err)
+				if compression != HubCompressionNone {
+					assert.Equal(t, compression, contentEncoding)
+					assert.True(t, len(body) < len(b))
+				}
+
+				res, err := decodeResults(contentType, contentEncoding, body)
+				require.Nil(t, err)
+				assert.Equal(t, expected, *res)
+			})
+		}
+	}
+}
+
+func TestHubFormatLegacyGzip(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubGzip = true
+	cfg.HubCompression = ""
+	encoding, compression := newHubFormat(cfg).current()
+	assert.Equal(t, HubEncodingJSON, encoding)
+	assert.Equal(t, HubCompressionGzip, compression)
+}
+
+func TestHubFormatNegotiation(t *testing.T) {
+	hub := NewMockHub("")
+	var contentTypes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, fmt.Sprintf("%s %s", r.Header.Get("Content-Type"), r.Header.Get("Content-Encoding")))
+		if strings.Contains(r.Header.Get("Content-Type"), "cbor") {
+			// announced but broken
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		hub.indexHandler(w, r)
+	}))
+	defer server.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = server.URL
+	cfg.HubEncoding = HubEncodingAuto
+	cfg.HubCompression = HubCompressionAuto
+	cfg.HubRetry.InitialDelay = 0
+	fm := helperCreateFrontman(t, cfg)
+
+	// nothing announced yet
+	require.Nil(t, fm.postResultsToHub(helperSinkResults()))
+	// the hub prefers msgpack and zstd
+	require.Nil(t, fm.postResultsToHub(helperSinkResults()))
+
+	hub.AcceptPost = "application/cbor, application/json"
+	hub.AcceptEncoding = "gzip"
+	require.Nil(t, fm.postResultsToHub(helperSinkResults()))
+	// the hub refuses cbor with gzip, the results are kept and sent with the defaults
+	require.NotNil(t, fm.postResultsToHub(helperSinkResults()))
+	require.Nil(t, fm.postResultsToHub(helperSinkResults()))
+
+	assert.Equal(t, []string{
+		"application/json ",
+		"application/msgpack zstd",
+		"application/msgpack zstd",
+		"application/cbor gzip",
+		"application/json ",
+	}, contentTypes)
+	assert.Len(t, hub.Received(), 10)
+}
+
+func TestHubFormatAnnouncedCompression(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubCompression = HubCompressionAuto
+	f := newHubFormat(cfg)
+
+	f.announce(http.Header{"Accept-Encoding": []string{"gzip;q=0.5, br"}})
+	_, compression := f.current()
+	assert.Equal(t, HubCompressionBrotli, compression)
+
+	f.reject(HubEncodingJSON, HubCompressionBrotli)
+	_, compression = f.current()
+	assert.Equal(t, HubCompressionGzip, compression)
+}
@@ -0,0 +1,365 @@
+package frontman
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// types of the messages exchanged over the hub stream
+const (
+	// hub -> frontman: replaces the scheduled checks
+	streamMessageChecks = "checks"
+	// hub -> frontman: runs the checks once, now
+	streamMessageRun = "run"
+	// hub -> frontman: the results with the id were stored
+	streamMessageAck = "ack"
+	// frontman -> hub: completed check results
+	streamMessageResults = "results"
+)
+
+const (
+	streamWriteTimeout   = 10 * time.Second
+	streamMaxMessageSize = 32 * 1024 * 1024
+	streamQueueSize      = 1000
+)
+
+type streamMessage struct {
+	Type    string   `json:"type"`
+	ID      uint64   `json:"id,omitempty"`
+	Checks  *Input   `json:"checks,omitempty"`
+	Results []Result `json:"results,omitempty"`
+
+	// signature of the checks if hub_signing_key is set, see verifyHubSignature
+	Signature string `json:"signature,omitempty"`
+}
+
+// hubStream is a WebSocket connection to the hub configured by Config.HubStream.
+// Results are kept until the hub acknowledged them and handed to the HTTP sender
+// if the stream drops or the acknowledgement doesn't arrive in time
+type hubStream struct {
+	fm             *Frontman
+	url            string
+	pingInterval   time.Duration
+	reconnectDelay time.Duration
+	ackTimeout     time.Duration
+
+	// results waiting to be written to the stream
+	queue chan Result
+	// closed once runContinuous returned
+	done chan struct{}
+
+	lock    sync.Mutex
+	conn    *websocket.Conn // nil while disconnected
+	nextID  uint64
+	pending map[uint64]pendingResults // sent, not acknowledged yet
+}
+
+type pendingResults struct {
+	results []Result
+	sent    time.Time
+}
+
+func newHubStream(fm *Frontman, cfg *HubStreamConfig) *hubStream {
+	s := &hubStream{
+		fm:             fm,
+		url:            cfg.URL,
+		pingInterval:   secToDuration(cfg.PingInterval),
+		reconnectDelay: secToDuration(cfg.ReconnectDelay),
+		ackTimeout:     secToDuration(cfg.AckTimeout),
+		queue:          make(chan Result, streamQueueSize),
+		done:           make(chan struct{}),
+		pending:        make(map[uint64]pendingResults),
+	}
+	if s.pingInterval <= 0 {
+		s.pingInterval = 30 * time.Second
+	}
+	if s.ackTimeout <= 0 {
+		s.ackTimeout = 30 * time.Second
+	}
+	return s
+}
+
+// stopped is closed once the stream stopped and handed its unacknowledged results to the HTTP sender,
+// it is closed from the start for a nil stream
+func (s *hubStream) stopped() <-chan struct{} {
+	if s == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return s.done
+}
+
+// connected returns true if the hub is reachable over the stream, false for a nil stream
+func (s *hubStream) connected() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conn != nil
+}
+
+// send queues a result for the stream, false if it has to be sent over HTTP
+func (s *hubStream) send(res Result) bool {
+	if !s.connected() {
+		return false
+	}
+	select {
+	case s.queue <- res:
+		return true
+	default:
+		return false
+	}
+}
+
+// runContinuous keeps the stream connected until interrupted
+func (s *hubStream) runContinuous() {
+	defer close(s.done)
+	for {
+		if err := s.session(); err != nil {
+			logrus.Warnf("hub stream: %s, falling back to polling", err)
+		}
+		select {
+		case <-s.fm.InterruptChan:
+			return
+		case <-time.After(s.reconnectDelay):
+		}
+	}
+}
+
+func (s *hubStream) dial() (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: time.Duration(s.fm.Config.HubRequestTimeout) * time.Second,
+	}
+	if transport, ok := s.fm.hubClient.Transport.(*http.Transport); ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", s.fm.userAgent())
+	if err := s.fm.hubAuth.authorize(req); err != nil {
+		return nil, err
+	}
+
+	conn, resp, err := dialer.Dial(s.url, req.Header)
+	if err != nil {
+		if resp != nil {
+			if resp.StatusCode == http.StatusUnauthorized {
+				s.fm.hubAuth.invalidate()
+			}
+			return nil, fmt.Errorf("%s: %s", err, resp.Status)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// session serves one connection and returns the unacknowledged results to the HTTP sender when it drops
+func (s *hubStream) session() error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	logrus.Infof("hub stream: connected to %s", s.url)
+
+	s.lock.Lock()
+	s.conn = conn
+	s.lock.Unlock()
+
+	done := make(chan struct{})
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- s.writeLoop(conn, done)
+	}()
+
+	err = s.readLoop(conn)
+	close(done)
+	conn.Close()
+	if werr := <-writeErr; werr != nil {
+		err = werr
+	}
+
+	s.lock.Lock()
+	s.conn = nil
+	s.lock.Unlock()
+
+	results := s.takePending(time.Now())
+drain:
+	for {
+		select {
+		case res := <-s.queue:
+			results = append(results, res)
+		default:
+			break drain
+		}
+	}
+	if len(results) > 0 {
+		logrus.Infof("hub stream: %d unacknowledged results are sent over HTTP", len(results))
+		s.fm.queueResults(results)
+	}
+
+	select {
+	case <-s.fm.InterruptChan:
+		return nil
+	default:
+	}
+	return err
+}
+
+// takePending removes the batches sent until sentBefore from the pending ones and returns their results in order
+func (s *hubStream) takePending(sentBefore time.Time) []Result {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var ids []uint64
+	for id, p := range s.pending {
+		if !p.sent.After(sentBefore) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var results []Result
+	for _, id := range ids {
+		results = append(results, s.pending[id].results...)
+		delete(s.pending, id)
+	}
+	return results
+}
+
+// expirePending hands the results the hub didn't acknowledge within ackTimeout to the HTTP sender
+func (s *hubStream) expirePending(now time.Time) {
+	results := s.takePending(now.Add(-s.ackTimeout))
+	if len(results) > 0 {
+		logrus.Warnf("hub stream: %d results not acknowledged within %v are sent over HTTP", len(results), s.ackTimeout)
+		s.fm.queueResults(results)
+	}
+}
+
+func (s *hubStream) readLoop(conn *websocket.Conn) error {
+	timeout := 2 * s.pingInterval
+	conn.SetReadLimit(streamMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+		var msg streamMessage
+		if err := json.Unmarshal(b, &msg); err != nil {
+			logrus.Warnf("hub stream: invalid message: %s", err)
+			continue
+		}
+		if msg.Checks != nil && s.fm.Config.HubSigningKey != "" {
+			var raw struct {
+				Checks json.RawMessage `json:"checks"`
+			}
+			_ = json.Unmarshal(b, &raw)
+			if err := s.fm.verifyHubSignature(raw.Checks, msg.Signature); err != nil {
+				logrus.Warnf("hub stream: refusing %s message: %s", msg.Type, err)
+				continue
+			}
+		}
+		s.handle(&msg)
+	}
+}
+
+func (s *hubStream) handle(msg *streamMessage) {
+	switch msg.Type {
+	case streamMessageChecks, streamMessageRun:
+		if msg.Checks == nil {
+			logrus.Warnf("hub stream: %s message without checks", msg.Type)
+			return
+		}
+		checks := msg.Checks.asChecks()
+		if msg.Type == streamMessageRun {
+			logrus.Infof("hub stream: running %d checks now", len(checks))
+			s.fm.addUniqueChecks(checks)
+			return
+		}
+		logrus.Infof("hub stream: received %d checks", len(checks))
+		s.fm.statsLock.Lock()
+		s.fm.stats.ChecksFetchedFromHub += uint64(len(checks))
+		s.fm.statsLock.Unlock()
+		// the next poll fetches the full list if the stream drops
+		s.fm.catalog.replace(checks, "")
+		s.fm.scheduler.update(checks, time.Now())
+	case streamMessageAck:
+		s.lock.Lock()
+		p, ok := s.pending[msg.ID]
+		delete(s.pending, msg.ID)
+		s.lock.Unlock()
+		if ok {
+			s.fm.statsLock.Lock()
+			s.fm.stats.CheckResultsSentToHub += uint64(len(p.results))
+			s.fm.statsLock.Unlock()
+		}
+	default:
+		logrus.Debugf("hub stream: ignoring message of type %q", msg.Type)
+	}
+}
+
+func (s *hubStream) writeLoop(conn *websocket.Conn, done chan struct{}) error {
+	ping := time.NewTicker(s.pingInterval)
+	defer ping.Stop()
+	expire := time.NewTicker(s.ackTimeout / 2)
+	defer expire.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-s.fm.InterruptChan:
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			conn.Close()
+			return nil
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				conn.Close()
+				return err
+			}
+		case now := <-expire.C:
+			s.expirePending(now)
+		case res := <-s.queue:
+			batch := []Result{res}
+		collect:
+			for len(batch) < s.fm.Config.SenderBatchSize {
+				select {
+				case res := <-s.queue:
+					batch = append(batch, res)
+				default:
+					break collect
+				}
+			}
+
+			s.lock.Lock()
+			s.nextID++
+			id := s.nextID
+			s.pending[id] = pendingResults{results: batch, sent: time.Now()}
+			s.lock.Unlock()
+
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(streamMessage{Type: streamMessageResults, ID: id, Results: batch}); err != nil {
+				conn.Close()
+				return err
+			}
+		}
+	}
+}
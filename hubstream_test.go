@@ -0,0 +1,160 @@
+package frontman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubStream(t *testing.T) {
+	received := make(chan streamMessage, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteJSON(streamMessage{Type: streamMessageChecks, Checks: &Input{
+			ServiceChecks: []ServiceCheck{{UUID: "tcp1", Check: ServiceCheckData{Connect: "127.0.0.1", Port: "1", Protocol: "tcp"}}},
+		}})
+		_ = conn.WriteJSON(streamMessage{Type: streamMessageRun, Checks: &Input{
+			ServiceChecks: []ServiceCheck{{UUID: "tcp2", Check: ServiceCheckData{Connect: "127.0.0.1", Port: "2", Protocol: "tcp"}}},
+		}})
+
+		// acknowledge the first batch only, then drop the connection
+		var msg streamMessage
+		if conn.ReadJSON(&msg) != nil {
+			return
+		}
+		received <- msg
+		_ = conn.WriteJSON(streamMessage{Type: streamMessageAck, ID: msg.ID})
+		if conn.ReadJSON(&msg) != nil {
+			return
+		}
+		received <- msg
+	}))
+	defer server.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubStream.URL = "ws" + strings.TrimPrefix(server.URL, "http")
+	cfg.HubStream.ReconnectDelay = 60
+	fm := helperCreateFrontman(t, cfg)
+	require.NotNil(t, fm.stream)
+	defer close(fm.InterruptChan)
+
+	go fm.stream.runContinuous()
+	require.Eventually(t, fm.stream.connected, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		fm.checksLock.RLock()
+		defer fm.checksLock.RUnlock()
+		return len(fm.checks) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "tcp2", fm.checks[0].uniqueID())
+	assert.Len(t, fm.scheduler.due(time.Now().Add(time.Hour)), 1)
+
+	require.True(t, fm.stream.send(Result{CheckUUID: "tcp1", Timestamp: time.Now().Unix()}))
+	msg := <-received
+	assert.Equal(t, streamMessageResults, msg.Type)
+	require.Len(t, msg.Results, 1)
+	assert.Equal(t, "tcp1", msg.Results[0].CheckUUID)
+
+	// the unacknowledged result goes to the HTTP sender when the stream drops
+	require.True(t, fm.stream.send(Result{CheckUUID: "tcp2", Timestamp: time.Now().Unix()}))
+	<-received
+	require.Eventually(t, func() bool { return !fm.stream.connected() }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, fm.stream.send(Result{CheckUUID: "tcp3"}))
+
+	require.Eventually(t, func() bool {
+		fm.resultsLock.RLock()
+		defer fm.resultsLock.RUnlock()
+		return len(fm.results) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "tcp2", fm.results[0].CheckUUID)
+	assert.Equal(t, uint64(1), fm.stats.CheckResultsSentToHub)
+	assert.Equal(t, uint64(1), fm.stats.ChecksFetchedFromHub)
+}
+
+// helperStartSilentStreamHub accepts stream connections and reads the results without acknowledging them
+func helperStartSilentStreamHub(t *testing.T, received chan streamMessage) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg streamMessage
+			if conn.ReadJSON(&msg) != nil {
+				return
+			}
+			received <- msg
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestHubStreamAckTimeout(t *testing.T) {
+	received := make(chan streamMessage, 10)
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubStream.URL = helperStartSilentStreamHub(t, received)
+	cfg.HubStream.AckTimeout = 0.2
+	fm := helperCreateFrontman(t, cfg)
+	defer close(fm.InterruptChan)
+
+	go fm.stream.runContinuous()
+	require.Eventually(t, fm.stream.connected, 5*time.Second, 10*time.Millisecond)
+	require.True(t, fm.stream.send(Result{CheckUUID: "tcp1", Timestamp: time.Now().Unix()}))
+	<-received
+
+	// the stream stays connected, the result goes to the HTTP sender
+	require.Eventually(t, func() bool {
+		fm.resultsLock.RLock()
+		defer fm.resultsLock.RUnlock()
+		return len(fm.results) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, fm.stream.connected())
+	fm.stream.lock.Lock()
+	assert.Empty(t, fm.stream.pending)
+	fm.stream.lock.Unlock()
+}
+
+func TestHubStreamInterrupt(t *testing.T) {
+	hub := NewMockHub("")
+	hubServer := httptest.NewServer(http.HandlerFunc(hub.indexHandler))
+	defer hubServer.Close()
+
+	received := make(chan streamMessage, 10)
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hubServer.URL
+	cfg.SenderInterval = 3600
+	cfg.HubStream.URL = helperStartSilentStreamHub(t, received)
+	fm := helperCreateFrontman(t, cfg)
+
+	go fm.stream.runContinuous()
+	senderDone := make(chan struct{})
+	go func() {
+		fm.sendResultsChanToHubQueue()
+		close(senderDone)
+	}()
+	require.Eventually(t, fm.stream.connected, 5*time.Second, 10*time.Millisecond)
+	require.True(t, fm.stream.send(Result{CheckUUID: "tcp1", Timestamp: time.Now().Unix()}))
+	<-received
+
+	// the final flush of the sender includes the results the stream hands back
+	close(fm.InterruptChan)
+	select {
+	case <-senderDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sender didn't stop")
+	}
+	require.Len(t, hub.Received(), 1)
+	assert.Equal(t, "tcp1", hub.Received()[0].CheckUUID)
+}
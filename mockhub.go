@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"sync"
 )
 
 type MockHub struct {
@@ -17,11 +18,20 @@ type MockHub struct {
 
 	// if set, responds with this status code on all requests. useful for testing 401 and such
 	ResponseStatusCode int
+
+	// encodings and compressions announced to frontman, see hub_encoding and hub_compression
+	AcceptPost     string
+	AcceptEncoding string
+
+	lock     sync.Mutex
+	received []Result
 }
 
 func NewMockHub(address string) *MockHub {
 	return &MockHub{
-		address: address,
+		address:        address,
+		AcceptPost:     "application/msgpack, application/cbor, application/json",
+		AcceptEncoding: "zstd, br, gzip",
 	}
 }
 
@@ -36,6 +46,12 @@ func (hub *MockHub) indexHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(hub.ResponseStatusCode)
 		return
 	}
+	if hub.AcceptPost != "" {
+		w.Header().Set("Accept-Post", hub.AcceptPost)
+	}
+	if hub.AcceptEncoding != "" {
+		w.Header().Set("Accept-Encoding", hub.AcceptEncoding)
+	}
 	switch r.Method {
 	case "GET":
 		hub.getHandler(w, r)
@@ -56,7 +72,26 @@ func (hub *MockHub) postHandler(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 
-	log.Println("MockHub: got post data", string(data))
+	contentType, contentEncoding := r.Header.Get("Content-Type"), r.Header.Get("Content-Encoding")
+	res, err := decodeResults(contentType, contentEncoding, data)
+	if err != nil {
+		log.Printf("MockHub: could not decode %s results with encoding '%s': %s", contentType, contentEncoding, err)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	hub.lock.Lock()
+	hub.received = append(hub.received, res.Results...)
+	hub.lock.Unlock()
+
+	log.Printf("MockHub: got %d %s results with encoding '%s' in %d bytes", len(res.Results), contentType, contentEncoding, len(data))
+}
+
+// Received returns the results posted so far
+func (hub *MockHub) Received() []Result {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	return append([]Result{}, hub.received...)
 }
 
 func (hub *MockHub) getHandler(w http.ResponseWriter, r *http.Request) {
@@ -2,6 +2,7 @@ package frontman
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -53,7 +54,7 @@ func (fm *Frontman) getCachedNodeFailure(node *Node) []byte {
 }
 
 // asking other nodes to try a failed check
-func (fm *Frontman) askNodes(check Check, res *Result) {
+func (fm *Frontman) askNodes(ctx context.Context, check Check, res *Result) {
 
 	var data []byte
 
@@ -95,11 +96,16 @@ func (fm *Frontman) askNodes(check Check, res *Result) {
 		req := &Input{WebChecks: []WebCheck{c}}
 		data, _ = json.Marshal(req)
 	}
+	timeout := time.Duration(fm.Config.Node.NodeTimeout) * time.Second
 	if c, ok := check.(SNMPCheck); ok {
 		uuid = c.UUID
 		checkType = "snmpCheck"
 		req := &Input{SNMPChecks: []SNMPCheck{c}}
 		data, _ = json.Marshal(req)
+		if c.Check.usesCounters() {
+			// the node polls twice to calculate deltas
+			timeout += snmpSamplingInterval
+		}
 	}
 
 	var nodeResults []string
@@ -128,7 +134,7 @@ func (fm *Frontman) askNodes(check Check, res *Result) {
 		logrus.Debugf("askNodes asking %s (%s)", node.URL, check.uniqueID())
 
 		client := &http.Client{
-			Timeout: time.Duration(fm.Config.Node.NodeTimeout) * time.Second,
+			Timeout: timeout,
 		}
 		if !node.VerifySSL {
 			client.Transport = &http.Transport{
@@ -137,11 +143,14 @@ func (fm *Frontman) askNodes(check Check, res *Result) {
 		}
 
 		fm.logForward(fmt.Sprintf("Forwarding check %s, type %s, msg '%s' to %s", uuid, checkType, msg, node.URL))
-		req, _ := http.NewRequest("POST", url.String(), bytes.NewBuffer(data))
+		req, _ := http.NewRequestWithContext(ctx, "POST", url.String(), bytes.NewBuffer(data))
 		req.SetBasicAuth(node.Username, node.Password)
 		req.Header.Set("Content-Type", "application/json")
 		resp, err := client.Do(req)
-		if err != nil {
+		if err != nil && ctx.Err() != nil {
+			// interrupted, the node didn't fail
+			return
+		} else if err != nil {
 			logrus.Debugf("askNodes failed: %s (%s)", err.Error(), check.uniqueID())
 			fm.markNodeFailure(&node, nil)
 		} else {
@@ -165,8 +174,10 @@ func (fm *Frontman) askNodes(check Check, res *Result) {
 
 	bestDuration := 999.
 
-	// select the fastest result, fall back to first result if we fail
-	resultID := 0
+	// select the fastest result, fall back to the first successful result for checks without durations
+	// like SNMP checks, or to the first result if all nodes failed
+	resultID := -1
+	firstSucceededID := -1
 	for currID, resp := range nodeResults {
 
 		var selected []interface{}
@@ -208,6 +219,9 @@ func (fm *Frontman) askNodes(check Check, res *Result) {
 				if success, ok := l2[successKey].(float64); ok {
 					if int(success) == 1 {
 						succeededNodes = append(succeededNodes, nodeName)
+						if firstSucceededID == -1 {
+							firstSucceededID = currID
+						}
 					} else {
 						failedNodeMessage[nodeName] = nodeMessage
 						failedNodes = append(failedNodes, nodeName)
@@ -238,6 +252,12 @@ func (fm *Frontman) askNodes(check Check, res *Result) {
 			}
 		}
 	}
+	if resultID == -1 {
+		resultID = firstSucceededID
+	}
+	if resultID == -1 {
+		resultID = 0
+	}
 
 	var fastestResult []Result
 	if err := json.Unmarshal([]byte(nodeResults[resultID]), &fastestResult); err != nil {
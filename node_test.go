@@ -1 +1,68 @@
 package frontman
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAskNodesSNMP(t *testing.T) {
+	agent := helperStartGetNextAgent(t, []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: "test switch"},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(1234)},
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: "switch-1"},
+	})
+	defer agent.Close()
+
+	nodeCfg := NewConfig()
+	nodeCfg.NodeName = "succeeding"
+	node := helperCreateFrontman(t, nodeCfg)
+	succeeding := httptest.NewServer(http.HandlerFunc(node.checkHandler))
+	defer succeeding.Close()
+
+	// SNMP results have no durations to pick the fastest node by
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"checkUuid":"snmp_oid","checkType":"snmpCheck","node":"failing","message":"get err: Request timeout","measurements":{"snmpCheck.oid.success":0}}]`))
+	}))
+	defer failing.Close()
+
+	cfg := NewConfig()
+	cfg.Nodes = map[string]Node{
+		"1": {URL: failing.URL},
+		"2": {URL: succeeding.URL},
+	}
+	fm := helperCreateFrontman(t, cfg)
+
+	check := SNMPCheck{
+		UUID: "snmp_oid",
+		Check: SNMPCheckData{
+			Connect:   "127.0.0.1",
+			Port:      uint16(agent.LocalAddr().(*net.UDPAddr).Port),
+			Timeout:   1,
+			Protocol:  "v2",
+			Community: "public",
+			Preset:    "oid",
+			Oid:       ".1.3.6.1.2.1.1.5.0",
+		},
+	}
+	res := Result{
+		CheckUUID:    "snmp_oid",
+		CheckType:    "snmpCheck",
+		Message:      "get err: Request timeout",
+		Measurements: map[string]interface{}{"snmpCheck.oid.success": 0},
+	}
+	fm.askNodes(context.Background(), check, &res)
+
+	assert.Equal(t, "succeeding", res.Node)
+	assert.Equal(t, 1., res.Measurements["snmpCheck.oid.success"])
+	assert.Contains(t, res.Message, "failing: get err: Request timeout")
+	// the failed node and the local measurement
+	require.Len(t, res.NodeMeasurements, 2)
+	assert.Equal(t, "failing", res.NodeMeasurements[0]["node"])
+}
@@ -1,6 +1,7 @@
 package frontman
 
 import (
+	"context"
 	"runtime"
 	"time"
 
@@ -30,7 +31,7 @@ func CheckIfRootlessICMPAvailable() bool {
 	return true
 }
 
-func (fm *Frontman) runPing(addr string) (m map[string]interface{}, err error) {
+func (fm *Frontman) runPing(ctx context.Context, addr string) (m map[string]interface{}, err error) {
 	prefix := "net.icmp.ping."
 	m = make(map[string]interface{})
 
@@ -43,10 +44,25 @@ func (fm *Frontman) runPing(addr string) (m map[string]interface{}, err error) {
 		pinger.SetPrivileged(true)
 	}
 
-	pinger.Timeout = secToDuration(fm.Config.ICMPTimeout)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	pinger.Timeout = time.Until(contextDeadline(ctx, secToDuration(fm.Config.ICMPTimeout)))
 	pinger.Count = 5
 
-	pinger.Run()
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		// the pinger panics closing its done channel if it finishes while being stopped
+		defer func() { _ = recover() }()
+		_ = pinger.Run()
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		stopPinger(pinger)
+		<-finished
+	}
 
 	var total time.Duration
 
@@ -72,3 +88,9 @@ func (fm *Frontman) runPing(addr string) (m map[string]interface{}, err error) {
 
 	return
 }
+
+// stopPinger stops the pinger, which closes its done channel unless it did already
+func stopPinger(pinger *ping.Pinger) {
+	defer func() { _ = recover() }()
+	pinger.Stop()
+}
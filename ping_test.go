@@ -1,7 +1,9 @@
 package frontman
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,5 +15,21 @@ func TestPing(t *testing.T) {
 	assert.Nil(t, err)
 	fm := helperCreateFrontman(t, cfg)
 
-	_, _ = fm.runPing("8.8.8.8")
+	_, _ = fm.runPing(context.Background(), "8.8.8.8")
+}
+
+func TestPingCancel(t *testing.T) {
+	cfg, err := HandleAllConfigSetup(DefaultCfgPath)
+	assert.Nil(t, err)
+	cfg.ICMPTimeout = 10
+	fm := helperCreateFrontman(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	started := time.Now()
+	_, _ = fm.runPing(ctx, "127.0.0.1")
+	assert.True(t, time.Since(started) < 2*time.Second, "ping took %v", time.Since(started))
 }
@@ -0,0 +1,500 @@
+// Package mib implements a minimal SMIv1/SMIv2 MIB parser.
+// It extracts object identifiers and the enumerations of INTEGER based syntaxes,
+// which is enough to translate between numeric and symbolic OIDs.
+package mib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Node is an object defined in a MIB module
+type Node struct {
+	Module string
+	Name   string
+	OID    string // numeric form with a leading dot, e.g. .1.3.6.1.2.1.2.2.1.8
+	Syntax string
+	Enums  map[int]string
+}
+
+// Store holds the objects of all loaded MIB modules
+type Store struct {
+	byOID    map[string]*Node
+	byName   map[string]*Node
+	byModule map[string]*Node // key is MODULE::name
+
+	// INTEGER enumerations of textual conventions and type assignments, keyed by name and MODULE::name
+	types map[string]map[int]string
+
+	// definitions waiting for their parent to be loaded
+	pending []*definition
+}
+
+type definition struct {
+	module string
+	name   string
+	parent string
+	subIDs []int
+	syntax string
+	enums  map[int]string
+}
+
+// macros which assign an OID to the defined object
+var oidMacros = map[string]bool{
+	"OBJECT-TYPE":        true,
+	"OBJECT-IDENTITY":    true,
+	"MODULE-IDENTITY":    true,
+	"NOTIFICATION-TYPE":  true,
+	"OBJECT-GROUP":       true,
+	"NOTIFICATION-GROUP": true,
+	"MODULE-COMPLIANCE":  true,
+	"AGENT-CAPABILITIES": true,
+}
+
+// well-known nodes of SNMPv2-SMI, so MIBs can be loaded without the SMI modules
+var builtinNodes = []struct {
+	name string
+	oid  string
+}{
+	{"ccitt", ".0"},
+	{"zeroDotZero", ".0.0"},
+	{"iso", ".1"},
+	{"org", ".1.3"},
+	{"dod", ".1.3.6"},
+	{"internet", ".1.3.6.1"},
+	{"directory", ".1.3.6.1.1"},
+	{"mgmt", ".1.3.6.1.2"},
+	{"mib-2", ".1.3.6.1.2.1"},
+	{"transmission", ".1.3.6.1.2.1.10"},
+	{"experimental", ".1.3.6.1.3"},
+	{"private", ".1.3.6.1.4"},
+	{"enterprises", ".1.3.6.1.4.1"},
+	{"security", ".1.3.6.1.5"},
+	{"snmpV2", ".1.3.6.1.6"},
+	{"snmpDomains", ".1.3.6.1.6.1"},
+	{"snmpProxys", ".1.3.6.1.6.2"},
+	{"snmpModules", ".1.3.6.1.6.3"},
+	{"joint-iso-ccitt", ".2"},
+}
+
+// NewStore returns a store containing only the well-known SMI nodes
+func NewStore() *Store {
+	s := &Store{
+		byOID:    make(map[string]*Node),
+		byName:   make(map[string]*Node),
+		byModule: make(map[string]*Node),
+		types:    make(map[string]map[int]string),
+	}
+	for _, b := range builtinNodes {
+		s.add(&Node{Module: "SNMPv2-SMI", Name: b.name, OID: b.oid})
+	}
+	return s
+}
+
+// Len returns the number of known objects
+func (s *Store) Len() int {
+	return len(s.byOID)
+}
+
+// LoadDir parses all files of the directory. Files which fail to parse are skipped entirely,
+// the first error is returned after all other files have been loaded
+func (s *Store) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if err := s.parseFile(filepath.Join(dir, f.Name())); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.resolve()
+
+	if firstErr == nil && len(s.pending) > 0 {
+		firstErr = fmt.Errorf("%d objects with unknown parent, e.g. %s::%s", len(s.pending), s.pending[0].module, s.pending[0].name)
+	}
+	return firstErr
+}
+
+// LoadFile parses a single MIB file
+func (s *Store) LoadFile(path string) error {
+	if err := s.parseFile(path); err != nil {
+		return err
+	}
+	s.resolve()
+	return nil
+}
+
+func (s *Store) parseFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := s.parse(data); err != nil {
+		return fmt.Errorf("%s: %s", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Resolve translates a symbolic name like IF-MIB::ifHCInOctets.3 or ifHCInOctets.3 to its numeric OID.
+// Numeric OIDs are returned with a leading dot
+func (s *Store) Resolve(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if isNumericOID(name) {
+		if !strings.HasPrefix(name, ".") {
+			name = "." + name
+		}
+		return name, nil
+	}
+
+	module := ""
+	if idx := strings.Index(name, "::"); idx != -1 {
+		module = name[0:idx]
+		name = name[idx+2:]
+	}
+	suffix := ""
+	if idx := strings.Index(name, "."); idx != -1 {
+		suffix = name[idx:]
+		name = name[0:idx]
+		if !isNumericOID(suffix) {
+			return "", fmt.Errorf("invalid index '%s'", suffix)
+		}
+	}
+
+	var node *Node
+	if module != "" {
+		node = s.byModule[module+"::"+name]
+	} else {
+		node = s.byName[name]
+	}
+	if node == nil {
+		if module != "" {
+			return "", fmt.Errorf("unknown MIB object %s::%s", module, name)
+		}
+		return "", fmt.Errorf("unknown MIB object %s", name)
+	}
+	return node.OID + suffix, nil
+}
+
+// Lookup returns the closest node defining the OID and the remaining index (e.g. ".3"), false if no node matches
+func (s *Store) Lookup(oid string) (*Node, string, bool) {
+	if !strings.HasPrefix(oid, ".") {
+		oid = "." + oid
+	}
+	for prefix := oid; prefix != ""; prefix = prefix[0:strings.LastIndex(prefix, ".")] {
+		if node, ok := s.byOID[prefix]; ok {
+			return node, oid[len(prefix):], true
+		}
+	}
+	return nil, "", false
+}
+
+// Name returns the symbolic form MODULE::name.index of the OID, false if no node matches
+func (s *Store) Name(oid string) (string, bool) {
+	node, suffix, ok := s.Lookup(oid)
+	if !ok {
+		return "", false
+	}
+	return node.Module + "::" + node.Name + suffix, true
+}
+
+func (s *Store) add(n *Node) {
+	if _, exists := s.byOID[n.OID]; !exists {
+		s.byOID[n.OID] = n
+	}
+	if _, exists := s.byName[n.Name]; !exists {
+		s.byName[n.Name] = n
+	}
+	s.byModule[n.Module+"::"+n.Name] = n
+}
+
+// resolve assigns OIDs to all pending definitions whose parent is known
+func (s *Store) resolve() {
+	for {
+		var unresolved []*definition
+		for _, def := range s.pending {
+			parentOID := ""
+			if def.parent != "" {
+				parent := s.byModule[def.module+"::"+def.parent]
+				if parent == nil {
+					parent = s.byName[def.parent]
+				}
+				if parent == nil {
+					unresolved = append(unresolved, def)
+					continue
+				}
+				parentOID = parent.OID
+			}
+
+			oid := parentOID
+			for _, id := range def.subIDs {
+				oid += "." + strconv.Itoa(id)
+			}
+			s.add(&Node{Module: def.module, Name: def.name, OID: oid, Syntax: def.syntax, Enums: def.enums})
+		}
+
+		progress := len(unresolved) < len(s.pending)
+		s.pending = unresolved
+		if !progress || len(unresolved) == 0 {
+			break
+		}
+	}
+
+	// objects using a textual convention inherit its enumerations
+	for _, n := range s.byOID {
+		if n.Enums != nil || n.Syntax == "" {
+			continue
+		}
+		if enums, ok := s.types[n.Module+"::"+n.Syntax]; ok {
+			n.Enums = enums
+		} else if enums, ok := s.types[n.Syntax]; ok {
+			n.Enums = enums
+		}
+	}
+}
+
+// parse adds the definitions of data to the store, nothing is added if the data fails to parse
+func (s *Store) parse(data []byte) error {
+	t := tokenize(data)
+	module := ""
+	var pending []*definition
+	types := make(map[string]map[int]string)
+
+	for i := 0; i < len(t); i++ {
+		switch {
+		case i+1 < len(t) && t[i+1] == "DEFINITIONS":
+			module = t[i]
+
+		case i+1 < len(t) && t[i+1] == "MACRO":
+			// macro definitions like OBJECT-TYPE in SNMPv2-SMI
+			for i < len(t) && t[i] != "END" {
+				i++
+			}
+
+		case i+4 < len(t) && t[i+1] == "OBJECT" && t[i+2] == "IDENTIFIER" && t[i+3] == "::=" && t[i+4] == "{":
+			if module == "" {
+				return fmt.Errorf("%s defined outside of a module", t[i])
+			}
+			def := &definition{module: module, name: t[i]}
+			end, err := parseOIDValue(t, i+4, def)
+			if err != nil {
+				return fmt.Errorf("%s: %s", def.name, err)
+			}
+			pending = append(pending, def)
+			i = end
+
+		case i+1 < len(t) && oidMacros[t[i+1]] && isLower(t[i]):
+			if module == "" {
+				return fmt.Errorf("%s defined outside of a module", t[i])
+			}
+			def := &definition{module: module, name: t[i]}
+			j := i + 2
+			for ; j < len(t) && t[j] != "::="; j++ {
+				if t[j] == "SYNTAX" && t[i+1] == "OBJECT-TYPE" && def.syntax == "" {
+					def.syntax, def.enums, j = parseSyntax(t, j+1)
+					j--
+				}
+			}
+			if j+1 >= len(t) || t[j+1] != "{" {
+				return fmt.Errorf("%s: missing OID value", def.name)
+			}
+			end, err := parseOIDValue(t, j+1, def)
+			if err != nil {
+				return fmt.Errorf("%s: %s", def.name, err)
+			}
+			pending = append(pending, def)
+			i = end
+
+		case i+2 < len(t) && t[i+1] == "::=" && isUpper(t[i]):
+			// type assignment, only the enumerations of INTEGER based types are kept
+			j := i + 2
+			if t[j] == "TEXTUAL-CONVENTION" {
+				for j < len(t) && t[j] != "SYNTAX" {
+					j++
+				}
+				j++
+			}
+			_, enums, next := parseSyntax(t, j)
+			if enums != nil {
+				types[module+"::"+t[i]] = enums
+				if _, exists := types[t[i]]; !exists {
+					types[t[i]] = enums
+				}
+			}
+			i = next - 1
+		}
+	}
+
+	s.pending = append(s.pending, pending...)
+	for name, enums := range types {
+		if _, exists := s.types[name]; !exists || strings.Contains(name, "::") {
+			s.types[name] = enums
+		}
+	}
+	return nil
+}
+
+// parseSyntax reads a SYNTAX clause starting at t[j] and returns the position after it
+func parseSyntax(t []string, j int) (syntax string, enums map[int]string, next int) {
+	if j >= len(t) {
+		return "", nil, j
+	}
+	syntax = t[j]
+	j++
+	switch syntax {
+	case "OCTET", "OBJECT":
+		// OCTET STRING, OBJECT IDENTIFIER
+		j++
+	case "INTEGER", "Integer32", "BITS":
+		if j < len(t) && t[j] == "{" {
+			enums, j = parseEnums(t, j)
+		}
+	}
+	return syntax, enums, j
+}
+
+// parseEnums reads a list like { up(1), down(2) } starting at the opening brace
+func parseEnums(t []string, j int) (map[int]string, int) {
+	enums := make(map[int]string)
+	for j++; j < len(t) && t[j] != "}"; j++ {
+		if j+3 < len(t) && t[j+1] == "(" && t[j+3] == ")" {
+			if v, err := strconv.Atoi(t[j+2]); err == nil {
+				enums[v] = t[j]
+			}
+			j += 3
+		}
+	}
+	return enums, j + 1
+}
+
+// parseOIDValue reads a value like { ifEntry 8 } or { iso org(3) dod(6) 1 } starting at the opening brace
+// and returns the position of the closing brace
+func parseOIDValue(t []string, j int, def *definition) (int, error) {
+	first := true
+	for j++; j < len(t) && t[j] != "}"; j++ {
+		tok := t[j]
+		if j+3 < len(t) && t[j+1] == "(" && t[j+3] == ")" {
+			// named number, e.g. org(3)
+			tok = t[j+2]
+			j += 3
+		} else if first && !isNumericOID(tok) {
+			def.parent = tok
+			first = false
+			continue
+		}
+
+		id, err := strconv.Atoi(tok)
+		if err != nil {
+			return j, fmt.Errorf("invalid sub-identifier '%s'", tok)
+		}
+		def.subIDs = append(def.subIDs, id)
+		first = false
+	}
+	if j >= len(t) {
+		return j, fmt.Errorf("unterminated OID value")
+	}
+	if def.parent == "" && len(def.subIDs) == 0 {
+		return j, fmt.Errorf("empty OID value")
+	}
+	return j, nil
+}
+
+// tokenize splits a MIB into identifiers, numbers, quoted strings and symbols; comments are dropped
+func tokenize(data []byte) []string {
+	var tokens []string
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f':
+			i++
+
+		case c == '-' && i+1 < len(data) && data[i+1] == '-':
+			// comments end at the line end or at the next "--"
+			i += 2
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				if data[i] == '-' && i+1 < len(data) && data[i+1] == '-' {
+					i += 2
+					break
+				}
+				i++
+			}
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(data) && data[j] != c {
+				j++
+			}
+			j++
+			// binary and hex strings like '0A'H
+			if c == '\'' && j < len(data) && (data[j] == 'H' || data[j] == 'h' || data[j] == 'B' || data[j] == 'b') {
+				j++
+			}
+			if j > len(data) {
+				j = len(data)
+			}
+			tokens = append(tokens, string(data[i:j]))
+			i = j
+
+		case c == ':' && i+2 < len(data) && data[i+1] == ':' && data[i+2] == '=':
+			tokens = append(tokens, "::=")
+			i += 3
+
+		case c == '.' && i+1 < len(data) && data[i+1] == '.':
+			tokens = append(tokens, "..")
+			i += 2
+
+		case isIdentChar(c):
+			j := i
+			for j < len(data) && isIdentChar(data[j]) && !(data[j] == '-' && j+1 < len(data) && data[j+1] == '-') {
+				j++
+			}
+			if j == i {
+				// a single '-' followed by a comment
+				j++
+			}
+			tokens = append(tokens, string(data[i:j]))
+			i = j
+
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+func isLower(s string) bool {
+	return s != "" && s[0] >= 'a' && s[0] <= 'z'
+}
+
+func isUpper(s string) bool {
+	return s != "" && s[0] >= 'A' && s[0] <= 'Z'
+}
+
+func isNumericOID(s string) bool {
+	s = strings.TrimPrefix(s, ".")
+	if s == "" {
+		return false
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "" {
+			return false
+		}
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
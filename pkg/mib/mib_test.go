@@ -0,0 +1,217 @@
+package mib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIfMIB = `
+TEST-IF-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Counter64, mib-2 FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION                          FROM SNMPv2-TC;
+
+testIfMIB MODULE-IDENTITY
+    LAST-UPDATED "200006140000Z"
+    ORGANIZATION "IETF"
+    CONTACT-INFO "-- not a comment --"
+    DESCRIPTION  "The MIB module to test the parser."
+    ::= { mib-2 31 }
+
+-- a comment with a fake definition: fake OBJECT IDENTIFIER ::= { mib-2 99 }
+TestStatus ::= TEXTUAL-CONVENTION
+    STATUS       current
+    DESCRIPTION  "Enumerated status"
+    SYNTAX       INTEGER { up(1), down(2), testing(3) }
+
+interfaces   OBJECT IDENTIFIER ::= { mib-2 2 }
+ifTable      OBJECT IDENTIFIER ::= { interfaces 2 }
+ifEntry      OBJECT IDENTIFIER ::= { ifTable 1 }
+
+ifAdminStatus OBJECT-TYPE
+    SYNTAX      TestStatus
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "The desired state of the interface."
+    ::= { ifEntry 7 }
+
+ifOperStatus OBJECT-TYPE
+    SYNTAX      INTEGER {
+                    up(1), -- ready to pass packets
+                    down(2),
+                    lowerLayerDown(7)
+                }
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The current operational state of the interface."
+    ::= { ifEntry 8 }
+
+ifHCInOctets OBJECT-TYPE
+    SYNTAX      Counter64
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The total number of octets received."
+    ::= { testIfMIB 1 1 1 6 }
+
+END
+`
+
+func TestParse(t *testing.T) {
+	s := NewStore()
+	require.Nil(t, s.parse([]byte(testIfMIB)))
+	s.resolve()
+	assert.Empty(t, s.pending)
+
+	tests := []struct {
+		name string
+		oid  string
+	}{
+		{"testIfMIB", ".1.3.6.1.2.1.31"},
+		{"interfaces", ".1.3.6.1.2.1.2"},
+		{"ifEntry", ".1.3.6.1.2.1.2.2.1"},
+		{"ifOperStatus", ".1.3.6.1.2.1.2.2.1.8"},
+		{"TEST-IF-MIB::ifAdminStatus", ".1.3.6.1.2.1.2.2.1.7"},
+		{"TEST-IF-MIB::ifHCInOctets.12", ".1.3.6.1.2.1.31.1.1.1.6.12"},
+		{"1.3.6.1.2.1.1.3.0", ".1.3.6.1.2.1.1.3.0"},
+		{"enterprises", ".1.3.6.1.4.1"},
+	}
+	for _, test := range tests {
+		oid, err := s.Resolve(test.name)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.oid, oid, test.name)
+	}
+
+	_, err := s.Resolve("fake")
+	assert.EqualError(t, err, "unknown MIB object fake")
+	_, err = s.Resolve("IF-MIB::ifOperStatus")
+	assert.EqualError(t, err, "unknown MIB object IF-MIB::ifOperStatus")
+	_, err = s.Resolve("ifOperStatus.x")
+	assert.EqualError(t, err, "invalid index '.x'")
+
+	node, suffix, ok := s.Lookup("1.3.6.1.2.1.2.2.1.8.3")
+	require.True(t, ok)
+	assert.Equal(t, "ifOperStatus", node.Name)
+	assert.Equal(t, ".3", suffix)
+	assert.Equal(t, map[int]string{1: "up", 2: "down", 7: "lowerLayerDown"}, node.Enums)
+
+	// enumerations of textual conventions are inherited
+	node, _, ok = s.Lookup(".1.3.6.1.2.1.2.2.1.7")
+	require.True(t, ok)
+	assert.Equal(t, "TestStatus", node.Syntax)
+	assert.Equal(t, "testing", node.Enums[3])
+
+	name, ok := s.Name(".1.3.6.1.2.1.31.1.1.1.6.2")
+	assert.True(t, ok)
+	assert.Equal(t, "TEST-IF-MIB::ifHCInOctets.2", name)
+	_, ok = s.Name(".2.5")
+	assert.True(t, ok)
+	_, ok = s.Name(".3")
+	assert.False(t, ok)
+}
+
+func TestParseNamedNumbers(t *testing.T) {
+	s := NewStore()
+	require.Nil(t, s.parse([]byte(`
+TEST-ROOT-MIB DEFINITIONS ::= BEGIN
+testRoot OBJECT IDENTIFIER ::= { iso org(3) dod(6) 1 4 1 99999 }
+testBits OBJECT-TYPE
+    SYNTAX      BITS { a(0), b(1) }
+    ::= { testRoot 1 }
+END
+`)))
+	s.resolve()
+
+	oid, err := s.Resolve("testRoot")
+	require.Nil(t, err)
+	assert.Equal(t, ".1.3.6.1.4.1.99999", oid)
+	node, _, _ := s.Lookup(".1.3.6.1.4.1.99999.1")
+	assert.Equal(t, "b", node.Enums[1])
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"foo OBJECT IDENTIFIER ::= { iso 1 }":                                             "foo defined outside of a module",
+		"M DEFINITIONS ::= BEGIN foo OBJECT IDENTIFIER ::= { iso x }":                     "foo: invalid sub-identifier 'x'",
+		"M DEFINITIONS ::= BEGIN foo OBJECT IDENTIFIER ::= { iso 1":                       "foo: unterminated OID value",
+		"M DEFINITIONS ::= BEGIN foo OBJECT IDENTIFIER ::= { }":                           "foo: empty OID value",
+		"M DEFINITIONS ::= BEGIN foo OBJECT-TYPE SYNTAX INTEGER ::= 5 END":                "foo: missing OID value",
+		"M DEFINITIONS ::= BEGIN foo OBJECT-TYPE SYNTAX Integer32 STATUS current END":     "foo: missing OID value",
+		"M DEFINITIONS ::= BEGIN bar OBJECT IDENTIFIER ::= { iso 9 } foo MODULE-IDENTITY": "foo: missing OID value",
+	}
+	for data, expected := range tests {
+		s := NewStore()
+		assert.EqualError(t, s.parse([]byte(data)), expected, data)
+		// nothing of a broken file is kept
+		assert.Empty(t, s.pending, data)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// loaded before the module defining the parent
+		"A-MIB.txt": `A-MIB DEFINITIONS ::= BEGIN
+aObject OBJECT IDENTIFIER ::= { testIfMIB 100 }
+END`,
+		"TEST-IF-MIB.txt": testIfMIB,
+		// fails after some valid definitions
+		"BROKEN-MIB.txt": `BROKEN-MIB DEFINITIONS ::= BEGIN
+BrokenStatus ::= INTEGER { broken(1) }
+brokenRoot OBJECT IDENTIFIER ::= { enterprises 4242 }
+brokenObject OBJECT-TYPE
+    SYNTAX      BrokenStatus
+    ::= { brokenRoot x }
+END`,
+		".hidden": "garbage",
+	}
+	for name, data := range files {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600))
+	}
+
+	s := NewStore()
+	builtin := s.Len()
+	err := s.LoadDir(dir)
+	assert.EqualError(t, err, "BROKEN-MIB.txt: brokenObject: invalid sub-identifier 'x'")
+
+	oid, err := s.Resolve("A-MIB::aObject")
+	assert.Nil(t, err)
+	assert.Equal(t, ".1.3.6.1.2.1.31.100", oid)
+	assert.Equal(t, builtin+8, s.Len())
+
+	_, err = s.Resolve("brokenRoot")
+	assert.NotNil(t, err)
+	assert.NotContains(t, s.types, "BrokenStatus")
+	assert.NotContains(t, s.types, "BROKEN-MIB::BrokenStatus")
+
+	assert.NotNil(t, s.LoadDir(filepath.Join(dir, "missing")))
+}
+
+func TestLoadDirUnknownParent(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ORPHAN-MIB"), []byte(`ORPHAN-MIB DEFINITIONS ::= BEGIN
+orphan OBJECT IDENTIFIER ::= { unknownParent 1 }
+END`), 0600))
+
+	s := NewStore()
+	assert.EqualError(t, s.LoadDir(dir), "1 objects with unknown parent, e.g. ORPHAN-MIB::orphan")
+
+	// the definition is resolved once the parent is loaded
+	parent := filepath.Join(t.TempDir(), "PARENT-MIB")
+	require.Nil(t, ioutil.WriteFile(parent, []byte(`PARENT-MIB DEFINITIONS ::= BEGIN
+unknownParent OBJECT IDENTIFIER ::= { enterprises 7 }
+END`), 0600))
+	require.Nil(t, s.LoadFile(parent))
+	oid, err := s.Resolve("orphan")
+	assert.Nil(t, err)
+	assert.Equal(t, ".1.3.6.1.4.1.7.1", oid)
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize([]byte("a-b ::= { x(1) } -- comment -- c\r\n-- rest of line\n'0A'H \"quoted -- text\" 1..10 d-"))
+	assert.Equal(t, []string{"a-b", "::=", "{", "x", "(", "1", ")", "}", "c", "'0A'H", "\"quoted -- text\"", "1", "..", "10", "d-"}, tokens)
+}
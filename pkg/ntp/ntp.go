@@ -0,0 +1,135 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+/* NTP packet structure (RFC 5905, section 7.3):
+struct ntp_packet {
+	uint8_t  li_vn_mode;      // leap indicator (2 bits), version (3 bits), mode (3 bits)
+	uint8_t  stratum;         // stratum level of the local clock
+	uint8_t  poll;            // maximum interval between successive messages
+	uint8_t  precision;       // precision of the local clock
+	uint32_t rootDelay;       // total round trip delay time
+	uint32_t rootDispersion;  // max error allowed from primary clock source
+	uint32_t refId;           // reference clock identifier
+	uint64_t refTimestamp;    // reference time-stamp
+	uint64_t origTimestamp;   // originate time-stamp
+	uint64_t rxTimestamp;     // receive time-stamp
+	uint64_t txTimestamp;     // transmit time-stamp
+};
+*/
+
+const packetLen = 48
+
+const (
+	version    = 4
+	modeClient = 3
+	modeServer = 4
+
+	// LeapNotSynchronized is the leap indicator value of an unsynchronized clock
+	LeapNotSynchronized = 3
+	// StratumUnsynchronized is the stratum reported by an unsynchronized server
+	StratumUnsynchronized = 16
+)
+
+// seconds between the NTP epoch (1900) and the unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// Response holds the values decoded from a server reply
+type Response struct {
+	Leap        uint8
+	Stratum     uint8
+	ReferenceID string
+
+	// Offset is the estimated offset of the local clock relative to the server clock
+	Offset time.Duration
+	// RTT is the round-trip delay to the server excluding its processing time
+	RTT time.Duration
+}
+
+// GetRequestPacket returns a client request carrying t as transmit timestamp.
+// The server copies it to the originate timestamp of its reply
+func GetRequestPacket(t time.Time) []byte {
+	packet := make([]byte, packetLen)
+	packet[0] = version<<3 | modeClient
+	binary.BigEndian.PutUint64(packet[40:], toNTPTime(t))
+	return packet
+}
+
+// ParseResponse decodes a server reply to a request sent at sentAt and received at receivedAt
+func ParseResponse(packet []byte, sentAt, receivedAt time.Time) (*Response, error) {
+	if len(packet) < packetLen {
+		return nil, fmt.Errorf("response too short: %d bytes", len(packet))
+	}
+
+	mode := packet[0] & 0x07
+	if mode != modeServer {
+		return nil, fmt.Errorf("unexpected mode %d in response", mode)
+	}
+
+	if binary.BigEndian.Uint64(packet[24:]) != toNTPTime(sentAt) {
+		return nil, errors.New("originate timestamp doesn't match the request")
+	}
+
+	r := &Response{
+		Leap:    packet[0] >> 6,
+		Stratum: packet[1],
+	}
+
+	if r.Stratum == 0 {
+		// kiss-o'-death packet, reference ID holds the ASCII kiss code
+		return r, fmt.Errorf("server sent kiss code '%s'", string(packet[12:16]))
+	}
+	if r.Stratum == 1 {
+		// primary server, reference ID is a left justified ASCII string
+		r.ReferenceID = string(trimNull(packet[12:16]))
+	} else {
+		r.ReferenceID = net.IP(packet[12:16]).String()
+	}
+
+	t1 := sentAt
+	t2 := fromNTPTime(binary.BigEndian.Uint64(packet[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(packet[40:]))
+	t4 := receivedAt
+
+	r.Offset = (t2.Sub(t1) + t3.Sub(t4)) / 2
+	r.RTT = t4.Sub(t1) - t3.Sub(t2)
+	if r.RTT < 0 {
+		r.RTT = 0
+	}
+
+	return r, nil
+}
+
+// IsSynchronized returns false if the server reports that its clock is not synchronized
+func (r *Response) IsSynchronized() bool {
+	return r.Leap != LeapNotSynchronized && r.Stratum < StratumUnsynchronized
+}
+
+func toNTPTime(t time.Time) uint64 {
+	nsec := uint64(t.Sub(time.Unix(-ntpEpochOffset, 0)))
+	sec := nsec / 1e9
+	frac := (nsec % 1e9) << 32 / 1e9
+	return sec<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	sec := int64(v >> 32)
+	frac := int64(v & 0xffffffff)
+	nsec := frac * 1e9 >> 32
+	return time.Unix(sec-ntpEpochOffset, nsec)
+}
+
+func trimNull(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,191 @@
+package radius
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/* RADIUS packet structure (RFC 2865, section 3):
+struct radius_packet {
+	uint8_t  code;           // packet type
+	uint8_t  identifier;     // matches requests and replies
+	uint16_t length;         // length of the whole packet
+	uint8_t  authenticator[16];
+	uint8_t  attributes[0];  // type (1 byte), length (1 byte), value
+};
+*/
+
+const (
+	headerLen        = 20
+	authenticatorLen = 16
+	maxPacketLen     = 4096
+	maxAttributeLen  = 253
+)
+
+const (
+	CodeAccessRequest   = 1
+	CodeAccessAccept    = 2
+	CodeAccessReject    = 3
+	CodeAccessChallenge = 11
+)
+
+const (
+	attrUserName             = 1
+	attrUserPassword         = 2
+	attrReplyMessage         = 18
+	attrNASIdentifier        = 32
+	attrMessageAuthenticator = 80
+)
+
+// CodeName returns the name of a RADIUS packet code
+func CodeName(code byte) string {
+	switch code {
+	case CodeAccessRequest:
+		return "Access-Request"
+	case CodeAccessAccept:
+		return "Access-Accept"
+	case CodeAccessReject:
+		return "Access-Reject"
+	case CodeAccessChallenge:
+		return "Access-Challenge"
+	}
+	return fmt.Sprintf("Code-%d", code)
+}
+
+// Request is an Access-Request that keeps the values needed to verify the reply
+type Request struct {
+	Identifier    byte
+	Authenticator []byte
+	secret        []byte
+}
+
+// Response holds the values decoded from a server reply
+type Response struct {
+	Code         byte
+	ReplyMessage string
+}
+
+// NewAccessRequest returns an Access-Request packet for the given PAP credentials
+func NewAccessRequest(secret, username, password, nasIdentifier string) (*Request, []byte, error) {
+	if secret == "" {
+		return nil, nil, errors.New("shared secret is empty")
+	}
+	if len(username) > maxAttributeLen || len(nasIdentifier) > maxAttributeLen {
+		return nil, nil, fmt.Errorf("attribute values must not exceed %d characters", maxAttributeLen)
+	}
+	if len(password) > 128 {
+		return nil, nil, errors.New("password exceeds 128 characters")
+	}
+
+	r := &Request{
+		Authenticator: make([]byte, authenticatorLen),
+		secret:        []byte(secret),
+	}
+	id := make([]byte, 1)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+	r.Identifier = id[0]
+	if _, err := rand.Read(r.Authenticator); err != nil {
+		return nil, nil, err
+	}
+
+	var attrs []byte
+	attrs = appendAttribute(attrs, attrUserName, []byte(username))
+	attrs = appendAttribute(attrs, attrUserPassword, r.hidePassword([]byte(password)))
+	if nasIdentifier != "" {
+		attrs = appendAttribute(attrs, attrNASIdentifier, []byte(nasIdentifier))
+	}
+
+	// Message-Authenticator is calculated with its own value zeroed (RFC 3579, section 3.2)
+	attrs = appendAttribute(attrs, attrMessageAuthenticator, make([]byte, md5.Size))
+
+	packet := make([]byte, headerLen, headerLen+len(attrs))
+	packet[0] = CodeAccessRequest
+	packet[1] = r.Identifier
+	binary.BigEndian.PutUint16(packet[2:], uint16(headerLen+len(attrs)))
+	copy(packet[4:], r.Authenticator)
+	packet = append(packet, attrs...)
+
+	mac := hmac.New(md5.New, r.secret)
+	mac.Write(packet)
+	copy(packet[len(packet)-md5.Size:], mac.Sum(nil))
+
+	return r, packet, nil
+}
+
+// ParseResponse decodes a reply and verifies that it matches the request and the shared secret
+func (r *Request) ParseResponse(packet []byte) (*Response, error) {
+	if len(packet) < headerLen {
+		return nil, fmt.Errorf("response too short: %d bytes", len(packet))
+	}
+	length := int(binary.BigEndian.Uint16(packet[2:]))
+	if length < headerLen || length > len(packet) || length > maxPacketLen {
+		return nil, fmt.Errorf("invalid response length %d", length)
+	}
+	packet = packet[0:length]
+
+	if packet[1] != r.Identifier {
+		return nil, fmt.Errorf("response identifier %d doesn't match request %d", packet[1], r.Identifier)
+	}
+
+	// ResponseAuth = MD5(Code+ID+Length+RequestAuth+Attributes+Secret)
+	hash := md5.New()
+	hash.Write(packet[0:4])
+	hash.Write(r.Authenticator)
+	hash.Write(packet[headerLen:])
+	hash.Write(r.secret)
+	if !hmac.Equal(hash.Sum(nil), packet[4:headerLen]) {
+		return nil, errors.New("invalid response authenticator, possibly wrong shared secret")
+	}
+
+	resp := &Response{Code: packet[0]}
+
+	attrs := packet[headerLen:]
+	for len(attrs) >= 2 {
+		attrLen := int(attrs[1])
+		if attrLen < 2 || attrLen > len(attrs) {
+			return nil, errors.New("malformed attribute in response")
+		}
+		if attrs[0] == attrReplyMessage {
+			resp.ReplyMessage += string(attrs[2:attrLen])
+		}
+		attrs = attrs[attrLen:]
+	}
+
+	return resp, nil
+}
+
+// hidePassword encrypts the User-Password attribute as described in RFC 2865, section 5.2
+func (r *Request) hidePassword(password []byte) []byte {
+	padded := len(password)
+	if padded == 0 || padded%16 != 0 {
+		padded += 16 - padded%16
+	}
+	result := make([]byte, padded)
+	copy(result, password)
+
+	last := r.Authenticator
+	for i := 0; i < padded; i += 16 {
+		hash := md5.New()
+		hash.Write(r.secret)
+		hash.Write(last)
+		b := hash.Sum(nil)
+		for j := 0; j < 16; j++ {
+			result[i+j] ^= b[j]
+		}
+		last = result[i : i+16]
+	}
+
+	return result
+}
+
+// appendAttribute appends an attribute, value must not exceed maxAttributeLen bytes
+func appendAttribute(attrs []byte, typ byte, value []byte) []byte {
+	attrs = append(attrs, typ, byte(len(value)+2))
+	return append(attrs, value...)
+}
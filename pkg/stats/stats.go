@@ -10,6 +10,10 @@ type FrontmanStats struct {
 	ChecksPerformedTotal  uint64
 	ChecksFetchedFromHub  uint64
 	CheckResultsSentToHub uint64
+	// results not sent because nothing changed, see change_only
+	CheckResultsSuppressed uint64
+	// checks not run because of check_policy
+	ChecksDenied uint64
 
 	HubErrorsTotal        uint64
 	HubLastErrorMessage   string
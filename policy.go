@@ -0,0 +1,308 @@
+package frontman
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// check types of the check policy
+const (
+	policyTypeWeb  = "web"
+	policyTypeSNMP = "snmp"
+)
+
+// checkPolicy limits the targets and types of the checks frontman runs, see Config.CheckPolicy
+type checkPolicy struct {
+	allowHosts, denyHosts hostRules
+	allowPorts, denyPorts []portRange
+	allowTypes, denyTypes []string
+}
+
+type hostRules struct {
+	names []string // lower case, "*." prefix matches subdomains
+	nets  []*net.IPNet
+}
+
+type portRange struct {
+	from, to int
+}
+
+// errCheckDenied is returned for checks the policy doesn't allow
+type errCheckDenied string
+
+func (e errCheckDenied) Error() string {
+	return "denied by check_policy: " + string(e)
+}
+
+// newCheckPolicy returns nil if no rules are configured
+func newCheckPolicy(cfg *CheckPolicyConfig) (*checkPolicy, error) {
+	if len(cfg.AllowHosts)+len(cfg.DenyHosts)+len(cfg.AllowPorts)+len(cfg.DenyPorts)+len(cfg.AllowCheckTypes)+len(cfg.DenyCheckTypes) == 0 {
+		return nil, nil
+	}
+
+	p := &checkPolicy{}
+	var err error
+	if p.allowHosts, err = parseHostRules(cfg.AllowHosts); err != nil {
+		return nil, fmt.Errorf("check_policy.allow_hosts: %s", err)
+	}
+	if p.denyHosts, err = parseHostRules(cfg.DenyHosts); err != nil {
+		return nil, fmt.Errorf("check_policy.deny_hosts: %s", err)
+	}
+	if p.allowPorts, err = parsePortRanges(cfg.AllowPorts); err != nil {
+		return nil, fmt.Errorf("check_policy.allow_ports: %s", err)
+	}
+	if p.denyPorts, err = parsePortRanges(cfg.DenyPorts); err != nil {
+		return nil, fmt.Errorf("check_policy.deny_ports: %s", err)
+	}
+	for _, t := range cfg.AllowCheckTypes {
+		p.allowTypes = append(p.allowTypes, strings.ToLower(strings.TrimSpace(t)))
+	}
+	for _, t := range cfg.DenyCheckTypes {
+		p.denyTypes = append(p.denyTypes, strings.ToLower(strings.TrimSpace(t)))
+	}
+	return p, nil
+}
+
+func parseHostRules(list []string) (hostRules, error) {
+	var rules hostRules
+	for _, s := range list {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if strings.Contains(s, "/") {
+			_, ipNet, err := net.ParseCIDR(s)
+			if err != nil {
+				return rules, err
+			}
+			rules.nets = append(rules.nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			rules.nets = append(rules.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if s == "" || strings.Contains(s[1:], "*") || (s[0] == '*' && !strings.HasPrefix(s, "*.")) {
+			return rules, fmt.Errorf("invalid host %q", s)
+		}
+		rules.names = append(rules.names, strings.TrimSuffix(s, "."))
+	}
+	return rules, nil
+}
+
+func parsePortRanges(list []string) ([]portRange, error) {
+	var ranges []portRange
+	for _, s := range list {
+		from, to := strings.TrimSpace(s), ""
+		if i := strings.Index(from, "-"); i >= 0 {
+			from, to = strings.TrimSpace(from[:i]), strings.TrimSpace(from[i+1:])
+		} else {
+			to = from
+		}
+		a, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", s)
+		}
+		b, err := strconv.Atoi(to)
+		if err != nil || a < 0 || b > 65535 || a > b {
+			return nil, fmt.Errorf("invalid port %q", s)
+		}
+		ranges = append(ranges, portRange{a, b})
+	}
+	return ranges, nil
+}
+
+func (r hostRules) empty() bool {
+	return len(r.names) == 0 && len(r.nets) == 0
+}
+
+func (r hostRules) matchesName(host string) bool {
+	for _, name := range r.names {
+		if host == name || (strings.HasPrefix(name, "*.") && strings.HasSuffix(host, name[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r hostRules) matchesIP(ip net.IP) bool {
+	for _, n := range r.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny returns true if the host name or one of the addresses matches a rule
+func (r hostRules) matchesAny(host string, ips []net.IP) bool {
+	if r.matchesName(host) {
+		return true
+	}
+	for _, ip := range ips {
+		if r.matchesIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAll returns true if the host name or all of the addresses match a rule
+func (r hostRules) matchesAll(host string, ips []net.IP) bool {
+	if r.matchesName(host) {
+		return true
+	}
+	for _, ip := range ips {
+		if !r.matchesIP(ip) {
+			return false
+		}
+	}
+	return len(ips) > 0
+}
+
+func portInRanges(port int, ranges []portRange) bool {
+	for _, r := range ranges {
+		if port >= r.from && port <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the check type, host and port the check connects to, port is 0 if none applies
+func checkTarget(check Check) (checkType string, host string, port int) {
+	switch c := check.(type) {
+	case ServiceCheck:
+		p, _ := c.Check.Port.Int64()
+		if p <= 0 {
+			p = int64(defaultPortByService[strings.ToLower(c.Check.Service)])
+		}
+		return strings.ToLower(c.Check.Protocol), c.Check.Connect, int(p)
+	case WebCheck:
+		u, err := url.Parse(c.Check.URL)
+		if err != nil {
+			return policyTypeWeb, "", 0
+		}
+		return policyTypeWeb, u.Hostname(), urlPort(u)
+	case SNMPCheck:
+		p := int(c.Check.Port)
+		if p == 0 {
+			p = 161
+		}
+		return policyTypeSNMP, c.Check.Connect, p
+	}
+	return "", "", 0
+}
+
+func urlPort(u *url.URL) int {
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if strings.ToLower(u.Scheme) == "https" {
+		return 443
+	}
+	return 80
+}
+
+// allow returns an errCheckDenied if the policy doesn't allow the check, nil for a nil policy
+func (p *checkPolicy) allow(ctx context.Context, check Check) error {
+	if p == nil {
+		return nil
+	}
+	checkType, host, port := checkTarget(check)
+	if err := p.allowType(checkType); err != nil {
+		return err
+	}
+	return p.allowTarget(ctx, host, port)
+}
+
+// allowURL checks the target of a web request, e.g. of a redirect
+func (p *checkPolicy) allowURL(ctx context.Context, u *url.URL) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.allowType(policyTypeWeb); err != nil {
+		return err
+	}
+	return p.allowTarget(ctx, u.Hostname(), urlPort(u))
+}
+
+func (p *checkPolicy) allowType(checkType string) error {
+	if contains(p.denyTypes, checkType) || (len(p.allowTypes) > 0 && !contains(p.allowTypes, checkType)) {
+		return errCheckDenied("check type " + checkType)
+	}
+	return nil
+}
+
+func (p *checkPolicy) allowTarget(ctx context.Context, host string, port int) error {
+	if port > 0 {
+		if portInRanges(port, p.denyPorts) {
+			return errCheckDenied(fmt.Sprintf("port %d", port))
+		}
+		if len(p.allowPorts) > 0 && !portInRanges(port, p.allowPorts) {
+			return errCheckDenied(fmt.Sprintf("port %d", port))
+		}
+	}
+
+	if p.allowHosts.empty() && p.denyHosts.empty() {
+		return nil
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return errCheckDenied("missing host")
+	}
+
+	// CIDR rules apply to the addresses a name resolves to
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if len(p.allowHosts.nets)+len(p.denyHosts.nets) > 0 {
+		// an unresolvable host isn't allowed by address, the check would fail anyway
+		addrs, _ := net.DefaultResolver.LookupIPAddr(ctx, host)
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	if p.denyHosts.matchesAny(host, ips) {
+		return errCheckDenied("host " + host)
+	}
+	if !p.allowHosts.empty() && !p.allowHosts.matchesAll(host, ips) {
+		return errCheckDenied("host " + host)
+	}
+	return nil
+}
+
+// dialControl returns a net.Dialer Control function applying the CIDR rules to the address a connection to host is made to,
+// so a name resolving to another address than when allow checked it can't bypass them. nil for a nil policy or without CIDR rules
+func (p *checkPolicy) dialControl(host string) func(network, address string, c syscall.RawConn) error {
+	if p == nil || len(p.allowHosts.nets)+len(p.denyHosts.nets) == 0 {
+		return nil
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	return func(network, address string, c syscall.RawConn) error {
+		addr, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if i := strings.IndexByte(addr, '%'); i >= 0 {
+			// zone of a link-local IPv6 address
+			addr = addr[:i]
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil || p.denyHosts.matchesIP(ip) {
+			return errCheckDenied("address " + addr)
+		}
+		if !p.allowHosts.empty() && !p.allowHosts.matchesName(host) && !p.allowHosts.matchesIP(ip) {
+			return errCheckDenied("address " + addr)
+		}
+		return nil
+	}
+}
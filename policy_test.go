@@ -0,0 +1,145 @@
+package frontman
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	policy, err := newCheckPolicy(&CheckPolicyConfig{})
+	require.Nil(t, err)
+	assert.Nil(t, policy)
+	assert.Nil(t, policy.allow(context.Background(), WebCheck{Check: WebCheckData{URL: "http://10.0.0.1"}}))
+
+	_, err = newCheckPolicy(&CheckPolicyConfig{DenyHosts: []string{"10.0.0.0/33"}})
+	assert.NotNil(t, err)
+	_, err = newCheckPolicy(&CheckPolicyConfig{AllowPorts: []string{"443-80"}})
+	assert.NotNil(t, err)
+	_, err = newCheckPolicy(&CheckPolicyConfig{AllowHosts: []string{"foo*.example.com"}})
+	assert.NotNil(t, err)
+
+	policy, err = newCheckPolicy(&CheckPolicyConfig{
+		AllowHosts:     []string{"*.example.com", "192.168.0.0/16", "2001:db8::1"},
+		DenyHosts:      []string{"admin.example.com", "192.168.10.0/24"},
+		AllowPorts:     []string{"22", "80", "443", "8000-8100"},
+		DenyCheckTypes: []string{"UDP"},
+	})
+	require.Nil(t, err)
+
+	tests := []struct {
+		check   Check
+		allowed bool
+	}{
+		{WebCheck{Check: WebCheckData{URL: "https://www.example.com/login"}}, true},
+		{WebCheck{Check: WebCheckData{URL: "http://www.example.com:8080/"}}, true},
+		{WebCheck{Check: WebCheckData{URL: "http://www.example.com:9000/"}}, false},
+		{WebCheck{Check: WebCheckData{URL: "https://example.com/"}}, false},
+		{WebCheck{Check: WebCheckData{URL: "https://admin.example.com/"}}, false},
+		{WebCheck{Check: WebCheckData{URL: "http://[2001:db8::1]/"}}, true},
+		{WebCheck{Check: WebCheckData{URL: "http://192.168.10.5/"}}, false},
+		{ServiceCheck{Check: ServiceCheckData{Connect: "192.168.1.1", Protocol: "icmp"}}, true},
+		{ServiceCheck{Check: ServiceCheckData{Connect: "192.168.1.1", Protocol: "tcp", Port: "22"}}, true},
+		{ServiceCheck{Check: ServiceCheckData{Connect: "192.168.1.1", Protocol: "tcp", Port: "3306"}}, false},
+		{ServiceCheck{Check: ServiceCheckData{Connect: "192.168.1.1", Protocol: "udp", Port: "80"}}, false},
+		// the port of the service applies if none is set
+		{ServiceCheck{Check: ServiceCheckData{Connect: "192.168.1.1", Protocol: "tcp", Service: "SSH"}}, true},
+		{ServiceCheck{Check: ServiceCheckData{Connect: "192.168.1.1", Protocol: "tcp", Service: "smtp"}}, false},
+		{ServiceCheck{Check: ServiceCheckData{Connect: "10.0.0.1", Protocol: "icmp"}}, false},
+		{ServiceCheck{Check: ServiceCheckData{Protocol: "icmp"}}, false},
+		{SNMPCheck{Check: SNMPCheckData{Connect: "192.168.1.1"}}, false},
+	}
+	for _, test := range tests {
+		err := policy.allow(context.Background(), test.check)
+		if test.allowed {
+			assert.Nil(t, err, "%+v", test.check)
+		} else {
+			assert.IsType(t, errCheckDenied(""), err, "%+v", test.check)
+		}
+	}
+
+	u, _ := url.Parse("http://192.168.10.1/")
+	assert.NotNil(t, policy.allowURL(context.Background(), u))
+}
+
+func TestRunCheckDenied(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.CheckPolicy.DenyHosts = []string{"127.0.0.0/8"}
+	fm := helperCreateFrontman(t, cfg)
+
+	res, err := fm.runCheck(context.Background(), ServiceCheck{UUID: "a", Check: ServiceCheckData{Connect: "127.0.0.1", Protocol: "icmp"}}, true, nil)
+	require.NotNil(t, err)
+	assert.Equal(t, "a", res.CheckUUID)
+	assert.Equal(t, "serviceCheck", res.CheckType)
+	assert.Equal(t, "denied by check_policy: host 127.0.0.1", res.Message)
+	assert.Equal(t, uint64(1), fm.stats.ChecksDenied)
+
+	cfg.CheckPolicy.DenyHosts = []string{"localhost/"}
+	_, err = New(cfg, DefaultCfgPath, "1.2.3")
+	assert.NotNil(t, err)
+}
+
+func TestCheckPolicyDialControl(t *testing.T) {
+	policy, err := newCheckPolicy(&CheckPolicyConfig{DenyHosts: []string{"admin.example.com"}})
+	require.Nil(t, err)
+	assert.Nil(t, policy.dialControl("example.com"))
+
+	policy, err = newCheckPolicy(&CheckPolicyConfig{
+		AllowHosts: []string{"*.example.com", "192.168.0.0/16", "fe80::/10"},
+		DenyHosts:  []string{"192.168.10.0/24"},
+	})
+	require.Nil(t, err)
+
+	tests := []struct {
+		host    string
+		address string
+		allowed bool
+	}{
+		{"www.example.com", "10.0.0.1:80", true},
+		{"www.example.com", "192.168.10.1:80", false},
+		{"www.other.com", "192.168.1.1:80", true},
+		{"www.other.com", "10.0.0.1:80", false},
+		{"www.other.com", "[fe80::1%eth0]:80", true},
+		{"www.other.com", "localhost:80", false},
+	}
+	for _, test := range tests {
+		err := policy.dialControl(test.host)("tcp", test.address, nil)
+		if test.allowed {
+			assert.Nil(t, err, test.address)
+		} else {
+			assert.IsType(t, errCheckDenied(""), err, test.address)
+		}
+	}
+}
+
+// the address is checked when connecting, even if the name resolved to an allowed one before
+func TestCheckPolicyConnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.Nil(t, err)
+	p, _ := strconv.Atoi(port)
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.CheckPolicy.DenyHosts = []string{"127.0.0.0/8", "::1"}
+	fm := helperCreateFrontman(t, cfg)
+
+	_, err = fm.runTCPCheck(context.Background(), "localhost", p, "")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "denied by check_policy: address 127.0.0.1")
+
+	_, err = WebCheck{UUID: "web", Check: WebCheckData{URL: server.URL, Method: "get", ExpectedHTTPStatus: 200}}.run(context.Background(), fm)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "denied by check_policy: address 127.0.0.1")
+
+	_, err = fm.runSNMPProbe(context.Background(), "snmp", &SNMPCheckData{Connect: "127.0.0.1", Port: 161, Protocol: protocolSNMPv2, Community: "public", Timeout: 1, Preset: "basedata"}, true)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "denied by check_policy: address 127.0.0.1")
+}
@@ -0,0 +1,162 @@
+package frontman
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkPool limits the number of checks running at the same time, in total, per check type and per target host
+type checkPool struct {
+	maxChecks  int
+	maxPerType map[string]int
+	maxPerHost int
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	running int
+	byType  map[string]int
+	byHost  map[string]int
+}
+
+func newCheckPool(cfg *WorkerPoolConfig) *checkPool {
+	p := &checkPool{
+		maxChecks: cfg.MaxChecks,
+		maxPerType: map[string]int{
+			"webCheck":     cfg.MaxWebChecks,
+			"serviceCheck": cfg.MaxServiceChecks,
+			"snmpCheck":    cfg.MaxSNMPChecks,
+		},
+		maxPerHost: cfg.MaxChecksPerHost,
+		byType:     make(map[string]int),
+		byHost:     make(map[string]int),
+	}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+// limits equal or below zero mean unlimited
+func belowLimit(current, limit int) bool {
+	return limit <= 0 || current < limit
+}
+
+func (p *checkPool) available(checkType, host string) bool {
+	return belowLimit(p.running, p.maxChecks) &&
+		belowLimit(p.byType[checkType], p.maxPerType[checkType]) &&
+		(host == "" || belowLimit(p.byHost[host], p.maxPerHost))
+}
+
+// acquire blocks until the check may run and returns how long it waited.
+// Every successful call must be followed by release
+func (p *checkPool) acquire(ctx context.Context, checkType, host string) (time.Duration, error) {
+	started := time.Now()
+
+	// wake up the waiters once ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.lock.Lock()
+			p.cond.Broadcast()
+			p.lock.Unlock()
+		case <-stop:
+		}
+	}()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for !p.available(checkType, host) {
+		if ctx.Err() != nil {
+			return time.Since(started), ctx.Err()
+		}
+		p.cond.Wait()
+	}
+	p.running++
+	p.byType[checkType]++
+	if host != "" {
+		p.byHost[host]++
+	}
+	return time.Since(started), nil
+}
+
+func (p *checkPool) release(checkType, host string) {
+	p.lock.Lock()
+	p.running--
+	p.byType[checkType]--
+	if host != "" {
+		p.byHost[host]--
+		if p.byHost[host] == 0 {
+			delete(p.byHost, host)
+		}
+	}
+	p.lock.Unlock()
+
+	// waiters have different limits, wake up all of them
+	p.cond.Broadcast()
+}
+
+// returns the check type as used in results and the host the check connects to
+func checkTypeAndHost(check Check) (string, string) {
+	switch c := check.(type) {
+	case ServiceCheck:
+		return "serviceCheck", strings.ToLower(c.Check.Connect)
+	case WebCheck:
+		if u, err := url.Parse(c.Check.URL); err == nil {
+			return "webCheck", strings.ToLower(u.Hostname())
+		}
+		return "webCheck", ""
+	case SNMPCheck:
+		return "snmpCheck", strings.ToLower(c.Check.Connect)
+	}
+	return "", ""
+}
+
+// poolSlot is the place of a check in the worker pool
+type poolSlot struct {
+	checkType string
+	host      string
+	wait      time.Duration
+}
+
+// acquireSlot blocks until the check may run in the worker pool.
+// The slot must be released by runCheckInPool or releaseSlot
+func (fm *Frontman) acquireSlot(ctx context.Context, check Check) (*poolSlot, error) {
+	checkType, host := checkTypeAndHost(check)
+	wait, err := fm.pool.acquire(ctx, checkType, host)
+	return &poolSlot{checkType: checkType, host: host, wait: wait}, err
+}
+
+func (fm *Frontman) releaseSlot(slot *poolSlot) {
+	fm.pool.release(slot.checkType, slot.host)
+}
+
+// runs the check in the acquired slot, or as soon as the worker pool allows it if slot is nil.
+// The slot is released afterwards. The time the check waited for the pool is added to the measurements
+func (fm *Frontman) runCheckInPool(ctx context.Context, check Check, slot *poolSlot) (*Result, error) {
+	if slot == nil {
+		var err error
+		slot, err = fm.acquireSlot(ctx, check)
+		if err != nil {
+			err = contextError(ctx, err)
+			return &Result{
+				Node:         fm.Config.NodeName,
+				CheckType:    slot.checkType,
+				CheckUUID:    check.uniqueID(),
+				Timestamp:    time.Now().Unix(),
+				Measurements: map[string]interface{}{"queueWaitTime_s": slot.wait.Seconds()},
+				Message:      err.Error(),
+			}, err
+		}
+	}
+	defer fm.releaseSlot(slot)
+
+	res, err := check.run(ctx, fm)
+	if res.Measurements == nil {
+		res.Measurements = make(map[string]interface{})
+	}
+	res.Measurements["queueWaitTime_s"] = slot.wait.Seconds()
+	return res, err
+}
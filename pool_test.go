@@ -0,0 +1,97 @@
+package frontman
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTypeAndHost(t *testing.T) {
+	typ, host := checkTypeAndHost(WebCheck{Check: WebCheckData{URL: "https://Example.com:8443/path"}})
+	assert.Equal(t, "webCheck", typ)
+	assert.Equal(t, "example.com", host)
+
+	typ, host = checkTypeAndHost(ServiceCheck{Check: ServiceCheckData{Connect: "10.0.0.1"}})
+	assert.Equal(t, "serviceCheck", typ)
+	assert.Equal(t, "10.0.0.1", host)
+
+	typ, host = checkTypeAndHost(SNMPCheck{Check: SNMPCheckData{Connect: "switch"}})
+	assert.Equal(t, "snmpCheck", typ)
+	assert.Equal(t, "switch", host)
+}
+
+func TestCheckPoolLimits(t *testing.T) {
+	p := newCheckPool(&WorkerPoolConfig{
+		MaxChecks:        4,
+		MaxSNMPChecks:    2,
+		MaxChecksPerHost: 1,
+	})
+
+	// returns the max number of jobs running concurrently
+	run := func(checkType string, hosts []string) int32 {
+		var running, max int32
+		wg := sync.WaitGroup{}
+		for _, host := range hosts {
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				_, _ = p.acquire(context.Background(), checkType, host)
+				defer p.release(checkType, host)
+
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			}(host)
+		}
+		wg.Wait()
+		return max
+	}
+
+	assert.Equal(t, int32(4), run("webCheck", []string{"a", "b", "c", "d", "e", "f", "g", "h"}))
+	assert.Equal(t, int32(2), run("snmpCheck", []string{"a", "b", "c", "d"}))
+	assert.Equal(t, int32(1), run("serviceCheck", []string{"a", "a", "a"}))
+	assert.Empty(t, p.byHost)
+	assert.Equal(t, 0, p.running)
+}
+
+func TestCheckPoolWaitTime(t *testing.T) {
+	p := newCheckPool(&WorkerPoolConfig{MaxChecks: 1})
+
+	wait, err := p.acquire(context.Background(), "webCheck", "a")
+	assert.Nil(t, err)
+	assert.True(t, wait < 10*time.Millisecond)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p.release("webCheck", "a")
+	}()
+	wait, err = p.acquire(context.Background(), "webCheck", "b")
+	assert.Nil(t, err)
+	p.release("webCheck", "b")
+	assert.True(t, wait >= 50*time.Millisecond, "waited %v", wait)
+}
+
+func TestCheckPoolCancel(t *testing.T) {
+	p := newCheckPool(&WorkerPoolConfig{MaxChecks: 1})
+
+	_, err := p.acquire(context.Background(), "webCheck", "a")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err = p.acquire(ctx, "webCheck", "b")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, p.running)
+}
@@ -0,0 +1,157 @@
+package frontman
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checks with a lower interval run at this interval
+const minCheckInterval = time.Second
+
+// CheckSchedule controls how often a check runs in continuous mode
+type CheckSchedule struct {
+	Interval float64 `json:"interval,omitempty"` // seconds between two runs, the config value sleep is used if omitted
+	Offset   float64 `json:"offset,omitempty"`   // seconds to delay the first run
+	Jitter   float64 `json:"jitter,omitempty"`   // up to N random seconds added to every run to spread the load
+}
+
+func (s CheckSchedule) schedule() CheckSchedule {
+	return s
+}
+
+type scheduledCheck struct {
+	check Check
+	base  time.Time // next run without jitter, so jitter doesn't accumulate
+	next  time.Time
+}
+
+// schedules the next run at t
+func (sc *scheduledCheck) scheduleAt(t time.Time) {
+	sc.base = t
+	sc.next = t.Add(jitter(sc.check))
+}
+
+// checkScheduler keeps the checks received from the hub and dispatches them when due
+type checkScheduler struct {
+	defaultInterval time.Duration
+
+	lock   sync.Mutex
+	checks map[string]*scheduledCheck
+	paused bool
+}
+
+func newCheckScheduler(defaultInterval time.Duration) *checkScheduler {
+	return &checkScheduler{
+		defaultInterval: defaultInterval,
+		checks:          make(map[string]*scheduledCheck),
+	}
+}
+
+func (s *checkScheduler) interval(check Check) time.Duration {
+	interval := secToDuration(check.schedule().Interval)
+	if interval <= 0 {
+		interval = s.defaultInterval
+	}
+	if interval < minCheckInterval {
+		interval = minCheckInterval
+	}
+	return interval
+}
+
+func jitter(check Check) time.Duration {
+	max := secToDuration(check.schedule().Jitter)
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// update replaces the scheduled checks. New checks are due after their offset,
+// known checks keep their schedule unless the interval changed
+func (s *checkScheduler) update(checks []Check, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current := make(map[string]*scheduledCheck, len(checks))
+	for _, check := range checks {
+		uuid := check.uniqueID()
+		if sc, ok := s.checks[uuid]; ok {
+			changed := s.interval(sc.check) != s.interval(check)
+			sc.check = check
+			if changed {
+				sc.scheduleAt(now.Add(secToDuration(check.schedule().Offset)))
+			}
+			current[uuid] = sc
+			continue
+		}
+		sc := &scheduledCheck{check: check}
+		sc.scheduleAt(now.Add(secToDuration(check.schedule().Offset)))
+		current[uuid] = sc
+	}
+	logrus.Debugf("scheduler: %d checks scheduled, %d before", len(current), len(s.checks))
+	s.checks = current
+}
+
+// due returns the checks to run now, oldest due first, and schedules their next run
+func (s *checkScheduler) due(now time.Time) []Check {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.paused {
+		return nil
+	}
+
+	var due []*scheduledCheck
+	for _, sc := range s.checks {
+		if !sc.next.After(now) {
+			due = append(due, sc)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].next.Before(due[j].next)
+	})
+
+	checks := make([]Check, 0, len(due))
+	for _, sc := range due {
+		checks = append(checks, sc.check)
+
+		interval := s.interval(sc.check)
+		next := sc.base.Add(interval)
+		if !next.After(now) {
+			// the check is behind its schedule, e.g. after a pause, don't run it several times in a row
+			next = now.Add(interval)
+		}
+		sc.scheduleAt(next)
+	}
+	return checks
+}
+
+// setPaused stops or resumes dispatching checks, e.g. while health checks fail
+func (s *checkScheduler) setPaused(paused bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.paused = paused
+}
+
+// moves due checks to the queue until frontman is interrupted
+func (fm *Frontman) scheduleChecksContinuous() {
+	interval := secToDuration(fm.Config.SleepDurationEmptyQueue)
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	for {
+		select {
+		case <-fm.InterruptChan:
+			return
+		case <-time.After(interval):
+			if checks := fm.scheduler.due(time.Now()); len(checks) > 0 {
+				fm.addUniqueChecks(checks)
+			}
+		}
+	}
+}
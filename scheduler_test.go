@@ -0,0 +1,78 @@
+package frontman
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uuids(checks []Check) []string {
+	res := []string{}
+	for _, c := range checks {
+		res = append(res, c.uniqueID())
+	}
+	return res
+}
+
+func TestCheckScheduleDecode(t *testing.T) {
+	var input Input
+	err := json.Unmarshal([]byte(`{"serviceChecks":[{"checkUuid":"a","interval":10,"offset":2.5,"jitter":1,"check":{"connect":"127.0.0.1"}}]}`), &input)
+	require.Nil(t, err)
+	require.Len(t, input.ServiceChecks, 1)
+	assert.Equal(t, CheckSchedule{Interval: 10, Offset: 2.5, Jitter: 1}, input.ServiceChecks[0].schedule())
+}
+
+func TestCheckScheduler(t *testing.T) {
+	s := newCheckScheduler(30 * time.Second)
+	start := time.Now()
+
+	fast := ServiceCheck{UUID: "fast", CheckSchedule: CheckSchedule{Interval: 10}}
+	slow := WebCheck{UUID: "slow", CheckSchedule: CheckSchedule{Interval: 300, Offset: 5}}
+	def := SNMPCheck{UUID: "default"}
+	s.update([]Check{fast, slow, def}, start)
+
+	assert.ElementsMatch(t, []string{"fast", "default"}, uuids(s.due(start)))
+	assert.Empty(t, s.due(start.Add(time.Second)))
+	assert.Equal(t, []string{"slow"}, uuids(s.due(start.Add(5*time.Second))))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(10*time.Second))))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(20*time.Second))))
+	assert.ElementsMatch(t, []string{"fast", "default"}, uuids(s.due(start.Add(30*time.Second))))
+
+	// checks behind their schedule run once
+	s.setPaused(true)
+	assert.Empty(t, s.due(start.Add(100*time.Second)))
+	s.setPaused(false)
+	assert.ElementsMatch(t, []string{"fast", "default"}, uuids(s.due(start.Add(100*time.Second))))
+	assert.Empty(t, s.due(start.Add(105*time.Second)))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(110*time.Second))))
+
+	// removed checks are not run anymore, known checks keep their schedule
+	s.update([]Check{fast}, start.Add(111*time.Second))
+	assert.Empty(t, s.due(start.Add(111*time.Second)))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(120*time.Second))))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(400*time.Second))))
+
+	// a changed interval reschedules the check
+	fast.Interval = 60
+	s.update([]Check{fast}, start.Add(500*time.Second))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(500*time.Second))))
+	assert.Empty(t, s.due(start.Add(550*time.Second)))
+	assert.Equal(t, []string{"fast"}, uuids(s.due(start.Add(560*time.Second))))
+}
+
+func TestCheckSchedulerJitter(t *testing.T) {
+	s := newCheckScheduler(30 * time.Second)
+	start := time.Now()
+
+	check := ServiceCheck{UUID: "jitter", CheckSchedule: CheckSchedule{Interval: 10, Jitter: 2}}
+	s.update([]Check{check}, start)
+
+	for i := 0; i < 10; i++ {
+		base := start.Add(time.Duration(i) * 10 * time.Second)
+		assert.Empty(t, s.due(base.Add(-time.Millisecond)))
+		assert.Len(t, s.due(base.Add(2*time.Second)), 1)
+	}
+}
@@ -2,7 +2,6 @@ package frontman
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -24,9 +23,7 @@ func (fm *Frontman) postResultsToHub(results []Result) error {
 	defer fm.offlineResultsLock.Unlock()
 	fm.offlineResultsBuffer = append(fm.offlineResultsBuffer, results...)
 
-	b, err := json.Marshal(Results{
-		Results: fm.offlineResultsBuffer,
-	})
+	b, contentType, err := fm.marshalResults(fm.offlineResultsBuffer)
 	if err != nil {
 		return err
 	}
@@ -38,14 +35,29 @@ func (fm *Frontman) postResultsToHub(results []Result) error {
 			len(results))
 
 		fm.offlineResultsBuffer = results
-		b, err = json.Marshal(Results{
-			Results: fm.offlineResultsBuffer,
-		})
+		b, contentType, err = fm.marshalResults(fm.offlineResultsBuffer)
 		if err != nil {
 			return err
 		}
 	}
 
+	// the results are sent with the next request once requests aren't paused anymore
+	if err := fm.hubBackoff.paused(time.Now()); err != nil {
+		return err
+	}
+
+	if err := fm.postToHub(b, contentType, len(fm.offlineResultsBuffer)); err != nil {
+		return err
+	}
+
+	// in case of successful POST, we reset the offline buffer
+	fm.offlineResultsBuffer = []Result{}
+
+	return nil
+}
+
+// postToHub posts the results encoded by marshalResults to the hub
+func (fm *Frontman) postToHub(b []byte, contentType string, count int) error {
 	if fm.Config.HubURL == "" {
 		return newEmptyFieldError("hub_url")
 	} else if u, err := url.Parse(fm.Config.HubURL); err != nil {
@@ -56,60 +68,70 @@ func (fm *Frontman) postResultsToHub(results []Result) error {
 		return newFieldError("hub_url", err)
 	}
 
-	var req *http.Request
-	var bodyLength int
-
-	if fm.Config.HubGzip {
-		var buffer bytes.Buffer
-		zw := gzip.NewWriter(&buffer)
-		if _, err := zw.Write(b); err != nil {
-			_ = zw.Close()
-			return err
-		}
-		if err := zw.Close(); err != nil {
-			return err
-		}
-
-		req, err = http.NewRequest("POST", fm.Config.HubURL, &buffer)
-		bodyLength = buffer.Len()
-		req.Header.Set("Content-Encoding", "gzip")
-	} else {
-		req, err = http.NewRequest("POST", fm.Config.HubURL, bytes.NewBuffer(b))
-		bodyLength = len(b)
+	body, contentEncoding, err := fm.compressResults(b)
+	if err != nil {
+		return err
 	}
+	bodyLength := len(body)
+
+	req, err := http.NewRequest("POST", fm.Config.HubURL, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 
 	req.Header.Add("User-Agent", fm.userAgent())
 
-	if fm.Config.HubUser != "" {
-		req.SetBasicAuth(fm.Config.HubUser, fm.Config.HubPassword)
+	// authorize first, a failure must not leave the probe of an open circuit pending
+	if err := fm.hubAuth.authorize(req); err != nil {
+		return err
+	}
+
+	if err := fm.hubBackoff.allow(time.Now()); err != nil {
+		return err
 	}
 
 	started := time.Now()
 
 	resp, err := fm.hubClient.Do(req)
 	if err != nil {
+		fm.hubBackoff.failure(time.Now(), 0)
 		return err
 	}
 
 	defer resp.Body.Close()
 
 	secondsSpent := float64(time.Since(started)) / float64(time.Second)
-	logrus.Infof("Sent %d results to Hub.. Status %d. Spent %fs", len(fm.offlineResultsBuffer), resp.StatusCode, secondsSpent)
+	logrus.Infof("Sent %d results to Hub.. Status %d. Spent %fs", count, resp.StatusCode, secondsSpent)
 
-	if resp.StatusCode == 205 {
-		logrus.Debugf("postResultsToHub hub returned 205")
-		return ErrorHubResetContent{}
+	fm.hubFormat.announce(resp.Header)
+	if resp.StatusCode == http.StatusUnsupportedMediaType {
+		compression := contentEncoding
+		if compression == "" {
+			compression = HubCompressionNone
+		}
+		fm.handleUnsupportedMediaType(encodingOf(contentType), compression)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		fm.hubAuth.invalidate()
 	}
+
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
 		logrus.Debugf("postResultsToHub failed with %v", resp.Status)
-		return ErrorHubGeneral{resp.StatusCode, resp.Status}
+		delay := retryAfter(resp, time.Now())
+		fm.hubBackoff.failure(time.Now(), delay)
+		return ErrorHubGeneral{resp.StatusCode, resp.Status, delay}
 	}
+	fm.hubBackoff.success()
 
-	// in case of successful POST, we reset the offline buffer
-	fm.offlineResultsBuffer = []Result{}
+	if resp.StatusCode == 205 {
+		logrus.Debugf("postResultsToHub hub returned 205")
+		return ErrorHubResetContent{}
+	}
 
 	// Update frontman statistics
 	fm.statsLock.Lock()
@@ -125,6 +147,7 @@ func (fm *Frontman) sendResultsChanToFile(outputFile *os.File) error {
 	for res := range fm.resultsChan {
 		results = append(results, res)
 	}
+	fm.flushSinks(results)
 
 	return jsonEncoder.Encode(results)
 }
@@ -137,6 +160,7 @@ func (fm *Frontman) sendResultsChanToHub() error {
 	for res := range fm.resultsChan {
 		results = append(results, res)
 	}
+	fm.flushSinks(results)
 	logrus.Infof("sendResultsChanToHub posting. len %v", len(results))
 	err := fm.postResultsToHub(results)
 	if err != nil {
@@ -168,12 +192,33 @@ func (fm *Frontman) pollResultsChan() {
 
 	// chan polling forever until closed
 	for res := range fm.resultsChan {
+		fm.writeToSinks(res)
+		if fm.changeFilter != nil && !fm.changeFilter.report(&res, time.Now()) {
+			fm.statsLock.Lock()
+			fm.stats.CheckResultsSuppressed++
+			fm.statsLock.Unlock()
+			continue
+		}
+		if fm.stream.send(res) {
+			continue
+		}
+		fm.queueResults([]Result{res})
+	}
+
+	logrus.Debugf("pollResultsChan resultsChan closed, returning")
+}
+
+// queueResults hands results to the HTTP sender, on disk if the spool is enabled
+func (fm *Frontman) queueResults(results []Result) {
+	for _, res := range results {
+		if fm.spool != nil {
+			fm.spoolQueue <- res
+			continue
+		}
 		fm.resultsLock.Lock()
 		fm.results = append(fm.results, res)
 		fm.resultsLock.Unlock()
 	}
-
-	logrus.Debugf("pollResultsChan resultsChan closed, returning")
 }
 
 // expire results who is past TTL
@@ -202,7 +247,8 @@ func (fm *Frontman) sendResultsChanToHubQueue() {
 	lastSentToHub := time.Unix(0, 0)
 
 	for {
-		if time.Since(lastSentToHub) >= sendInterval {
+		// don't take results from the queue while requests to the hub are paused
+		if time.Since(lastSentToHub) >= sendInterval && fm.hubBackoff.paused(time.Now()) == nil {
 			lastSentToHub = time.Now()
 
 			fm.expireOldResults()
@@ -242,6 +288,9 @@ func (fm *Frontman) sendResultsChanToHubQueue() {
 								fm.results = []Result{}
 								fm.resultsLock.Unlock()
 
+							case ErrorHubUnavailable:
+								// not sent, the results are kept in the offline buffer
+
 							case ErrorHubGeneral:
 								if !fm.Config.DiscardOnHTTPResponseError {
 									// If the hub doesn't respond with 2XX, the results remain in the queue.
@@ -269,6 +318,8 @@ func (fm *Frontman) sendResultsChanToHubQueue() {
 
 		select {
 		case <-fm.InterruptChan:
+			// the stream hands back its unacknowledged results when it stops
+			<-fm.stream.stopped()
 			fm.resultsLock.RLock()
 			logrus.Infof("sendResultsChanToHubQueue interrupt caught, posting last %d results", len(fm.results))
 			if err := fm.postResultsToHub(fm.results); err != nil {
@@ -299,11 +350,19 @@ func (fm *Frontman) writeQueueStats() {
 	resultsLen := len(fm.results)
 	fm.resultsLock.RUnlock()
 
-	data, err := json.Marshal(map[string]int{
+	queueStats := map[string]int{
 		"checks_queue":       checksLen,
 		"checks_in_progress": ipcLen,
 		"results_queue":      resultsLen,
-		"ts":                 int(time.Now().UnixNano())})
+		"ts":                 int(time.Now().UnixNano())}
+
+	if fm.spool != nil {
+		pending, size := fm.spool.stats()
+		queueStats["spool_results"] = pending
+		queueStats["spool_bytes"] = int(size)
+	}
+
+	data, err := json.Marshal(queueStats)
 
 	if err != nil {
 		logrus.Error("writeQueueStats Marshal", err)
@@ -1,6 +1,7 @@
 package frontman
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -12,7 +13,7 @@ func (check ServiceCheck) uniqueID() string {
 	return check.UUID
 }
 
-func (check ServiceCheck) run(fm *Frontman) (*Result, error) {
+func (check ServiceCheck) run(ctx context.Context, fm *Frontman) (*Result, error) {
 
 	res := &Result{
 		Node:      fm.Config.NodeName,
@@ -29,56 +30,37 @@ func (check ServiceCheck) run(fm *Frontman) (*Result, error) {
 		return res, fmt.Errorf("missing data.connect key")
 	}
 
-	var done = make(chan struct{})
+	// probes have their own timeouts, the deadline aborts probes that don't finish anyway
+	ctx, cancel := context.WithTimeout(ctx, serviceCheckEmergencyTimeout)
+	defer cancel()
+
 	var err error
 	var results map[string]interface{}
 
-	go func() {
-		switch check.Check.Protocol {
-		case ProtocolICMP:
-			results, err = fm.runPing(check.Check.Connect)
-			if err != nil {
-				logrus.Debugf("serviceCheck: %s: %s", check.UUID, err.Error())
-			}
-		case ProtocolTCP:
-			port, _ := check.Check.Port.Int64()
-
-			results, err = fm.runTCPCheck(check.Check.Connect, int(port), check.Check.Service)
-			if err != nil {
-				logrus.Debugf("serviceCheck: %s: %s", check.UUID, err.Error())
-			}
-		case ProtocolUDP:
-			port, _ := check.Check.Port.Int64()
-
-			results, err = fm.runUDPCheck(check.Check.Connect, int(port), check.Check.Service)
-			if err != nil {
-				logrus.Debugf("serviceCheck: %s: %s", check.UUID, err.Error())
-			}
-		case ProtocolSSL:
-			port, _ := check.Check.Port.Int64()
-
-			results, err = fm.runSSLCheck(check.Check.Connect, int(port), check.Check.Service)
-			if err != nil {
-				logrus.Debugf("serviceCheck: %s: %s", check.UUID, err.Error())
-			}
-		case "":
-			logrus.Info("serviceCheck: missing check.protocol")
-			err = errors.New("Missing check.protocol")
-		default:
-			logrus.Errorf("serviceCheck: unknown check.protocol: '%s'", check.Check.Protocol)
-			err = errors.New("Unknown check.protocol")
-		}
-		done <- struct{}{}
-	}()
+	switch check.Check.Protocol {
+	case ProtocolICMP:
+		results, err = fm.runPing(ctx, check.Check.Connect)
+	case ProtocolTCP:
+		port, _ := check.Check.Port.Int64()
+		results, err = fm.runTCPCheck(ctx, check.Check.Connect, int(port), check.Check.Service)
+	case ProtocolUDP:
+		port, _ := check.Check.Port.Int64()
+		results, err = fm.runUDPCheck(ctx, check.Check.Connect, int(port), check.Check.Service, &check.Check)
+	case ProtocolSSL:
+		port, _ := check.Check.Port.Int64()
+		results, err = fm.runSSLCheck(ctx, check.Check.Connect, int(port), check.Check.Service)
+	case "":
+		logrus.Info("serviceCheck: missing check.protocol")
+		return res, errors.New("Missing check.protocol")
+	default:
+		logrus.Errorf("serviceCheck: unknown check.protocol: '%s'", check.Check.Protocol)
+		return res, errors.New("Unknown check.protocol")
+	}
 
-	// Warning: do not rely on serviceCheckEmergencyTimeout as it leak goroutines(until it will be finished)
-	// instead use individual timeouts inside all checks
-	select {
-	case <-done:
-		res.Measurements = results
-		return res, err
-	case <-time.After(serviceCheckEmergencyTimeout):
-		logrus.Debugf("serviceCheck %s %s: %s got unexpected timeout after %.0fs", check.Check.Protocol, check.Check.Connect, check.UUID, serviceCheckEmergencyTimeout.Seconds())
-		return res, fmt.Errorf("got unexpected timeout")
+	if err != nil {
+		err = contextError(ctx, err)
+		logrus.Debugf("serviceCheck: %s: %s", check.UUID, err.Error())
 	}
+	res.Measurements = results
+	return res, err
 }
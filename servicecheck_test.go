@@ -1,7 +1,12 @@
 package frontman
 
 import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -47,3 +52,46 @@ func TestDNSTCPCheck(t *testing.T) {
 	require.Equal(t, nil, res.Message)
 	require.Equal(t, 1, res.Measurements["net.tcp.dns.53.success"])
 }
+
+func TestServiceCheckCancel(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.NetTCPTimeout = 10
+	fm := helperCreateFrontman(t, cfg)
+
+	// accepts connections but never sends the SSH banner
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	check := ServiceCheck{
+		UUID: "cancelled-tcp-check",
+		Check: ServiceCheckData{
+			Connect:  "127.0.0.1",
+			Protocol: "tcp",
+			Service:  "ssh",
+			Port:     json.Number(strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	started := time.Now()
+	res, err := check.run(ctx, fm)
+	require.NotNil(t, err)
+	require.Equal(t, "check was cancelled", err.Error())
+	require.Equal(t, 0, res.Measurements["net.tcp.ssh."+string(check.Check.Port)+".success"])
+	require.True(t, time.Since(started) < 2*time.Second, "took %v", time.Since(started))
+}
@@ -0,0 +1,42 @@
+package frontman
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// response header of the hub with the base64 encoded Ed25519 signature of the body
+const hubSignatureHeader = "X-Signature-Ed25519"
+
+func decodeHubSigningKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a key of %d bytes, got %d", ed25519.PublicKeySize, len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// verifyHubSignature returns an error if hub_signing_key is set and the signature doesn't match the check list
+func (fm *Frontman) verifyHubSignature(body []byte, signature string) error {
+	if fm.Config.HubSigningKey == "" {
+		return nil
+	}
+	key, err := decodeHubSigningKey(fm.Config.HubSigningKey)
+	if err != nil {
+		return fmt.Errorf("invalid hub_signing_key: %s", err)
+	}
+	if signature == "" {
+		return errors.New("the check list is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || !ed25519.Verify(key, body, sig) {
+		return errors.New("invalid signature of the check list")
+	}
+	return nil
+}
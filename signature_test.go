@@ -0,0 +1,49 @@
+package frontman
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputFromHubSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.Nil(t, err)
+	body, _ := json.Marshal(Input{ServiceChecks: []ServiceCheck{{UUID: "a", Check: ServiceCheckData{Connect: "example.com", Protocol: "icmp"}}}})
+
+	var signature string
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signature != "" {
+			w.Header().Set(hubSignatureHeader, signature)
+		}
+		_, _ = w.Write(body)
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	cfg.HubSigningKey = base64.StdEncoding.EncodeToString(pub)
+	fm := helperCreateFrontman(t, cfg)
+
+	_, err = fm.inputFromHub()
+	assert.EqualError(t, err, "the check list is not signed")
+
+	signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("something else")))
+	_, err = fm.inputFromHub()
+	assert.EqualError(t, err, "invalid signature of the check list")
+
+	signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, body))
+	checks, err := fm.inputFromHub()
+	require.Nil(t, err)
+	assert.Len(t, checks, 1)
+
+	fm.Config.HubSigningKey = "c2hvcnQ="
+	_, err = fm.inputFromHub()
+	assert.EqualError(t, err, "invalid hub_signing_key: expected a key of 32 bytes, got 5")
+}
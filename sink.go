@@ -0,0 +1,220 @@
+package frontman
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// results waiting for a slow output, further results are dropped
+const sinkQueueSize = 1000
+
+// resultSink is an output receiving the check results in addition to the hub or the output file
+type resultSink interface {
+	name() string
+	write(results []Result) error
+	close() error
+}
+
+// sinkWorker writes to a sink in the background, so a slow output doesn't delay the others
+type sinkWorker struct {
+	sink  resultSink
+	queue chan Result
+}
+
+// newSinks creates the outputs enabled in the config. Outputs failing to start are logged and skipped
+func (fm *Frontman) newSinks() []resultSink {
+	cfg := &fm.Config.Outputs
+	var sinks []resultSink
+
+	add := func(sink resultSink, err error) {
+		if err != nil {
+			logrus.Errorf("Could not start output: %s", err)
+			return
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if cfg.Prometheus.Listen != "" {
+		add(newPrometheusSink(&cfg.Prometheus))
+	}
+	if cfg.InfluxDB.URL != "" {
+		add(newInfluxDBSink(&cfg.InfluxDB), nil)
+	}
+	if cfg.Graphite.Address != "" {
+		add(newGraphiteSink(&cfg.Graphite), nil)
+	}
+	if cfg.File.Path != "" {
+		add(newFileSink(&cfg.File))
+	}
+	if cfg.Kafka.Broker != "" {
+		add(newKafkaSink(&cfg.Kafka))
+	}
+	if cfg.NATS.URL != "" {
+		add(newNATSSink(&cfg.NATS))
+	}
+	return sinks
+}
+
+// starts a worker per sink, used in continuous mode.
+// Once frontman is interrupted the workers write the queued results and the sinks are closed
+func (fm *Frontman) startSinkWorkers() {
+	var wg sync.WaitGroup
+	fm.sinkWorkersLock.Lock()
+	for _, sink := range fm.sinks {
+		w := &sinkWorker{sink: sink, queue: make(chan Result, sinkQueueSize)}
+		fm.sinkWorkers = append(fm.sinkWorkers, w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(fm.Config.SenderBatchSize)
+		}()
+	}
+	fm.sinkWorkersLock.Unlock()
+
+	fm.TerminateQueue.Add(1)
+	go func() {
+		defer fm.TerminateQueue.Done()
+		<-fm.InterruptChan
+
+		fm.sinkWorkersLock.Lock()
+		for _, w := range fm.sinkWorkers {
+			close(w.queue)
+		}
+		fm.sinkWorkers = nil
+		fm.sinkWorkersLock.Unlock()
+
+		wg.Wait()
+		fm.closeSinks()
+	}()
+}
+
+// writes batches of the queued results
+func (w *sinkWorker) run(batchSize int) {
+	for res := range w.queue {
+		batch := []Result{res}
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case res, ok := <-w.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, res)
+			default:
+				break collect
+			}
+		}
+
+		if err := w.sink.write(batch); err != nil {
+			logrus.Errorf("output %s: failed to write %d results: %s", w.sink.name(), len(batch), err)
+		}
+	}
+}
+
+// passes the result to all sink workers without blocking
+func (fm *Frontman) writeToSinks(res Result) {
+	fm.sinkWorkersLock.RLock()
+	defer fm.sinkWorkersLock.RUnlock()
+	for _, w := range fm.sinkWorkers {
+		select {
+		case w.queue <- res:
+		default:
+			logrus.Errorf("output %s is too slow, dropping result of %s", w.sink.name(), res.CheckUUID)
+		}
+	}
+}
+
+// writes the results to all sinks and closes them, used by RunOnce
+func (fm *Frontman) flushSinks(results []Result) {
+	for _, sink := range fm.sinks {
+		if len(results) > 0 {
+			if err := sink.write(results); err != nil {
+				logrus.Errorf("output %s: failed to write %d results: %s", sink.name(), len(results), err)
+			}
+		}
+	}
+	fm.closeSinks()
+}
+
+func (fm *Frontman) closeSinks() {
+	for _, sink := range fm.sinks {
+		if err := sink.close(); err != nil {
+			logrus.Errorf("output %s: %s", sink.name(), err)
+		}
+	}
+}
+
+// numericMeasurements returns the measurements with numeric values, nested maps are flattened to dotted keys.
+// Strings and other values can't be used as metrics and are skipped
+func numericMeasurements(measurements map[string]interface{}) map[string]float64 {
+	res := make(map[string]float64)
+	flattenMeasurements("", measurements, res)
+	return res
+}
+
+func flattenMeasurements(prefix string, measurements map[string]interface{}, res map[string]float64) {
+	for key, val := range measurements {
+		switch v := val.(type) {
+		case map[string]interface{}:
+			flattenMeasurements(prefix+key+".", v, res)
+		case MeasurementsMap:
+			flattenMeasurements(prefix+key+".", v, res)
+		default:
+			if f, ok := measurementValue(val); ok {
+				res[prefix+key] = f
+			}
+		}
+	}
+}
+
+func measurementValue(val interface{}) (float64, bool) {
+	var f float64
+	switch v := val.(type) {
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case uint:
+		f = float64(v)
+	case uint32:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	case float32:
+		f = float64(v)
+	case float64:
+		f = v
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		f = n
+	case bool:
+		if v {
+			f = 1
+		}
+	default:
+		return 0, false
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// returns the keys of m sorted, so outputs are stable
+func sortedMeasurementKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
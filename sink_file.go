@@ -0,0 +1,127 @@
+package frontman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileSink appends the results as JSON lines to a file and rotates it when it exceeds maxBytes
+type fileSink struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newFileSink(cfg *FileOutputConfig) (*fileSink, error) {
+	s := &fileSink{
+		path:     cfg.Path,
+		maxBytes: cfg.MaxBytes,
+		maxFiles: cfg.MaxFiles,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newFileSinkFromFile writes to an already opened file like the output file of the file mode.
+// Stdout is never rotated
+func newFileSinkFromFile(f *os.File, maxBytes int64, maxFiles int) *fileSink {
+	s := &fileSink{
+		path:     f.Name(),
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+		file:     f,
+	}
+	if f == os.Stdout {
+		s.maxBytes = 0
+	}
+	if fi, err := f.Stat(); err == nil {
+		s.size = fi.Size()
+	}
+	return s
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = fi.Size()
+	return nil
+}
+
+func (s *fileSink) name() string {
+	return "file"
+}
+
+// rotatedPath returns the path of the n-th rotated file, 1 is the newest
+func (s *fileSink) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+// renames the file to path.1, path.1 to path.2 and so on, keeping maxFiles rotated files
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.rotatedPath(s.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := s.maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(s.rotatedPath(n), s.rotatedPath(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if s.maxFiles > 0 {
+		if err := os.Rename(s.path, s.rotatedPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *fileSink) write(results []Result) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(buf.Len()) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,81 @@
+package frontman
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const graphiteTimeout = 10 * time.Second
+
+// graphiteSink sends the measurements in the Graphite plaintext protocol as prefix.checkType.checkUuid.measurement
+type graphiteSink struct {
+	address string
+	prefix  string
+}
+
+func newGraphiteSink(cfg *GraphiteOutputConfig) *graphiteSink {
+	return &graphiteSink{
+		address: cfg.Address,
+		prefix:  cfg.Prefix,
+	}
+}
+
+func (s *graphiteSink) name() string {
+	return "graphite"
+}
+
+// characters not allowed in a node of a metric path
+var graphiteInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_\-:]+`)
+
+func graphiteNode(s string) string {
+	return graphiteInvalidChars.ReplaceAllString(s, "_")
+}
+
+func (s *graphiteSink) lines(results []Result) []byte {
+	var b bytes.Buffer
+	for _, res := range results {
+		m := numericMeasurements(res.Measurements)
+		path := graphiteNode(res.CheckType) + "." + graphiteNode(res.CheckUUID) + "."
+		if s.prefix != "" {
+			path = s.prefix + "." + path
+		}
+		for _, key := range sortedMeasurementKeys(m) {
+			// measurement keys are already dotted paths
+			nodes := strings.Split(key, ".")
+			for i := range nodes {
+				nodes[i] = graphiteNode(nodes[i])
+			}
+			fmt.Fprintf(&b, "%s%s %s %d\n", path, strings.Join(nodes, "."),
+				strconv.FormatFloat(m[key], 'g', -1, 64), res.Timestamp)
+		}
+	}
+	return b.Bytes()
+}
+
+func (s *graphiteSink) write(results []Result) error {
+	data := s.lines(results)
+	if len(data) == 0 {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", s.address, graphiteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(graphiteTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+func (s *graphiteSink) close() error {
+	return nil
+}
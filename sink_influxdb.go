@@ -0,0 +1,118 @@
+package frontman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxDBSink writes the measurements in the InfluxDB line protocol, one point per result
+type influxDBSink struct {
+	url         string
+	token       string
+	username    string
+	password    string
+	measurement string
+	client      *http.Client
+}
+
+func newInfluxDBSink(cfg *InfluxDBOutputConfig) *influxDBSink {
+	measurement := cfg.Measurement
+	if measurement == "" {
+		measurement = "frontman"
+	}
+	return &influxDBSink{
+		url:         cfg.URL,
+		token:       cfg.Token,
+		username:    cfg.Username,
+		password:    cfg.Password,
+		measurement: measurement,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *influxDBSink) name() string {
+	return "influxdb"
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// returns the results in line protocol with timestamps in seconds, results without numeric measurements are skipped
+func (s *influxDBSink) lines(results []Result) []byte {
+	var b bytes.Buffer
+	for _, res := range results {
+		m := numericMeasurements(res.Measurements)
+		if len(m) == 0 {
+			continue
+		}
+
+		b.WriteString(influxMeasurementEscaper.Replace(s.measurement))
+		if res.CheckUUID != "" {
+			b.WriteString(",check_uuid=" + influxKeyEscaper.Replace(res.CheckUUID))
+		}
+		if res.CheckType != "" {
+			b.WriteString(",check_type=" + influxKeyEscaper.Replace(res.CheckType))
+		}
+		for i, key := range sortedMeasurementKeys(m) {
+			if i == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(influxKeyEscaper.Replace(key) + "=" + strconv.FormatFloat(m[key], 'g', -1, 64))
+		}
+		fmt.Fprintf(&b, " %d\n", res.Timestamp)
+	}
+	return b.Bytes()
+}
+
+func (s *influxDBSink) write(results []Result) error {
+	body := s.lines(results)
+	if len(body) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("precision", "s")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influxdb replied with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (s *influxDBSink) close() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package frontman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const kafkaTimeout = 10 * time.Second
+
+// kafkaSink produces every result as JSON message keyed by the check UUID to a single partition.
+// The leader of the partition is looked up from the configured broker
+type kafkaSink struct {
+	topic     string
+	partition int
+	acks      kafka.RequiredAcks
+
+	transport *kafka.Transport
+	client    *kafka.Client
+}
+
+func newKafkaSink(cfg *KafkaOutputConfig) (*kafkaSink, error) {
+	acks := kafka.RequiredAcks(cfg.Acks)
+	switch acks {
+	case kafka.RequireNone, kafka.RequireOne, kafka.RequireAll:
+	default:
+		return nil, fmt.Errorf("kafka: invalid acks %d", cfg.Acks)
+	}
+
+	transport := &kafka.Transport{
+		DialTimeout: kafkaTimeout,
+		ClientID:    "frontman",
+	}
+	return &kafkaSink{
+		topic:     cfg.Topic,
+		partition: int(cfg.Partition),
+		acks:      acks,
+		transport: transport,
+		client: &kafka.Client{
+			Addr:      kafka.TCP(cfg.Broker),
+			Timeout:   kafkaTimeout,
+			Transport: transport,
+		},
+	}, nil
+}
+
+func (s *kafkaSink) name() string {
+	return "kafka"
+}
+
+func (s *kafkaSink) write(results []Result) error {
+	records := make([]kafka.Record, 0, len(results))
+	for _, res := range results {
+		value, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		var key kafka.Bytes
+		if res.CheckUUID != "" {
+			key = kafka.NewBytes([]byte(res.CheckUUID))
+		}
+		records = append(records, kafka.Record{Time: time.Unix(res.Timestamp, 0), Key: key, Value: kafka.NewBytes(value)})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	resp, err := s.client.Produce(context.Background(), &kafka.ProduceRequest{
+		Topic:        s.topic,
+		Partition:    s.partition,
+		RequiredAcks: s.acks,
+		Records:      kafka.NewRecordReader(records...),
+	})
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.Error != nil {
+		return fmt.Errorf("kafka: %w", resp.Error)
+	}
+	return nil
+}
+
+func (s *kafkaSink) close() error {
+	s.transport.CloseIdleConnections()
+	return nil
+}
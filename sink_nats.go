@@ -0,0 +1,178 @@
+package frontman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const natsTimeout = 10 * time.Second
+
+// natsSink publishes every result as JSON message using the NATS text protocol
+type natsSink struct {
+	address  string
+	subject  string
+	user     string
+	password string
+	token    string
+
+	lock sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newNATSSink(cfg *NATSOutputConfig) (*natsSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("nats: invalid url: %s", err)
+	}
+	if u.Scheme != "nats" {
+		return nil, fmt.Errorf("nats: url must start with nats://")
+	}
+
+	s := &natsSink{
+		address: u.Host,
+		subject: cfg.Subject,
+		token:   cfg.Token,
+	}
+	if u.Port() == "" {
+		s.address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if s.subject == "" {
+		s.subject = "frontman.results"
+	}
+	return s, nil
+}
+
+func (s *natsSink) name() string {
+	return "nats"
+}
+
+// reads the next line sent by the server without the trailing CRLF
+func (s *natsSink) readLine() (string, error) {
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (s *natsSink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.address, natsTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+	if err := conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting '%s'", line)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(line[5:]), &info); err != nil {
+		return fmt.Errorf("nats: invalid INFO: %s", err)
+	}
+	if info.TLSRequired {
+		return fmt.Errorf("nats: server requires TLS, which is not supported")
+	}
+
+	options, err := json.Marshal(map[string]interface{}{
+		"verbose":    false,
+		"pedantic":   false,
+		"name":       "frontman",
+		"lang":       "go",
+		"user":       s.user,
+		"pass":       s.password,
+		"auth_token": s.token,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(conn, "CONNECT %s\r\n", options)
+	return err
+}
+
+func (s *natsSink) write(results []Result) error {
+	var buf bytes.Buffer
+	for _, res := range results {
+		msg, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "PUB %s %d\r\n", s.subject, len(msg))
+		buf.Write(msg)
+		buf.WriteString("\r\n")
+	}
+	// the server answers PING after processing the messages before, or with -ERR
+	buf.WriteString("PING\r\n")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.publish(buf.Bytes())
+	if err != nil && s.conn != nil {
+		// reconnect with the next batch
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *natsSink) publish(data []byte) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	if err := s.conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(data); err != nil {
+		return err
+	}
+
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (s *natsSink) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
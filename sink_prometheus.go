@@ -0,0 +1,119 @@
+package frontman
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// measurements not updated for this long are removed from /metrics, e.g. of deleted checks
+const prometheusValueTTL = time.Hour
+
+type prometheusKey struct {
+	checkUUID   string
+	checkType   string
+	measurement string
+}
+
+type prometheusValue struct {
+	value   float64
+	updated time.Time
+}
+
+// prometheusSink exposes the latest measurement of every check in the Prometheus text format
+type prometheusSink struct {
+	server   *http.Server
+	listener net.Listener
+
+	lock   sync.Mutex
+	values map[prometheusKey]prometheusValue
+}
+
+func newPrometheusSink(cfg *PrometheusOutputConfig) (*prometheusSink, error) {
+	s := &prometheusSink{values: make(map[prometheusKey]prometheusValue)}
+
+	path := cfg.Path
+	if path == "" {
+		path = "/metrics"
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, s)
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: %s", err)
+	}
+	s.listener = ln
+	s.server = &http.Server{Handler: mux}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("prometheus: %s", err)
+		}
+	}()
+	logrus.Infof("Exposing measurements for prometheus on http://%s%s", ln.Addr(), path)
+	return s, nil
+}
+
+func (s *prometheusSink) name() string {
+	return "prometheus"
+}
+
+func (s *prometheusSink) write(results []Result) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for _, res := range results {
+		for measurement, value := range numericMeasurements(res.Measurements) {
+			s.values[prometheusKey{res.CheckUUID, res.CheckType, measurement}] = prometheusValue{value, now}
+		}
+	}
+	return nil
+}
+
+func (s *prometheusSink) close() error {
+	return s.server.Close()
+}
+
+// escapes a label value of the text format
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (s *prometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	keys := make([]prometheusKey, 0, len(s.values))
+	for key, v := range s.values {
+		if time.Since(v.updated) > prometheusValueTTL {
+			delete(s.values, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].checkUUID != keys[j].checkUUID {
+			return keys[i].checkUUID < keys[j].checkUUID
+		}
+		return keys[i].measurement < keys[j].measurement
+	})
+
+	var b strings.Builder
+	b.WriteString("# HELP frontman_measurement Latest measurement of a check\n")
+	b.WriteString("# TYPE frontman_measurement gauge\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "frontman_measurement{check_uuid=\"%s\",check_type=\"%s\",measurement=\"%s\"} %s\n",
+			prometheusLabelEscaper.Replace(key.checkUUID),
+			prometheusLabelEscaper.Replace(key.checkType),
+			prometheusLabelEscaper.Replace(key.measurement),
+			strconv.FormatFloat(s.values[key].value, 'g', -1, 64))
+	}
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,371 @@
+package frontman
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func helperSinkResults() []Result {
+	return []Result{
+		{
+			CheckUUID: "tcp check",
+			CheckType: "serviceCheck",
+			Timestamp: 1600000000,
+			Measurements: map[string]interface{}{
+				"net.tcp.ssh.22.success":       1,
+				"net.tcp.ssh.22.connectTime_s": 0.25,
+			},
+		},
+		{
+			CheckUUID: "snmp",
+			CheckType: "snmpCheck",
+			Timestamp: 1600000001,
+			Measurements: map[string]interface{}{
+				"snmpCheck.oid.success": 1,
+				"1.3.6.1.2.1.1.5.0": map[string]interface{}{
+					"value": "router",
+					"delta": uint64(42),
+				},
+			},
+		},
+	}
+}
+
+func TestNumericMeasurements(t *testing.T) {
+	m := numericMeasurements(map[string]interface{}{
+		"int":    3,
+		"float":  1.5,
+		"bool":   true,
+		"string": "text",
+		"nested": MeasurementsMap{"count": uint(7)},
+	})
+	assert.Equal(t, map[string]float64{"int": 3, "float": 1.5, "bool": 1, "nested.count": 7}, m)
+}
+
+func TestPrometheusSink(t *testing.T) {
+	s, err := newPrometheusSink(&PrometheusOutputConfig{Listen: "127.0.0.1:0"})
+	require.Nil(t, err)
+	defer s.close()
+
+	require.Nil(t, s.write(helperSinkResults()))
+
+	resp, err := http.Get("http://" + s.listener.Addr().String() + "/metrics")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+
+	assert.Equal(t, `# HELP frontman_measurement Latest measurement of a check
+# TYPE frontman_measurement gauge
+frontman_measurement{check_uuid="snmp",check_type="snmpCheck",measurement="1.3.6.1.2.1.1.5.0.delta"} 42
+frontman_measurement{check_uuid="snmp",check_type="snmpCheck",measurement="snmpCheck.oid.success"} 1
+frontman_measurement{check_uuid="tcp check",check_type="serviceCheck",measurement="net.tcp.ssh.22.connectTime_s"} 0.25
+frontman_measurement{check_uuid="tcp check",check_type="serviceCheck",measurement="net.tcp.ssh.22.success"} 1
+`, string(body))
+}
+
+func TestInfluxDBSink(t *testing.T) {
+	var body, query, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		query = r.URL.RawQuery
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s := newInfluxDBSink(&InfluxDBOutputConfig{URL: server.URL + "/api/v2/write?bucket=frontman", Token: "secret"})
+	require.Nil(t, s.write(helperSinkResults()))
+
+	assert.Equal(t, "bucket=frontman&precision=s", query)
+	assert.Equal(t, "Token secret", auth)
+	assert.Equal(t, `frontman,check_uuid=tcp\ check,check_type=serviceCheck net.tcp.ssh.22.connectTime_s=0.25,net.tcp.ssh.22.success=1 1600000000
+frontman,check_uuid=snmp,check_type=snmpCheck 1.3.6.1.2.1.1.5.0.delta=42,snmpCheck.oid.success=1 1600000001
+`, body)
+}
+
+func TestGraphiteSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	s := newGraphiteSink(&GraphiteOutputConfig{Address: ln.Addr().String(), Prefix: "frontman"})
+	require.Nil(t, s.write(helperSinkResults()))
+
+	assert.Equal(t, `frontman.serviceCheck.tcp_check.net.tcp.ssh.22.connectTime_s 0.25 1600000000
+frontman.serviceCheck.tcp_check.net.tcp.ssh.22.success 1 1600000000
+frontman.snmpCheck.snmp.1.3.6.1.2.1.1.5.0.delta 42 1600000001
+frontman.snmpCheck.snmp.snmpCheck.oid.success 1 1600000001
+`, <-received)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	s, err := newFileSink(&FileOutputConfig{Path: path, MaxBytes: 300, MaxFiles: 2})
+	require.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.Nil(t, s.write(helperSinkResults()[:1]))
+	}
+	require.Nil(t, s.close())
+
+	readLines := func(path string) []string {
+		b, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+
+	lines := readLines(path)
+	var res Result
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &res))
+	assert.Equal(t, "tcp check", res.CheckUUID)
+
+	// each file keeps 300 bytes at most, only 2 rotated files are kept
+	total := len(lines)
+	for _, p := range []string{path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		require.Nil(t, err)
+		assert.True(t, fi.Size() <= 300)
+		total += len(readLines(p))
+	}
+	assert.True(t, total < 10)
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+// helperKafkaBroker serves a single broker cluster leading partition 0 of the topic "frontman".
+// The values of each produce request are sent to the channel, the requests are answered with errorCode
+func helperKafkaBroker(t *testing.T, errorCode int16) (string, chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	addr := ln.Addr().(*net.TCPAddr)
+
+	values := make(chan []string, 10)
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		for {
+			version, correlationID, _, msg, err := protocol.ReadRequest(conn)
+			if err != nil {
+				return
+			}
+
+			var resp protocol.Message
+			switch req := msg.(type) {
+			case *apiversions.Request:
+				resp = &apiversions.Response{ApiKeys: []apiversions.ApiKeyResponse{
+					{ApiKey: int16(protocol.Produce), MinVersion: 3, MaxVersion: 8},
+					{ApiKey: int16(protocol.Metadata), MinVersion: 1, MaxVersion: 8},
+				}}
+			case *metadata.Request:
+				resp = &metadata.Response{
+					Brokers:      []metadata.ResponseBroker{{NodeID: 1, Host: addr.IP.String(), Port: int32(addr.Port)}},
+					ControllerID: 1,
+					Topics: []metadata.ResponseTopic{{
+						Name:       "frontman",
+						Partitions: []metadata.ResponsePartition{{LeaderID: 1, ReplicaNodes: []int32{1}, IsrNodes: []int32{1}}},
+					}},
+				}
+			case *produce.Request:
+				var received []string
+				records := req.Topics[0].Partitions[0].RecordSet.Records
+				for {
+					record, err := records.ReadRecord()
+					if err != nil {
+						break
+					}
+					value, _ := kafka.ReadAll(record.Value)
+					received = append(received, string(value))
+				}
+				values <- received
+				if req.Acks == 0 {
+					// the broker doesn't respond
+					continue
+				}
+				resp = &produce.Response{Topics: []produce.ResponseTopic{{
+					Topic:      "frontman",
+					Partitions: []produce.ResponsePartition{{ErrorCode: errorCode}},
+				}}}
+			default:
+				return
+			}
+			if err := protocol.WriteResponse(conn, version, correlationID, resp); err != nil {
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return addr.String(), values
+}
+
+func TestKafkaSink(t *testing.T) {
+	addr, values := helperKafkaBroker(t, 0)
+	s, err := newKafkaSink(&KafkaOutputConfig{Broker: addr, Topic: "frontman", Acks: 1})
+	require.Nil(t, err)
+	defer s.close()
+
+	require.Nil(t, s.write(helperSinkResults()))
+
+	received := <-values
+	require.Len(t, received, 2)
+	var res Result
+	require.Nil(t, json.Unmarshal([]byte(received[1]), &res))
+	assert.Equal(t, "snmp", res.CheckUUID)
+
+	// without acknowledgement
+	s.acks = kafka.RequireNone
+	require.Nil(t, s.write(helperSinkResults()[:1]))
+	assert.Len(t, <-values, 1)
+
+	addr, _ = helperKafkaBroker(t, int16(kafka.NotLeaderForPartition))
+	s, err = newKafkaSink(&KafkaOutputConfig{Broker: addr, Topic: "frontman", Acks: -1})
+	require.Nil(t, err)
+	defer s.close()
+	err = s.write(helperSinkResults())
+	require.NotNil(t, err)
+	assert.True(t, errors.Is(err, kafka.NotLeaderForPartition))
+
+	s, err = newKafkaSink(&KafkaOutputConfig{Broker: addr, Topic: "frontman", Partition: 1, Acks: 1})
+	require.Nil(t, err)
+	defer s.close()
+	assert.NotNil(t, s.write(helperSinkResults()))
+
+	_, err = newKafkaSink(&KafkaOutputConfig{Broker: addr, Topic: "frontman", Acks: 2})
+	assert.EqualError(t, err, "kafka: invalid acks 2")
+}
+
+func TestNATSSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("INFO {\"server_id\":\"test\",\"auth_required\":true}\r\n"))
+
+		r := bufio.NewReader(conn)
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			if line == "PING" {
+				_, _ = conn.Write([]byte("PONG\r\n"))
+				received <- lines
+				return
+			}
+		}
+	}()
+
+	s, err := newNATSSink(&NATSOutputConfig{URL: "nats://user:secret@" + ln.Addr().String(), Subject: "results"})
+	require.Nil(t, err)
+	defer s.close()
+	require.Nil(t, s.write(helperSinkResults()[:1]))
+
+	lines := <-received
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "CONNECT "))
+	assert.Contains(t, lines[0], `"user":"user"`)
+	assert.Contains(t, lines[0], `"pass":"secret"`)
+	assert.True(t, strings.HasPrefix(lines[1], "PUB results "))
+	var res Result
+	require.Nil(t, json.Unmarshal([]byte(lines[2]), &res))
+	assert.Equal(t, "tcp check", res.CheckUUID)
+}
+
+func TestSinkFanOut(t *testing.T) {
+	dir := t.TempDir()
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.Outputs.File.Path = filepath.Join(dir, "a.jsonl")
+	cfg.Outputs.Prometheus.Listen = "127.0.0.1:0"
+	fm := helperCreateFrontman(t, cfg)
+	require.Len(t, fm.sinks, 2)
+	fm.startSinkWorkers()
+
+	for _, res := range helperSinkResults() {
+		fm.writeToSinks(res)
+	}
+
+	require.Eventually(t, func() bool {
+		b, _ := ioutil.ReadFile(cfg.Outputs.File.Path)
+		return strings.Count(string(b), "\n") == 2
+	}, time.Second, 10*time.Millisecond)
+
+	prometheus := fm.sinks[0].(*prometheusSink)
+	require.Eventually(t, func() bool {
+		prometheus.lock.Lock()
+		defer prometheus.lock.Unlock()
+		return len(prometheus.values) == 4
+	}, time.Second, 10*time.Millisecond)
+	fm.flushSinks(nil)
+}
+
+func TestSinkWorkersShutdown(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.Outputs.File.Path = filepath.Join(t.TempDir(), "a.jsonl")
+	fm := helperCreateFrontman(t, cfg)
+	require.Len(t, fm.sinks, 1)
+	fm.startSinkWorkers()
+
+	for _, res := range helperSinkResults() {
+		fm.writeToSinks(res)
+	}
+
+	// the queued results are written before the sink is closed
+	close(fm.InterruptChan)
+	fm.TerminateQueue.Wait()
+	b, err := ioutil.ReadFile(cfg.Outputs.File.Path)
+	require.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(b), "\n"))
+
+	// results after the shutdown are dropped
+	fm.writeToSinks(helperSinkResults()[0])
+	assert.Empty(t, fm.sinkWorkers)
+}
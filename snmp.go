@@ -1,8 +1,12 @@
 package frontman
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
 	"math"
+	"math/big"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -18,37 +22,16 @@ const (
 	protocolSNMPv3 = "v3"
 
 	maxRepetitions = 255
-)
-
-// used to calculate delta from last snmp bandwidth measure
-type snmpBandwidthMeasure struct {
-	timestamp   time.Time
-	name        string
-	ifOutOctets uint
-	ifInOctets  uint
-}
 
-type snmpOidDeltaMeasure struct {
-	timestamp time.Time
-	name      string
-	val       uint
-}
-
-type snmpPorterrorsMeasure struct {
-	timestamp         time.Time
-	name              string
-	ifInErrors        uint
-	ifOutErrors       uint
-	ifInDiscards      uint
-	ifOutDiscards     uint
-	ifInUnknownProtos uint
-}
+	// pause between the two polls of stateless checks
+	snmpSamplingInterval = 5 * time.Second
+)
 
 func (check SNMPCheck) uniqueID() string {
 	return check.UUID
 }
 
-func (check SNMPCheck) run(fm *Frontman) (*Result, error) {
+func (check SNMPCheck) run(ctx context.Context, fm *Frontman) (*Result, error) {
 
 	res := &Result{
 		Node:      fm.Config.NodeName,
@@ -65,33 +48,24 @@ func (check SNMPCheck) run(fm *Frontman) (*Result, error) {
 		return res, fmt.Errorf("missing check.connect key")
 	}
 
-	var done = make(chan map[string]interface{})
-	var err error
-	go func() {
-		var results map[string]interface{}
-		results, err = fm.runSNMPProbe(&check.Check)
-		successKey := "snmpCheck." + check.Check.Preset + ".success"
-		if err != nil {
-			results[successKey] = 0
-		} else {
-			results[successKey] = 1
-		}
-		done <- results
-	}()
+	ctx, cancel := context.WithTimeout(ctx, serviceCheckEmergencyTimeout)
+	defer cancel()
 
-	// Warning: do not rely on serviceCheckEmergencyTimeout as it leak goroutines(until it will be finished)
-	// instead use individual timeouts inside all checks
-	select {
-	case m := <-done:
-		res.Measurements = m
-		return res, err
-	case <-time.After(serviceCheckEmergencyTimeout):
-		logrus.Debugf("snmpCheck: %s got unexpected timeout after %.0fs", check.UUID, serviceCheckEmergencyTimeout.Seconds())
-		return res, fmt.Errorf("got unexpected timeout")
+	results, err := fm.runSNMPProbe(ctx, check.UUID, &check.Check, check.stateless)
+	successKey := "snmpCheck." + check.Check.Preset + ".success"
+	if err != nil {
+		err = contextError(ctx, err)
+		results[successKey] = 0
+	} else {
+		results[successKey] = 1
 	}
+	res.Measurements = results
+	return res, err
 }
 
-func (fm *Frontman) runSNMPProbe(check *SNMPCheckData) (map[string]interface{}, error) {
+// runSNMPProbe polls the device of the check.
+// If stateless is set no counter samples of previous runs are used, instead the device is polled twice for delta values
+func (fm *Frontman) runSNMPProbe(ctx context.Context, checkUUID string, check *SNMPCheckData, stateless bool) (map[string]interface{}, error) {
 
 	check.ValueType = strings.ToLower(check.ValueType)
 	if check.ValueType == "" {
@@ -108,14 +82,24 @@ func (fm *Frontman) runSNMPProbe(check *SNMPCheckData) (map[string]interface{},
 	if err != nil {
 		return m, fmt.Errorf("connect err: %v", err)
 	}
+	if control := fm.policy.dialControl(params.Target); control != nil {
+		// gosnmp dials without a net.Dialer, replace the connection by one the policy checked the address of
+		params.Conn.Close()
+		dialer := net.Dialer{Timeout: params.Timeout, Control: control}
+		params.Conn, err = dialer.DialContext(ctx, params.Transport, net.JoinHostPort(params.Target, strconv.Itoa(int(params.Port))))
+		if err != nil {
+			return m, fmt.Errorf("connect err: %v", err)
+		}
+	}
 	defer params.Conn.Close()
+	defer closeOnDone(ctx, params.Conn)()
 
-	// do a simple snmp probe to make sure we are authenticated (work around issue https://github.com/soniah/gosnmp/issues/196)
-	authRes, err := params.Get([]string{"1.3.6.1.2.1.1.1.0"})
+	uptime, err := snmpAuthProbe(params)
 	if err != nil {
-		return m, fmt.Errorf("get err: %v", err)
+		return m, err
 	}
-	if err := getErrorFromVariables(authRes.Variables); err != nil {
+
+	if err := fm.resolveSNMPCheckOids(check); err != nil {
 		return m, err
 	}
 
@@ -124,21 +108,93 @@ func (fm *Frontman) runSNMPProbe(check *SNMPCheckData) (map[string]interface{},
 		return m, err
 	}
 
+	scope := snmpCounterScope{
+		checkUUID: checkUUID,
+		device:    net.JoinHostPort(check.Connect, strconv.Itoa(int(check.Port))),
+		uptime:    uptime,
+	}
+
+	if stateless {
+		// don't keep samples between runs, deltas are taken from two polls of this run
+		scope.counters = newSNMPCounterStore("")
+		if check.usesCounters() {
+			packets, err := fetchSNMPPackets(params, oids, form)
+			if err != nil {
+				return m, err
+			}
+			if _, err := fm.prepareSNMPResult(scope, check, packets); err != nil {
+				return m, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return m, ctx.Err()
+			case <-time.After(snmpSamplingInterval):
+			}
+
+			if scope.uptime, err = snmpAuthProbe(params); err != nil {
+				return m, err
+			}
+		}
+	}
+
+	packets, err := fetchSNMPPackets(params, oids, form)
+	if err != nil {
+		return m, err
+	}
+	return fm.prepareSNMPResult(scope, check, packets)
+}
+
+// does a simple snmp probe to make sure we are authenticated (work around issue https://github.com/soniah/gosnmp/issues/196)
+// returns sysUpTime which is used to detect device restarts between two polls
+func snmpAuthProbe(params *gosnmp.GoSNMP) (uptime uint64, err error) {
+	authRes, err := params.Get([]string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0"})
+	if err != nil {
+		return 0, fmt.Errorf("get err: %v", err)
+	}
+	if err := getErrorFromVariables(authRes.Variables); err != nil {
+		return 0, err
+	}
+	for _, variable := range authRes.Variables {
+		if variable.Name == ".1.3.6.1.2.1.1.3.0" && variable.Type == gosnmp.TimeTicks {
+			uptime = gosnmp.ToBigInt(variable.Value).Uint64()
+		}
+	}
+	return uptime, nil
+}
+
+// polls the oids the way presetToOids returned.
+// GETBULK requests fall back to GETNEXT for SNMPv1 agents or if the agent fails to answer them
+func fetchSNMPPackets(params *gosnmp.GoSNMP, oids []string, form string) ([]gosnmp.SnmpPDU, error) {
 	var packets []gosnmp.SnmpPDU
 	switch form {
 	case "bulk":
-		logrus.Debugln("snmp: GetBulk", oids)
-		result, err := params.GetBulk(oids, uint8(len(oids)), maxRepetitions)
+		if params.Version != gosnmp.Version1 {
+			logrus.Debugln("snmp: GetBulk", oids)
+			nonRepeaters, maxReps := uint8(len(oids)), uint8(maxRepetitions)
+			if params.NonRepeaters > 0 {
+				nonRepeaters = uint8(params.NonRepeaters)
+			}
+			if params.MaxRepetitions > 0 {
+				maxReps = params.MaxRepetitions
+			}
+			result, err := params.GetBulk(oids, nonRepeaters, maxReps)
+			if err == nil {
+				return result.Variables, nil
+			}
+			logrus.Debugf("snmp: get bulk err: %v, falling back to GetNext", err)
+		}
+		logrus.Debugln("snmp: GetNext", oids)
+		result, err := params.GetNext(oids)
 		if err != nil {
-			return m, fmt.Errorf("get bulk err: %v", err)
+			return nil, fmt.Errorf("get next err: %v", err)
 		}
 		packets = result.Variables
 	case "walk":
 		for _, oid := range oids {
-			logrus.Debugln("snmp: BulkWalkAll", oid)
-			pdus, err := params.BulkWalkAll(oid)
+			pdus, err := snmpWalk(params, oid)
 			if err != nil {
-				return m, fmt.Errorf("bulk walk all err: %v", err)
+				return nil, err
 			}
 			packets = append(packets, pdus...)
 		}
@@ -146,12 +202,30 @@ func (fm *Frontman) runSNMPProbe(check *SNMPCheckData) (map[string]interface{},
 		logrus.Debugln("snmp: Get", oids)
 		result, err := params.Get(oids)
 		if err != nil {
-			return m, fmt.Errorf("get err: %v", err)
+			return nil, fmt.Errorf("get err: %v", err)
 		}
 		packets = append(packets, result.Variables...)
 	}
+	return packets, nil
+}
+
+// walks the subtree of oid with GETBULK, or GETNEXT if not supported
+func snmpWalk(params *gosnmp.GoSNMP, oid string) ([]gosnmp.SnmpPDU, error) {
+	if params.Version != gosnmp.Version1 {
+		logrus.Debugln("snmp: BulkWalkAll", oid)
+		pdus, err := params.BulkWalkAll(oid)
+		if err == nil {
+			return pdus, nil
+		}
+		logrus.Debugf("snmp: bulk walk all err: %v, falling back to WalkAll", err)
+	}
 
-	return fm.prepareSNMPResult(check, packets)
+	logrus.Debugln("snmp: WalkAll", oid)
+	pdus, err := params.WalkAll(oid)
+	if err != nil {
+		return nil, fmt.Errorf("walk all err: %v", err)
+	}
+	return pdus, nil
 }
 
 // getErrorFromVariables returns an error if any of the oid:s in the packets contains a recognized oid error
@@ -167,9 +241,17 @@ func getErrorFromVariables(packets []gosnmp.SnmpPDU) error {
 type snmpResult struct {
 	key string
 	val interface{}
+	typ gosnmp.Asn1BER
 }
 
-func (fm *Frontman) prepareSNMPResult(check *SNMPCheckData, packets []gosnmp.SnmpPDU) (map[string]interface{}, error) {
+func (fm *Frontman) prepareSNMPResult(scope snmpCounterScope, check *SNMPCheckData, packets []gosnmp.SnmpPDU) (map[string]interface{}, error) {
+	if check.Preset == "table" {
+		return fm.prepareSNMPTableResult(scope, check, packets)
+	}
+	if preset, ok := snmpPresets[check.Preset]; ok {
+		return preset.prepareResult(packets)
+	}
+
 	res := make(map[int][]snmpResult)
 	for _, variable := range packets {
 		if err := oidToError(variable.Name); err != nil {
@@ -204,9 +286,18 @@ func (fm *Frontman) prepareSNMPResult(check *SNMPCheckData, packets []gosnmp.Snm
 			}
 			res[suffix] = append(res[suffix], snmpResult{key: prefix, val: val})
 
-		case gosnmp.TimeTicks, gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32:
+		case gosnmp.Integer:
+			if check.Preset == "oid" && check.ValueType == "raw" {
+				if enum, ok := fm.snmpEnumValue(variable.Name, variable.Value.(int)); ok {
+					res[suffix] = append(res[suffix], snmpResult{key: prefix, val: enum})
+					break
+				}
+			}
 			res[suffix] = append(res[suffix], snmpResult{key: prefix, val: variable.Value})
 
+		case gosnmp.TimeTicks, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.Counter64:
+			res[suffix] = append(res[suffix], snmpResult{key: prefix, val: variable.Value, typ: variable.Type})
+
 		case gosnmp.Null:
 			res[suffix] = append(res[suffix], snmpResult{key: prefix, val: ""})
 
@@ -217,7 +308,7 @@ func (fm *Frontman) prepareSNMPResult(check *SNMPCheckData, packets []gosnmp.Snm
 			logrus.Debugf("SNMP unhandled return type %#v for %s: %d", variable.Type, prefix, variable.Value)
 		}
 	}
-	return fm.filterSNMPResult(check, res)
+	return fm.filterSNMPResult(scope, check, res)
 }
 
 const (
@@ -225,17 +316,6 @@ const (
 	ifTypeEthernetCsmacd = 6
 )
 
-// returns true if snmpResult is part of a network interface that should be excluded
-func (kv snmpResult) shouldExcludeInterface() bool {
-	if kv.key == "ifOperStatus" && kv.val.(int) != ifOperStatusUp {
-		return true
-	}
-	if kv.key == "ifType" && kv.val.(int) != ifTypeEthernetCsmacd {
-		return true
-	}
-	return false
-}
-
 type jsonFloat64 float64
 
 func (value jsonFloat64) MarshalJSON() ([]byte, error) {
@@ -246,53 +326,31 @@ func (value jsonFloat64) MarshalJSON() ([]byte, error) {
 }
 
 // filters the snmp results according to preset
-func (fm *Frontman) filterSNMPResult(check *SNMPCheckData, res map[int][]snmpResult) (map[string]interface{}, error) {
+func (fm *Frontman) filterSNMPResult(scope snmpCounterScope, check *SNMPCheckData, res map[int][]snmpResult) (map[string]interface{}, error) {
 	m := make(map[string]interface{})
+
+	filter, err := check.InterfaceFilter.matcher()
+	if err != nil {
+		return m, fmt.Errorf("interface_filter: %s", err)
+	}
+
 	switch check.Preset {
 	case "bandwidth":
-		prevMeasures := fm.previousSNMPBandwidthMeasure
-		fm.previousSNMPBandwidthMeasure = nil
 		for idx, iface := range res {
-			skip := false
-			for _, kv := range iface {
-				if kv.shouldExcludeInterface() {
-					if kv.key == "ifOperStatus" && kv.val.(int) != ifOperStatusUp {
-						logrus.Debug("Excluding interface ", idx, " since status is ", kv.val)
-					}
-					if kv.key == "ifType" && kv.val.(int) != ifTypeEthernetCsmacd {
-						logrus.Debug("Excluding interface ", idx, " since type is ", kv.val)
-					}
-					skip = true
-					break
-				}
-			}
-			if skip {
+			if reason := filter.exclude(idx, iface); reason != "" {
+				logrus.Debug("Excluding interface ", idx, " since ", reason)
 				continue
 			}
-			m[fmt.Sprint(idx)] = fm.filterSNMPBandwidthResult(idx, iface, prevMeasures)
+			m[fmt.Sprint(idx)] = fm.filterSNMPBandwidthResult(scope, idx, iface)
 		}
 
 	case "porterrors":
-		prevMeasures := fm.previousSNMPPorterrorsMeasure
-		fm.previousSNMPPorterrorsMeasure = nil
 		for idx, iface := range res {
-			skip := false
-			for _, kv := range iface {
-				if kv.shouldExcludeInterface() {
-					if kv.key == "ifOperStatus" && kv.val.(int) != ifOperStatusUp {
-						logrus.Debug("Excluding interface ", idx, " since status is ", kv.val)
-					}
-					if kv.key == "ifType" && kv.val.(int) != ifTypeEthernetCsmacd {
-						logrus.Debug("Excluding interface ", idx, " since type is ", kv.val)
-					}
-					skip = true
-					break
-				}
-			}
-			if skip {
+			if reason := filter.exclude(idx, iface); reason != "" {
+				logrus.Debug("Excluding interface ", idx, " since ", reason)
 				continue
 			}
-			m[fmt.Sprint(idx)] = fm.filterSNMPPorterrorsResult(idx, iface, prevMeasures)
+			m[fmt.Sprint(idx)] = fm.filterSNMPPorterrorsResult(scope, idx, iface)
 		}
 
 	case "oid":
@@ -301,7 +359,7 @@ func (fm *Frontman) filterSNMPResult(check *SNMPCheckData, res map[int][]snmpRes
 		} else {
 			for idx := range res {
 				for _, r := range res[idx] {
-					m[r.key] = fm.filterSNMPOidDeltaResult(check, r)
+					m[r.key] = fm.filterSNMPOidDeltaResult(scope, check, r)
 					break
 				}
 			}
@@ -319,7 +377,7 @@ func (fm *Frontman) filterSNMPResult(check *SNMPCheckData, res map[int][]snmpRes
 	return m, nil
 }
 
-func (fm *Frontman) filterSNMPOidDeltaResult(check *SNMPCheckData, r snmpResult) map[string]interface{} {
+func (fm *Frontman) filterSNMPOidDeltaResult(scope snmpCounterScope, check *SNMPCheckData, r snmpResult) map[string]interface{} {
 	m := make(map[string]interface{})
 
 	// pass-through values for easy consumption by frontend
@@ -327,175 +385,142 @@ func (fm *Frontman) filterSNMPOidDeltaResult(check *SNMPCheckData, r snmpResult)
 	m["oid"] = check.Oid
 	m["value_type"] = check.ValueType
 	m["unit"] = check.Unit
+	if name, ok := fm.snmpOidName(check.Oid); ok {
+		m["oid_name"] = name
+	}
 
 	if check.ValueType == "raw" || check.ValueType == "hex" {
 		m["value"] = r.val.(string)
 		return m
 	}
 
-	prevMeasures := fm.previousSNMPOidDeltaMeasure
-	fm.previousSNMPOidDeltaMeasure = nil
+	val, _ := new(big.Float).SetInt(gosnmp.ToBigInt(r.val)).Float64()
 
-	val := r.val.(uint)
+	// calculate delta from previous measure
+	d, delaySeconds, ok := fm.updateSNMPCounter(scope, check.Oid, val, snmpCounterBits(r.typ))
+	if !ok {
+		return m
+	}
 
 	switch check.ValueType {
 	case "delta":
-		// calculate delta from previous measure
-		for _, measure := range prevMeasures {
-			if measure.name == check.Oid {
-				m["value"] = jsonFloat64(deltaFloat(float64(measure.val), float64(val)))
-				break
-			}
-		}
+		m["value"] = jsonFloat64(d)
 	case "delta_per_sec":
-		// calculate delta per second from previous measure
-		for _, measure := range prevMeasures {
-			if measure.name == check.Oid {
-				delaySeconds := float64(time.Since(measure.timestamp) / time.Second)
-				delta := deltaFloat(float64(measure.val), float64(val))
-				m["value"] = jsonFloat64(delta / delaySeconds)
-				break
-			}
-		}
+		m["value"] = jsonFloat64(d / delaySeconds)
 	default:
 		logrus.Warnf("snmpCheck: invalid value_type '%s'", check.ValueType)
 	}
 
-	fm.previousSNMPOidDeltaMeasure = append(fm.previousSNMPOidDeltaMeasure, snmpOidDeltaMeasure{
-		timestamp: time.Now(),
-		name:      check.Oid,
-		val:       val,
-	})
-
 	return m
 }
 
-func (fm *Frontman) filterSNMPBandwidthResult(idx int, iface []snmpResult, prevMeasures []snmpBandwidthMeasure) map[string]interface{} {
+// traffic counters of the bandwidth preset, the 64-bit variant is used if the agent supports it
+var snmpBandwidthCounters = []struct {
+	name      string
+	counter   string
+	hcCounter string
+}{
+	{"ifIn_Bps", "ifInOctets", "ifHCInOctets"},
+	{"ifOut_Bps", "ifOutOctets", "ifHCOutOctets"},
+	{"ifInUcast_pps", "ifInUcastPkts", "ifHCInUcastPkts"},
+	{"ifOutUcast_pps", "ifOutUcastPkts", "ifHCOutUcastPkts"},
+	{"ifInMulticast_pps", "ifInMulticastPkts", "ifHCInMulticastPkts"},
+	{"ifOutMulticast_pps", "ifOutMulticastPkts", "ifHCOutMulticastPkts"},
+	{"ifInBroadcast_pps", "ifInBroadcastPkts", "ifHCInBroadcastPkts"},
+	{"ifOutBroadcast_pps", "ifOutBroadcastPkts", "ifHCOutBroadcastPkts"},
+}
+
+func (fm *Frontman) filterSNMPBandwidthResult(scope snmpCounterScope, idx int, iface []snmpResult) map[string]interface{} {
 	m := make(map[string]interface{})
 
-	ifIn := uint(0)
-	ifOut := uint(0)
-	ifName := ""
-	ifSpeedInBytes := uint(0)
+	counters := make(map[string]snmpResult)
+	ifSpeed := uint(0)
+	ifHighSpeed := uint(0)
 	for _, x := range iface {
 		key := x.key
 		switch x.key {
-		case "ifOperStatus", "ifType":
+		case "ifHighSpeed":
+			// megabits, reported as ifSpeed_mbps
+			ifHighSpeed = x.val.(uint)
 			continue
-		case "ifName":
-			ifName = x.val.(string)
-		case "ifInOctets":
-			ifIn = x.val.(uint)
-		case "ifOutOctets":
-			ifOut = x.val.(uint)
 		case "ifSpeed":
 			key = "ifSpeed_mbps"
-			if x.val.(uint) > 0 {
-				x.val = x.val.(uint) / 1000000 // megabits
-				ifSpeedInBytes = (x.val.(uint) * 1000000) / 8
+			ifSpeed = x.val.(uint)
+			x.val = ifSpeed / 1000000 // megabits
+		default:
+			if snmpCounterBits(x.typ) > 0 {
+				counters[x.key] = x
 			}
 		}
 		m[key] = x.val
 	}
 	m["ifIndex"] = idx
 
-	// calculate delta from previous measure
-	for _, measure := range prevMeasures {
-		if measure.name == ifName {
-			delaySeconds := float64(time.Since(measure.timestamp)) / float64(time.Second)
-			inDelta := float64(delta(measure.ifInOctets, ifIn))
-			outDelta := float64(delta(measure.ifOutOctets, ifOut))
-			m["ifIn_Bps"] = jsonFloat64(math.Round(inDelta / delaySeconds))
-			m["ifOut_Bps"] = jsonFloat64(math.Round(outDelta / delaySeconds))
-			if ifSpeedInBytes > 0 {
-				inPct := (inDelta / (float64(ifSpeedInBytes) * delaySeconds)) * 100
-				outPct := (outDelta / (float64(ifSpeedInBytes) * delaySeconds)) * 100
-				m["ifInUtilization_percent"] = jsonFloat64(math.Round(inPct*100) / 100)
-				m["ifOutUtilization_percent"] = jsonFloat64(math.Round(outPct*100) / 100)
+	// ifSpeed is capped at 4294967295 for interfaces faster than 4 Gbit/s
+	if ifHighSpeed > 0 {
+		m["ifSpeed_mbps"] = ifHighSpeed
+		ifSpeed = ifHighSpeed * 1000000
+	}
+	ifSpeedInBytes := float64(ifSpeed) / 8
+
+	_, hcIn := counters["ifHCInOctets"]
+	_, hcOut := counters["ifHCOutOctets"]
+	if hcIn && hcOut {
+		m["ifCounterBits"] = 64
+	} else {
+		m["ifCounterBits"] = 32
+	}
+
+	// calculate delta per second from previous measure
+	for _, c := range snmpBandwidthCounters {
+		x, ok := counters[c.hcCounter]
+		if !ok {
+			if x, ok = counters[c.counter]; !ok {
+				continue
 			}
-			break
 		}
-	}
 
-	fm.previousSNMPBandwidthMeasure = append(fm.previousSNMPBandwidthMeasure, snmpBandwidthMeasure{
-		timestamp:   time.Now(),
-		name:        ifName,
-		ifInOctets:  ifIn,
-		ifOutOctets: ifOut,
-	})
+		val, _ := new(big.Float).SetInt(gosnmp.ToBigInt(x.val)).Float64()
+		d, delaySeconds, ok := fm.updateSNMPCounter(scope, fmt.Sprintf("%s.%d", x.key, idx), val, snmpCounterBits(x.typ))
+		if !ok {
+			continue
+		}
+		m[c.name] = jsonFloat64(math.Round(d / delaySeconds))
+
+		if ifSpeedInBytes > 0 && (c.name == "ifIn_Bps" || c.name == "ifOut_Bps") {
+			pct := (d / (ifSpeedInBytes * delaySeconds)) * 100
+			m[strings.Replace(c.name, "_Bps", "Utilization_percent", 1)] = jsonFloat64(math.Round(pct*100) / 100)
+		}
+	}
 
 	return m
 }
 
-func (fm *Frontman) filterSNMPPorterrorsResult(idx int, iface []snmpResult, prevMeasures []snmpPorterrorsMeasure) map[string]interface{} {
+func (fm *Frontman) filterSNMPPorterrorsResult(scope snmpCounterScope, idx int, iface []snmpResult) map[string]interface{} {
 	m := make(map[string]interface{})
 
-	ifInErrors := uint(0)
-	ifOutErrors := uint(0)
-	ifInDiscards := uint(0)
-	ifOutDiscards := uint(0)
-	ifInUnknownProtos := uint(0)
-	ifName := ""
-
+	counters := make(map[string]uint)
 	for _, x := range iface {
-		key := x.key
 		switch x.key {
-		case "ifOperStatus", "ifType":
-			continue
-		case "ifName":
-			ifName = x.val.(string)
-		case "ifInErrors":
-			ifInErrors = x.val.(uint)
-		case "ifOutErrors":
-			ifOutErrors = x.val.(uint)
-		case "ifInDiscards":
-			ifInDiscards = x.val.(uint)
-		case "ifOutDiscards":
-			ifOutDiscards = x.val.(uint)
-		case "ifInUnknownProtos":
-			ifInUnknownProtos = x.val.(uint)
+		case "ifInErrors", "ifOutErrors", "ifInDiscards", "ifOutDiscards", "ifInUnknownProtos":
+			counters[x.key] = x.val.(uint)
 		}
-		m[key] = x.val
+		m[x.key] = x.val
 	}
 	m["ifIndex"] = idx
 
-	// calculate delta from previous measure
-	for _, measure := range prevMeasures {
-		if measure.name == ifName {
-			delaySeconds := float64(time.Since(measure.timestamp)) / float64(time.Second)
-			inErrorsDelta := float64(delta(measure.ifInErrors, ifInErrors))
-			outErrorsDelta := float64(delta(measure.ifOutErrors, ifOutErrors))
-			m["ifInErrors_delta"] = uint(math.Round(inErrorsDelta / delaySeconds))
-			m["ifOutErrors_delta"] = uint(math.Round(outErrorsDelta / delaySeconds))
-
-			inDiscardsDelta := float64(delta(measure.ifInDiscards, ifInDiscards))
-			outDiscardsDelta := float64(delta(measure.ifOutDiscards, ifOutDiscards))
-			m["ifInDiscards_delta"] = uint(math.Round(inDiscardsDelta / delaySeconds))
-			m["ifOutDiscards_delta"] = uint(math.Round(outDiscardsDelta / delaySeconds))
-
-			inUnknownProtosDelta := float64(delta(measure.ifInUnknownProtos, ifInUnknownProtos))
-			m["ifInUnknownProtos_delta"] = uint(math.Round(inUnknownProtosDelta / delaySeconds))
-			break
-		}
-	}
-
-	fm.previousSNMPPorterrorsMeasure = append(fm.previousSNMPPorterrorsMeasure, snmpPorterrorsMeasure{
-		timestamp:         time.Now(),
-		name:              ifName,
-		ifInErrors:        ifInErrors,
-		ifOutErrors:       ifOutErrors,
-		ifInDiscards:      ifInDiscards,
-		ifOutDiscards:     ifOutDiscards,
-		ifInUnknownProtos: ifInUnknownProtos,
-	})
-	return m
-}
-
-func delta(v1, v2 uint) uint {
-	if v1 < v2 {
-		return v2 - v1
+	// calculate delta per second from previous measure
+	for _, key := range []string{"ifInErrors", "ifOutErrors", "ifInDiscards", "ifOutDiscards", "ifInUnknownProtos"} {
+		val, ok := counters[key]
+		if !ok {
+			continue
+		}
+		d, delaySeconds, ok := fm.updateSNMPCounter(scope, fmt.Sprintf("%s.%d", key, idx), float64(val), 32)
+		if ok {
+			m[key+"_delta"] = uint(math.Round(d / delaySeconds))
+		}
 	}
-	return v1 - v2
+	return m
 }
 
 func deltaFloat(v1, v2 float64) float64 {
@@ -510,10 +535,22 @@ func buildSNMPParameters(check *SNMPCheckData) (*gosnmp.GoSNMP, error) {
 	if check.Timeout < 5 {
 		check.Timeout = 5
 	}
+	if check.Retries < 0 {
+		return nil, fmt.Errorf("invalid retries %d", check.Retries)
+	}
+	if check.MaxRepetitions < 0 || check.MaxRepetitions > math.MaxUint8 {
+		return nil, fmt.Errorf("max_repetitions must be between 1 and %d", math.MaxUint8)
+	}
+	if check.NonRepeaters < 0 || check.NonRepeaters > math.MaxUint8 {
+		return nil, fmt.Errorf("non_repeaters must be between 0 and %d", math.MaxUint8)
+	}
 	params := &gosnmp.GoSNMP{
-		Target:  check.Connect,
-		Port:    check.Port,
-		Timeout: time.Duration(check.Timeout) * time.Second,
+		Target:         check.Connect,
+		Port:           check.Port,
+		Timeout:        time.Duration(check.Timeout) * time.Second,
+		Retries:        check.Retries,
+		MaxRepetitions: uint8(check.MaxRepetitions),
+		NonRepeaters:   check.NonRepeaters,
 	}
 	switch check.Protocol {
 	case protocolSNMPv1:
@@ -540,6 +577,14 @@ func buildSNMPParameters(check *SNMPCheckData) (*gosnmp.GoSNMP, error) {
 		default:
 			return nil, fmt.Errorf("invalid security_level configuration value '%s'", check.SecurityLevel)
 		}
+		params.ContextName = check.ContextName
+		if check.ContextEngineID != "" {
+			engineID, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(check.ContextEngineID), "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid context_engine_id: %s", err)
+			}
+			params.ContextEngineID = string(engineID)
+		}
 	default:
 		return nil, fmt.Errorf("invalid protocol '%s'", check.Protocol)
 	}
@@ -652,6 +697,8 @@ func oidToHumanReadable(name string) (prefix string, suffix int, err error) {
 	// IF-MIB
 	case ".1.3.6.1.2.1.2.2.1.8":
 		prefix = "ifOperStatus"
+	case ".1.3.6.1.2.1.2.2.1.7":
+		prefix = "ifAdminStatus"
 	case ".1.3.6.1.2.1.2.2.1.3":
 		prefix = "ifType"
 	case ".1.3.6.1.2.1.31.1.1.1.1":
@@ -678,6 +725,34 @@ func oidToHumanReadable(name string) (prefix string, suffix int, err error) {
 		prefix = "ifOutDiscards"
 	case ".1.3.6.1.2.1.2.2.1.15":
 		prefix = "ifInUnknownProtos"
+	case ".1.3.6.1.2.1.2.2.1.11":
+		prefix = "ifInUcastPkts"
+	case ".1.3.6.1.2.1.2.2.1.17":
+		prefix = "ifOutUcastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.2":
+		prefix = "ifInMulticastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.3":
+		prefix = "ifInBroadcastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.4":
+		prefix = "ifOutMulticastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.5":
+		prefix = "ifOutBroadcastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.6":
+		prefix = "ifHCInOctets"
+	case ".1.3.6.1.2.1.31.1.1.1.7":
+		prefix = "ifHCInUcastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.8":
+		prefix = "ifHCInMulticastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.9":
+		prefix = "ifHCInBroadcastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.10":
+		prefix = "ifHCOutOctets"
+	case ".1.3.6.1.2.1.31.1.1.1.11":
+		prefix = "ifHCOutUcastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.12":
+		prefix = "ifHCOutMulticastPkts"
+	case ".1.3.6.1.2.1.31.1.1.1.13":
+		prefix = "ifHCOutBroadcastPkts"
 
 	default:
 		prefix = name
@@ -686,6 +761,23 @@ func oidToHumanReadable(name string) (prefix string, suffix int, err error) {
 	return
 }
 
+// returns true if the check reports values calculated from the previous sample
+func (check *SNMPCheckData) usesCounters() bool {
+	switch check.Preset {
+	case "bandwidth", "porterrors":
+		return true
+	case "oid":
+		return check.ValueType == "delta" || check.ValueType == "delta_per_sec"
+	case "table":
+		for _, col := range check.Columns {
+			if col.ValueType == "delta" || col.ValueType == "delta_per_sec" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // returns a collection of oids for the given preset
 func (check *SNMPCheckData) presetToOids() (oids []string, form string, err error) {
 	switch check.Preset {
@@ -700,33 +792,73 @@ func (check *SNMPCheckData) presetToOids() (oids []string, form string, err erro
 		form = "single"
 	case "bandwidth":
 		oids = []string{
-			".1.3.6.1.2.1.2.2.1.8",    // IF-MIB::ifOperStatus (1=up)
-			".1.3.6.1.2.1.2.2.1.3",    // IF-MIB::ifType (6=ethernetCsmacd)
-			".1.3.6.1.2.1.31.1.1.1.1", // IF-MIB::ifName
-			".1.3.6.1.2.1.2.2.1.2",    // IF-MIB::ifDescr
-			".1.3.6.1.2.1.2.2.1.5",    // IF-MIB::ifSpeed
-			".1.3.6.1.2.1.2.2.1.10",   // IF-MIB::ifInOctets
-			".1.3.6.1.2.1.2.2.1.16",   // IF-MIB::ifOutOctets
+			".1.3.6.1.2.1.2.2.1.8",     // IF-MIB::ifOperStatus (1=up)
+			".1.3.6.1.2.1.2.2.1.7",     // IF-MIB::ifAdminStatus (1=up)
+			".1.3.6.1.2.1.2.2.1.3",     // IF-MIB::ifType (6=ethernetCsmacd)
+			".1.3.6.1.2.1.31.1.1.1.1",  // IF-MIB::ifName
+			".1.3.6.1.2.1.2.2.1.2",     // IF-MIB::ifDescr
+			".1.3.6.1.2.1.31.1.1.1.18", // IF-MIB::ifAlias
+			".1.3.6.1.2.1.2.2.1.5",     // IF-MIB::ifSpeed
+			".1.3.6.1.2.1.2.2.1.10",    // IF-MIB::ifInOctets
+			".1.3.6.1.2.1.2.2.1.16",    // IF-MIB::ifOutOctets
+			".1.3.6.1.2.1.2.2.1.11",    // IF-MIB::ifInUcastPkts
+			".1.3.6.1.2.1.2.2.1.17",    // IF-MIB::ifOutUcastPkts
+			".1.3.6.1.2.1.31.1.1.1.2",  // IF-MIB::ifInMulticastPkts
+			".1.3.6.1.2.1.31.1.1.1.3",  // IF-MIB::ifInBroadcastPkts
+			".1.3.6.1.2.1.31.1.1.1.4",  // IF-MIB::ifOutMulticastPkts
+			".1.3.6.1.2.1.31.1.1.1.5",  // IF-MIB::ifOutBroadcastPkts
+		}
+		if check.Protocol != protocolSNMPv1 {
+			// Counter64 is not available in SNMPv1
+			oids = append(oids,
+				".1.3.6.1.2.1.31.1.1.1.15", // IF-MIB::ifHighSpeed
+				".1.3.6.1.2.1.31.1.1.1.6",  // IF-MIB::ifHCInOctets
+				".1.3.6.1.2.1.31.1.1.1.10", // IF-MIB::ifHCOutOctets
+				".1.3.6.1.2.1.31.1.1.1.7",  // IF-MIB::ifHCInUcastPkts
+				".1.3.6.1.2.1.31.1.1.1.11", // IF-MIB::ifHCOutUcastPkts
+				".1.3.6.1.2.1.31.1.1.1.8",  // IF-MIB::ifHCInMulticastPkts
+				".1.3.6.1.2.1.31.1.1.1.12", // IF-MIB::ifHCOutMulticastPkts
+				".1.3.6.1.2.1.31.1.1.1.9",  // IF-MIB::ifHCInBroadcastPkts
+				".1.3.6.1.2.1.31.1.1.1.13", // IF-MIB::ifHCOutBroadcastPkts
+			)
 		}
 		form = "walk"
 	case "oid":
 		oids = []string{check.Oid}
 		form = "single"
 
+	case "table":
+		if err = check.prepareTableColumns(); err != nil {
+			return
+		}
+		for _, col := range check.Columns {
+			oids = append(oids, col.Oid)
+		}
+		form = "walk"
+
 	case "porterrors":
 		oids = []string{
-			".1.3.6.1.2.1.2.2.1.8",    // IF-MIB::ifOperStatus (1=up)
-			".1.3.6.1.2.1.2.2.1.3",    // IF-MIB::ifType (6=ethernetCsmacd)
-			".1.3.6.1.2.1.31.1.1.1.1", // IF-MIB::ifName
-			".1.3.6.1.2.1.2.2.1.14",   // IF-MIB::ifInErrors
-			".1.3.6.1.2.1.2.2.1.20",   // IF-MIB::ifOutErrors
-			".1.3.6.1.2.1.2.2.1.13",   // IF-MIB::ifInDiscards
-			".1.3.6.1.2.1.2.2.1.19",   // IF-MIB::ifOutDiscards
-			".1.3.6.1.2.1.2.2.1.15",   // IF-MIB::ifInUnknownProtos
+			".1.3.6.1.2.1.2.2.1.8",     // IF-MIB::ifOperStatus (1=up)
+			".1.3.6.1.2.1.2.2.1.7",     // IF-MIB::ifAdminStatus (1=up)
+			".1.3.6.1.2.1.2.2.1.3",     // IF-MIB::ifType (6=ethernetCsmacd)
+			".1.3.6.1.2.1.31.1.1.1.1",  // IF-MIB::ifName
+			".1.3.6.1.2.1.2.2.1.2",     // IF-MIB::ifDescr
+			".1.3.6.1.2.1.31.1.1.1.18", // IF-MIB::ifAlias
+			".1.3.6.1.2.1.2.2.1.14",    // IF-MIB::ifInErrors
+			".1.3.6.1.2.1.2.2.1.20",    // IF-MIB::ifOutErrors
+			".1.3.6.1.2.1.2.2.1.13",    // IF-MIB::ifInDiscards
+			".1.3.6.1.2.1.2.2.1.19",    // IF-MIB::ifOutDiscards
+			".1.3.6.1.2.1.2.2.1.15",    // IF-MIB::ifInUnknownProtos
 		}
 		form = "walk"
 	default:
-		err = fmt.Errorf("unrecognized preset %s", check.Preset)
+		preset, ok := snmpPresets[check.Preset]
+		if !ok {
+			err = fmt.Errorf("unrecognized preset %s", check.Preset)
+			return
+		}
+		oids = preset.oids()
+		form = preset.form
 	}
 	return
 }
@@ -0,0 +1,163 @@
+package frontman
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// SNMPInterfaceFilter selects the interfaces reported by the "bandwidth" and "porterrors" presets.
+// Criteria left empty don't restrict the interfaces.
+// Without a filter only interfaces of type ethernetCsmacd with oper status up are reported
+type SNMPInterfaceFilter struct {
+	IncludeTypes   []int    `json:"include_types,omitempty"`   // IANAifType, e.g. 6 (ethernetCsmacd), 161 (ieee8023adLag), 135 (l2vlan)
+	ExcludeTypes   []int    `json:"exclude_types,omitempty"`   // IANAifType
+	IncludeName    string   `json:"include_name,omitempty"`    // regular expression matched against ifName, ifDescr and ifAlias
+	ExcludeName    string   `json:"exclude_name,omitempty"`    // regular expression matched against ifName, ifDescr and ifAlias
+	AdminStatus    []string `json:"admin_status,omitempty"`    // up, down, testing
+	OperStatus     []string `json:"oper_status,omitempty"`     // up, down, testing, unknown, dormant, notPresent, lowerLayerDown
+	IncludeIndexes []int    `json:"include_indexes,omitempty"` // ifIndex
+	ExcludeIndexes []int    `json:"exclude_indexes,omitempty"` // ifIndex
+}
+
+// IF-MIB ifAdminStatus and ifOperStatus values
+var snmpIfStatus = map[string]int{
+	"up":             1,
+	"down":           2,
+	"testing":        3,
+	"unknown":        4,
+	"dormant":        5,
+	"notPresent":     6,
+	"lowerLayerDown": 7,
+}
+
+type snmpInterfaceMatcher struct {
+	includeTypes   map[int]bool
+	excludeTypes   map[int]bool
+	includeName    *regexp.Regexp
+	excludeName    *regexp.Regexp
+	adminStatus    map[int]bool
+	operStatus     map[int]bool
+	includeIndexes map[int]bool
+	excludeIndexes map[int]bool
+}
+
+// used if the check has no interface filter
+var defaultSNMPInterfaceMatcher = &snmpInterfaceMatcher{
+	includeTypes: map[int]bool{ifTypeEthernetCsmacd: true},
+	operStatus:   map[int]bool{ifOperStatusUp: true},
+}
+
+func intSet(values []int) map[int]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[int]bool)
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func ifStatusSet(names []string) (map[int]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	set := make(map[int]bool)
+	for _, name := range names {
+		v, ok := snmpIfStatus[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown interface status '%s'", name)
+		}
+		set[v] = true
+	}
+	return set, nil
+}
+
+// validates the filter and prepares it for matching
+func (f *SNMPInterfaceFilter) matcher() (*snmpInterfaceMatcher, error) {
+	if f == nil {
+		return defaultSNMPInterfaceMatcher, nil
+	}
+
+	var err error
+	m := &snmpInterfaceMatcher{
+		includeTypes:   intSet(f.IncludeTypes),
+		excludeTypes:   intSet(f.ExcludeTypes),
+		includeIndexes: intSet(f.IncludeIndexes),
+		excludeIndexes: intSet(f.ExcludeIndexes),
+	}
+	if f.IncludeName != "" {
+		if m.includeName, err = regexp.Compile(f.IncludeName); err != nil {
+			return nil, fmt.Errorf("invalid include_name: %s", err)
+		}
+	}
+	if f.ExcludeName != "" {
+		if m.excludeName, err = regexp.Compile(f.ExcludeName); err != nil {
+			return nil, fmt.Errorf("invalid exclude_name: %s", err)
+		}
+	}
+	if m.adminStatus, err = ifStatusSet(f.AdminStatus); err != nil {
+		return nil, fmt.Errorf("admin_status: %s", err)
+	}
+	if m.operStatus, err = ifStatusSet(f.OperStatus); err != nil {
+		return nil, fmt.Errorf("oper_status: %s", err)
+	}
+	return m, nil
+}
+
+// returns why the interface is excluded, empty if it should be reported.
+// Values the agent didn't return don't exclude the interface
+func (m *snmpInterfaceMatcher) exclude(idx int, iface []snmpResult) string {
+	if m.includeIndexes != nil && !m.includeIndexes[idx] {
+		return "index is not included"
+	}
+	if m.excludeIndexes[idx] {
+		return "index is excluded"
+	}
+
+	var names []string
+	for _, kv := range iface {
+		switch kv.key {
+		case "ifType":
+			ifType, _ := kv.val.(int)
+			if m.includeTypes != nil && !m.includeTypes[ifType] || m.excludeTypes[ifType] {
+				return fmt.Sprintf("type is %d", ifType)
+			}
+		case "ifAdminStatus":
+			status, _ := kv.val.(int)
+			if m.adminStatus != nil && !m.adminStatus[status] {
+				return fmt.Sprintf("admin status is %d", status)
+			}
+		case "ifOperStatus":
+			status, _ := kv.val.(int)
+			if m.operStatus != nil && !m.operStatus[status] {
+				return fmt.Sprintf("status is %d", status)
+			}
+		case "ifName", "ifDescr", "ifAlias":
+			if name, ok := kv.val.(string); ok && name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if m.includeName != nil {
+		matched := false
+		for _, name := range names {
+			if m.includeName.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "name doesn't match include_name"
+		}
+	}
+	if m.excludeName != nil {
+		for _, name := range names {
+			if m.excludeName.MatchString(name) {
+				return fmt.Sprintf("name '%s' matches exclude_name", name)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package frontman
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/frontman/pkg/mib"
+)
+
+// loads the MIB files from Config.SNMPMIBDir, errors are logged so checks with numeric OIDs keep working
+func (fm *Frontman) loadSNMPMIBs() {
+	fm.mibs = mib.NewStore()
+	if fm.Config.SNMPMIBDir == "" {
+		return
+	}
+
+	if err := fm.mibs.LoadDir(fm.Config.SNMPMIBDir); err != nil {
+		logrus.Errorf("snmp: failed to load some MIBs from %s: %s", fm.Config.SNMPMIBDir, err)
+	}
+	logrus.Debugf("snmp: %d MIB objects loaded from %s", fm.mibs.Len(), fm.Config.SNMPMIBDir)
+}
+
+// returns true if oid is given by name, e.g. IF-MIB::ifHCInOctets.1
+func isSymbolicOid(oid string) bool {
+	return strings.IndexFunc(oid, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	}) != -1
+}
+
+// translates symbolic oids of the check to numeric ones
+func (fm *Frontman) resolveSNMPCheckOids(check *SNMPCheckData) error {
+	if fm.mibs == nil {
+		return nil
+	}
+
+	if isSymbolicOid(check.Oid) {
+		oid, err := fm.mibs.Resolve(check.Oid)
+		if err != nil {
+			return fmt.Errorf("oid: %s", err)
+		}
+		check.Oid = oid
+	}
+
+	// the columns are shared with the queued check and its result
+	check.Columns = append([]SNMPTableColumn(nil), check.Columns...)
+	for i := range check.Columns {
+		col := &check.Columns[i]
+		if isSymbolicOid(col.Oid) {
+			oid, err := fm.mibs.Resolve(col.Oid)
+			if err != nil {
+				return fmt.Errorf("column %d: %s", i, err)
+			}
+			col.Oid = oid
+		}
+		if col.Name == "" {
+			// label the column by the name of its MIB object
+			if node, suffix, ok := fm.mibs.Lookup(col.Oid); ok && suffix == "" {
+				col.Name = node.Name
+			}
+		}
+	}
+	return nil
+}
+
+// returns the textual value of an enumerated INTEGER object, e.g. "up" for ifOperStatus 1
+func (fm *Frontman) snmpEnumValue(oid string, val int) (string, bool) {
+	if fm.mibs == nil {
+		return "", false
+	}
+	node, _, ok := fm.mibs.Lookup(oid)
+	if !ok || node.Enums == nil {
+		return "", false
+	}
+	name, ok := node.Enums[val]
+	return name, ok
+}
+
+// returns the MIB name of the oid, e.g. IF-MIB::ifOperStatus.1
+func (fm *Frontman) snmpOidName(oid string) (string, bool) {
+	if fm.mibs == nil {
+		return "", false
+	}
+	node, suffix, ok := fm.mibs.Lookup(oid)
+	if !ok || node.Module == "SNMPv2-SMI" && suffix != "" {
+		// only the well-known tree nodes matched, e.g. enterprises
+		return "", false
+	}
+	return node.Module + "::" + node.Name + suffix, true
+}
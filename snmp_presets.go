@@ -0,0 +1,423 @@
+package frontman
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/soniah/gosnmp"
+)
+
+// column or scalar polled by a host resources or environment preset
+type snmpPresetColumn struct {
+	oid  string
+	name string
+}
+
+// preset based on standard MIBs, the polled values are grouped by row index before being prepared
+type snmpPreset struct {
+	columns []snmpPresetColumn
+	form    string
+	result  func(rows map[int]map[string]interface{}) map[string]interface{}
+}
+
+var snmpPresets = map[string]snmpPreset{
+	"cpu": {
+		columns: []snmpPresetColumn{
+			{".1.3.6.1.2.1.25.3.3.1.2", "hrProcessorLoad"}, // HOST-RESOURCES-MIB::hrProcessorLoad
+		},
+		form:   "walk",
+		result: snmpCPUResult,
+	},
+	"storage": {
+		columns: snmpHrStorageColumns,
+		form:    "walk",
+		result:  snmpStorageResult,
+	},
+	"memory": {
+		columns: append([]snmpPresetColumn{
+			{".1.3.6.1.2.1.25.2.2", "hrMemorySize"}, // HOST-RESOURCES-MIB::hrMemorySize (KBytes)
+		}, snmpHrStorageColumns...),
+		form:   "walk",
+		result: snmpMemoryResult,
+	},
+	"processes": {
+		columns: []snmpPresetColumn{
+			{".1.3.6.1.2.1.25.1.5", "hrSystemNumUsers"},     // HOST-RESOURCES-MIB::hrSystemNumUsers
+			{".1.3.6.1.2.1.25.1.6", "hrSystemProcesses"},    // HOST-RESOURCES-MIB::hrSystemProcesses
+			{".1.3.6.1.2.1.25.1.7", "hrSystemMaxProcesses"}, // HOST-RESOURCES-MIB::hrSystemMaxProcesses (0=no limit)
+		},
+		form:   "single",
+		result: snmpProcessesResult,
+	},
+	"loadavg": {
+		columns: []snmpPresetColumn{
+			{".1.3.6.1.4.1.2021.10.1.3", "laLoad"}, // UCD-SNMP-MIB::laLoad (1=1min, 2=5min, 3=15min)
+		},
+		form:   "walk",
+		result: snmpLoadAvgResult,
+	},
+	"sensors": {
+		columns: []snmpPresetColumn{
+			{".1.3.6.1.2.1.47.1.1.1.1.7", "entPhysicalName"},        // ENTITY-MIB::entPhysicalName
+			{".1.3.6.1.2.1.99.1.1.1.1", "entPhySensorType"},         // ENTITY-SENSOR-MIB::entPhySensorType
+			{".1.3.6.1.2.1.99.1.1.1.2", "entPhySensorScale"},        // ENTITY-SENSOR-MIB::entPhySensorScale
+			{".1.3.6.1.2.1.99.1.1.1.3", "entPhySensorPrecision"},    // ENTITY-SENSOR-MIB::entPhySensorPrecision
+			{".1.3.6.1.2.1.99.1.1.1.4", "entPhySensorValue"},        // ENTITY-SENSOR-MIB::entPhySensorValue
+			{".1.3.6.1.2.1.99.1.1.1.5", "entPhySensorOperStatus"},   // ENTITY-SENSOR-MIB::entPhySensorOperStatus
+			{".1.3.6.1.2.1.99.1.1.1.6", "entPhySensorUnitsDisplay"}, // ENTITY-SENSOR-MIB::entPhySensorUnitsDisplay
+		},
+		form:   "walk",
+		result: snmpSensorsResult,
+	},
+	"ups": {
+		columns: []snmpPresetColumn{
+			{".1.3.6.1.2.1.33.1.2.1", "upsBatteryStatus"},             // UPS-MIB::upsBatteryStatus
+			{".1.3.6.1.2.1.33.1.2.2", "upsSecondsOnBattery"},          // UPS-MIB::upsSecondsOnBattery
+			{".1.3.6.1.2.1.33.1.2.3", "upsEstimatedMinutesRemaining"}, // UPS-MIB::upsEstimatedMinutesRemaining
+			{".1.3.6.1.2.1.33.1.2.4", "upsEstimatedChargeRemaining"},  // UPS-MIB::upsEstimatedChargeRemaining (percent)
+			{".1.3.6.1.2.1.33.1.2.5", "upsBatteryVoltage"},            // UPS-MIB::upsBatteryVoltage (0.1 Volt DC)
+			{".1.3.6.1.2.1.33.1.2.7", "upsBatteryTemperature"},        // UPS-MIB::upsBatteryTemperature (degrees Centigrade)
+			{".1.3.6.1.2.1.33.1.4.1", "upsOutputSource"},              // UPS-MIB::upsOutputSource
+		},
+		form:   "single",
+		result: snmpUPSResult,
+	},
+}
+
+var snmpHrStorageColumns = []snmpPresetColumn{
+	{".1.3.6.1.2.1.25.2.3.1.2", "hrStorageType"},            // HOST-RESOURCES-MIB::hrStorageType
+	{".1.3.6.1.2.1.25.2.3.1.3", "hrStorageDescr"},           // HOST-RESOURCES-MIB::hrStorageDescr
+	{".1.3.6.1.2.1.25.2.3.1.4", "hrStorageAllocationUnits"}, // HOST-RESOURCES-MIB::hrStorageAllocationUnits (Bytes)
+	{".1.3.6.1.2.1.25.2.3.1.5", "hrStorageSize"},            // HOST-RESOURCES-MIB::hrStorageSize
+	{".1.3.6.1.2.1.25.2.3.1.6", "hrStorageUsed"},            // HOST-RESOURCES-MIB::hrStorageUsed
+}
+
+// HOST-RESOURCES-TYPES::hrStorageTypes
+const (
+	hrStorageRam           = ".1.3.6.1.2.1.25.2.1.2"
+	hrStorageVirtualMemory = ".1.3.6.1.2.1.25.2.1.3"
+	hrStorageFixedDisk     = ".1.3.6.1.2.1.25.2.1.4"
+	hrStorageRemovableDisk = ".1.3.6.1.2.1.25.2.1.5"
+	hrStorageFlashMemory   = ".1.3.6.1.2.1.25.2.1.9"
+	hrStorageNetworkDisk   = ".1.3.6.1.2.1.25.2.1.10"
+)
+
+const entPhySensorOperStateOK = 1
+
+// returns the oids to poll for a preset of snmpPresets
+func (p snmpPreset) oids() []string {
+	var oids []string
+	for _, col := range p.columns {
+		if p.form == "single" {
+			oids = append(oids, col.oid+".0")
+		} else {
+			oids = append(oids, col.oid)
+		}
+	}
+	return oids
+}
+
+// groups the packets by row index and passes them to the result function of the preset
+func (p snmpPreset) prepareResult(packets []gosnmp.SnmpPDU) (map[string]interface{}, error) {
+	rows := make(map[int]map[string]interface{})
+	for _, variable := range packets {
+		if err := oidToError(variable.Name); err != nil {
+			return make(map[string]interface{}), err
+		}
+
+		for _, col := range p.columns {
+			if !strings.HasPrefix(variable.Name, col.oid+".") {
+				continue
+			}
+			idx, err := strconv.Atoi(variable.Name[len(col.oid)+1:])
+			if err != nil {
+				break
+			}
+
+			var val interface{}
+			switch variable.Type {
+			case gosnmp.OctetString:
+				val = string(variable.Value.([]byte))
+			case gosnmp.ObjectIdentifier:
+				val = variable.Value.(string)
+			case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Counter64, gosnmp.Uinteger32:
+				val, _ = new(big.Float).SetInt(gosnmp.ToBigInt(variable.Value)).Float64()
+			case gosnmp.OpaqueFloat:
+				val = float64(variable.Value.(float32))
+			case gosnmp.OpaqueDouble:
+				val = variable.Value.(float64)
+			default:
+				// NoSuchObject, NoSuchInstance and other types without a value
+				logrus.Debugf("SNMP unhandled return type %#v for %s: %v", variable.Type, variable.Name, variable.Value)
+			}
+			if val == nil {
+				break
+			}
+
+			if rows[idx] == nil {
+				rows[idx] = make(map[string]interface{})
+			}
+			rows[idx][col.name] = val
+			break
+		}
+	}
+	return p.result(rows), nil
+}
+
+func rowFloat(row map[string]interface{}, key string) (float64, bool) {
+	v, ok := row[key].(float64)
+	return v, ok
+}
+
+func rowString(row map[string]interface{}, key string) string {
+	v, _ := row[key].(string)
+	return v
+}
+
+func roundPercent(v float64) jsonFloat64 {
+	return jsonFloat64(math.Round(v*100) / 100)
+}
+
+func snmpCPUResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	sum := float64(0)
+	count := 0
+	for idx, row := range rows {
+		load, ok := rowFloat(row, "hrProcessorLoad")
+		if !ok {
+			continue
+		}
+		m[fmt.Sprint(idx)] = map[string]interface{}{
+			"hrDeviceIndex": idx,
+			"load_percent":  jsonFloat64(load),
+		}
+		sum += load
+		count++
+	}
+	if count > 0 {
+		m["average"] = map[string]interface{}{
+			"load_percent": roundPercent(sum / float64(count)),
+			"processors":   count,
+		}
+	}
+	return m
+}
+
+// returns size and usage in bytes of a hrStorageTable row
+func hrStorageUsage(row map[string]interface{}) (total, used float64, ok bool) {
+	units, ok1 := rowFloat(row, "hrStorageAllocationUnits")
+	size, ok2 := rowFloat(row, "hrStorageSize")
+	usedUnits, ok3 := rowFloat(row, "hrStorageUsed")
+	if !ok1 || !ok2 || !ok3 {
+		return 0, 0, false
+	}
+	return size * units, usedUnits * units, true
+}
+
+func snmpStorageResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for idx, row := range rows {
+		switch rowString(row, "hrStorageType") {
+		case hrStorageFixedDisk, hrStorageRemovableDisk, hrStorageFlashMemory, hrStorageNetworkDisk:
+		default:
+			continue
+		}
+
+		total, used, ok := hrStorageUsage(row)
+		if !ok {
+			continue
+		}
+		r := map[string]interface{}{
+			"hrStorageIndex": idx,
+			"descr":          rowString(row, "hrStorageDescr"),
+			"total_B":        jsonFloat64(total),
+			"used_B":         jsonFloat64(used),
+			"free_B":         jsonFloat64(total - used),
+		}
+		if total > 0 {
+			r["used_percent"] = roundPercent(used / total * 100)
+		}
+		m[fmt.Sprint(idx)] = r
+	}
+	return m
+}
+
+func snmpMemoryResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, row := range rows {
+		if size, ok := rowFloat(row, "hrMemorySize"); ok {
+			m["memory.total_B"] = jsonFloat64(size * 1024)
+			continue
+		}
+
+		var prefix string
+		switch rowString(row, "hrStorageType") {
+		case hrStorageRam:
+			prefix = "memory.ram."
+		case hrStorageVirtualMemory:
+			prefix = "memory.virtual."
+		default:
+			continue
+		}
+
+		total, used, ok := hrStorageUsage(row)
+		if !ok {
+			continue
+		}
+		m[prefix+"total_B"] = jsonFloat64(total)
+		m[prefix+"used_B"] = jsonFloat64(used)
+		m[prefix+"free_B"] = jsonFloat64(total - used)
+		if total > 0 {
+			m[prefix+"used_percent"] = roundPercent(used / total * 100)
+		}
+	}
+	return m
+}
+
+func snmpProcessesResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	row := rows[0]
+	if v, ok := rowFloat(row, "hrSystemProcesses"); ok {
+		m["system.processes"] = uint(v)
+	}
+	if v, ok := rowFloat(row, "hrSystemMaxProcesses"); ok {
+		m["system.max_processes"] = uint(v)
+	}
+	if v, ok := rowFloat(row, "hrSystemNumUsers"); ok {
+		m["system.users"] = uint(v)
+	}
+	return m
+}
+
+func snmpLoadAvgResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for idx, key := range map[int]string{1: "load.1m", 2: "load.5m", 3: "load.15m"} {
+		// laLoad is a DisplayString like "0.12"
+		v, err := strconv.ParseFloat(strings.TrimSpace(rowString(rows[idx], "laLoad")), 64)
+		if err != nil {
+			continue
+		}
+		m[key] = jsonFloat64(v)
+	}
+	return m
+}
+
+// ENTITY-SENSOR-MIB::EntitySensorDataType
+var entPhySensorTypes = map[int]string{
+	1:  "other",
+	2:  "unknown",
+	3:  "voltsAC",
+	4:  "voltsDC",
+	5:  "amperes",
+	6:  "watts",
+	7:  "hertz",
+	8:  "celsius",
+	9:  "percentRH",
+	10: "rpm",
+	11: "cmm",
+	12: "truthvalue",
+}
+
+// ENTITY-SENSOR-MIB::EntitySensorStatus
+var entPhySensorStatus = map[int]string{
+	1: "ok",
+	2: "unavailable",
+	3: "nonoperational",
+}
+
+// returns the power of ten of a ENTITY-SENSOR-MIB::EntitySensorDataScale value
+func entPhySensorExponent(scale int) int {
+	switch {
+	case scale >= 1 && scale <= 13:
+		// yocto(1) ... units(9) ... tera(13)
+		return (scale - 9) * 3
+	case scale == 14: // exa
+		return 18
+	case scale == 15: // peta
+		return 15
+	case scale == 16: // zetta
+		return 21
+	case scale == 17: // yotta
+		return 24
+	}
+	return 0
+}
+
+func snmpSensorsResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for idx, row := range rows {
+		sensorType, ok := rowFloat(row, "entPhySensorType")
+		if !ok {
+			// physical entity without a sensor
+			continue
+		}
+
+		r := map[string]interface{}{
+			"entPhysicalIndex": idx,
+			"name":             rowString(row, "entPhysicalName"),
+			"type":             entPhySensorTypes[int(sensorType)],
+			"unit":             rowString(row, "entPhySensorUnitsDisplay"),
+		}
+		status, _ := rowFloat(row, "entPhySensorOperStatus")
+		r["status"] = entPhySensorStatus[int(status)]
+
+		if val, ok := rowFloat(row, "entPhySensorValue"); ok && int(status) == entPhySensorOperStateOK {
+			scale, _ := rowFloat(row, "entPhySensorScale")
+			precision, _ := rowFloat(row, "entPhySensorPrecision")
+			exp := entPhySensorExponent(int(scale)) - int(precision)
+			r["value"] = jsonFloat64(val * math.Pow10(exp))
+		}
+		m[fmt.Sprint(idx)] = r
+	}
+	return m
+}
+
+// UPS-MIB::upsBatteryStatus
+var upsBatteryStatus = map[int]string{
+	1: "unknown",
+	2: "batteryNormal",
+	3: "batteryLow",
+	4: "batteryDepleted",
+}
+
+// UPS-MIB::upsOutputSource
+var upsOutputSource = map[int]string{
+	1: "other",
+	2: "none",
+	3: "normal",
+	4: "bypass",
+	5: "battery",
+	6: "booster",
+	7: "reducer",
+}
+
+func snmpUPSResult(rows map[int]map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	row := rows[0]
+	if v, ok := rowFloat(row, "upsBatteryStatus"); ok {
+		m["ups.battery.status"] = upsBatteryStatus[int(v)]
+	}
+	if v, ok := rowFloat(row, "upsSecondsOnBattery"); ok {
+		m["ups.battery.on_battery_s"] = uint(v)
+	}
+	if v, ok := rowFloat(row, "upsEstimatedMinutesRemaining"); ok {
+		m["ups.battery.remaining_min"] = uint(v)
+	}
+	if v, ok := rowFloat(row, "upsEstimatedChargeRemaining"); ok {
+		m["ups.battery.charge_percent"] = uint(v)
+	}
+	if v, ok := rowFloat(row, "upsBatteryVoltage"); ok {
+		m["ups.battery.voltage_V"] = jsonFloat64(v / 10)
+	}
+	if v, ok := rowFloat(row, "upsBatteryTemperature"); ok {
+		m["ups.battery.temperature_C"] = jsonFloat64(v)
+	}
+	if v, ok := rowFloat(row, "upsOutputSource"); ok {
+		m["ups.output.source"] = upsOutputSource[int(v)]
+	}
+	return m
+}
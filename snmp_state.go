@@ -0,0 +1,213 @@
+package frontman
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/soniah/gosnmp"
+)
+
+// counters not updated for this long are dropped from the state file
+const snmpCounterStateTTL = 24 * time.Hour
+
+// interval to write the counter state to Config.SNMPStateFile
+const snmpCounterStateWriteInterval = 30 * time.Second
+
+// identifies the device polled by a check, counters of different scopes never mix
+type snmpCounterScope struct {
+	checkUUID string
+	device    string
+	uptime    uint64            // sysUpTime in hundredths of a second, 0 if unknown
+	counters  *snmpCounterStore // keeps the samples instead of Frontman.snmpCounters if set
+}
+
+func (scope snmpCounterScope) key(name string) string {
+	return scope.checkUUID + "/" + scope.device + "/" + name
+}
+
+// last sample of a counter
+type snmpCounter struct {
+	Value     float64   `json:"value"`
+	Uptime    uint64    `json:"uptime"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// keeps the previous samples of SNMP counters to calculate deltas, optionally persisted to a file
+type snmpCounterStore struct {
+	path string
+
+	lock     sync.Mutex
+	counters map[string]snmpCounter
+	dirty    bool
+}
+
+func newSNMPCounterStore(path string) *snmpCounterStore {
+	return &snmpCounterStore{
+		path:     path,
+		counters: make(map[string]snmpCounter),
+	}
+}
+
+// returns the counter width of a snmp type, 0 for values which are not counters
+func snmpCounterBits(typ gosnmp.Asn1BER) uint {
+	switch typ {
+	case gosnmp.Counter32:
+		return 32
+	case gosnmp.Counter64:
+		return 64
+	}
+	return 0
+}
+
+// update stores the value and returns the difference to the previous sample and the seconds passed since then.
+// ok is false if there is no previous sample or the device was rebooted or the counter was reset in between.
+// bits is the counter width used to handle wraps, 0 if value is not a counter
+func (s *snmpCounterStore) update(scope snmpCounterScope, name string, value float64, bits uint) (delta, seconds float64, ok bool) {
+	key := scope.key(name)
+	now := time.Now()
+
+	s.lock.Lock()
+	prev, exists := s.counters[key]
+	s.counters[key] = snmpCounter{Value: value, Uptime: scope.uptime, Timestamp: now}
+	s.dirty = true
+	s.lock.Unlock()
+
+	if !exists {
+		return 0, 0, false
+	}
+
+	seconds = float64(now.Sub(prev.Timestamp)) / float64(time.Second)
+	if seconds <= 0 {
+		return 0, 0, false
+	}
+
+	if scope.uptime > 0 && prev.Uptime > scope.uptime && !snmpUptimeWrapped(prev.Uptime, scope.uptime, seconds) {
+		logrus.Debugf("snmp: %s was restarted, resetting counter %s", scope.device, name)
+		return 0, 0, false
+	}
+
+	if bits == 0 {
+		return deltaFloat(prev.Value, value), seconds, true
+	}
+
+	if value >= prev.Value {
+		return value - prev.Value, seconds, true
+	}
+
+	// counter wrapped, unless the distance is implausible which means it has been reset
+	delta = math.Pow(2, float64(bits)) - prev.Value + value
+	if delta > math.Pow(2, float64(bits-1)) {
+		logrus.Debugf("snmp: counter %s of %s was reset", name, scope.device)
+		return 0, 0, false
+	}
+	return delta, seconds, true
+}
+
+// snmpUptimeWrapped returns true if a smaller sysUpTime is explained by the 32-bit TimeTicks wrap (every 497 days)
+// rather than a reboot, i.e. it matches the previous uptime advanced by the seconds passed in between
+func snmpUptimeWrapped(prev, cur uint64, seconds float64) bool {
+	expected := float64(prev) + seconds*100 - math.Pow(2, 32)
+	// allow for the latency of the polls and clock drift
+	tolerance := math.Max(seconds*100/10, 6000)
+	return math.Abs(expected-float64(cur)) <= tolerance
+}
+
+// updates the counter in the store of the scope, see snmpCounterStore.update
+func (fm *Frontman) updateSNMPCounter(scope snmpCounterScope, name string, value float64, bits uint) (delta, seconds float64, ok bool) {
+	store := scope.counters
+	if store == nil {
+		store = fm.snmpCounters
+	}
+	return store.update(scope, name, value, bits)
+}
+
+// load reads the counter state file, a missing file is not an error
+func (s *snmpCounterStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	counters := make(map[string]snmpCounter)
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return fmt.Errorf("failed to decode %s: %s", s.path, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, c := range counters {
+		if time.Since(c.Timestamp) < snmpCounterStateTTL {
+			s.counters[key] = c
+		}
+	}
+	return nil
+}
+
+// save writes the counter state file if there were updates since the last call
+func (s *snmpCounterStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.lock.Lock()
+	if !s.dirty {
+		s.lock.Unlock()
+		return nil
+	}
+	for key, c := range s.counters {
+		if time.Since(c.Timestamp) >= snmpCounterStateTTL {
+			delete(s.counters, key)
+		}
+	}
+	data, err := json.Marshal(s.counters)
+	s.dirty = false
+	s.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first to not leave a truncated state behind
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// writes the snmp counter state periodically, used in continuous mode.
+// Once frontman is interrupted the state is written a last time before TerminateQueue is done
+func (fm *Frontman) startSNMPCounterStateWriter() {
+	fm.TerminateQueue.Add(1)
+	go func() {
+		defer fm.TerminateQueue.Done()
+		for {
+			select {
+			case <-fm.InterruptChan:
+				fm.writeSNMPCounterState()
+				return
+			case <-time.After(snmpCounterStateWriteInterval):
+				fm.writeSNMPCounterState()
+			}
+		}
+	}()
+}
+
+func (fm *Frontman) writeSNMPCounterState() {
+	if err := fm.snmpCounters.save(); err != nil {
+		logrus.Errorf("Could not write snmp state file: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+package frontman
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/soniah/gosnmp"
+)
+
+// SNMPTableColumn describes one column of a table walked by the "table" preset
+type SNMPTableColumn struct {
+	Oid       string `json:"oid"`
+	Name      string `json:"name"`
+	ValueType string `json:"value_type,omitempty"` // raw (default), hex, delta, delta_per_sec
+	Unit      string `json:"unit,omitempty"`
+}
+
+// validates the "table" preset columns and normalizes their oids and value types.
+// The columns are copied first, the slice is shared with the queued check and its result
+func (check *SNMPCheckData) prepareTableColumns() error {
+	if len(check.Columns) == 0 {
+		return fmt.Errorf("table preset requires at least one column")
+	}
+	check.Columns = append([]SNMPTableColumn(nil), check.Columns...)
+
+	labelColumnFound := check.LabelColumn == ""
+	seenOids := make(map[string]bool)
+	for i := range check.Columns {
+		col := &check.Columns[i]
+		if col.Oid == "" {
+			return fmt.Errorf("column %d: missing oid", i)
+		}
+		if col.Name == "" {
+			return fmt.Errorf("column %d: missing name", i)
+		}
+		if !strings.HasPrefix(col.Oid, ".") {
+			col.Oid = "." + col.Oid
+		}
+		col.Oid = strings.TrimSuffix(col.Oid, ".")
+		if seenOids[col.Oid] {
+			return fmt.Errorf("column '%s': duplicate oid %s", col.Name, col.Oid)
+		}
+		seenOids[col.Oid] = true
+
+		col.ValueType = strings.ToLower(col.ValueType)
+		switch col.ValueType {
+		case "":
+			col.ValueType = "raw"
+		case "raw", "hex", "delta", "delta_per_sec":
+		default:
+			return fmt.Errorf("column '%s': invalid value_type '%s'", col.Name, col.ValueType)
+		}
+
+		if col.Name == check.LabelColumn {
+			labelColumnFound = true
+		}
+	}
+	if !labelColumnFound {
+		return fmt.Errorf("label_column '%s' doesn't match any column name", check.LabelColumn)
+	}
+	return nil
+}
+
+// returns the column matching the oid and the row index, false if the oid doesn't belong to the table
+func (check *SNMPCheckData) tableColumnForOid(oid string) (*SNMPTableColumn, string, bool) {
+	var found *SNMPTableColumn
+	for i := range check.Columns {
+		col := &check.Columns[i]
+		if strings.HasPrefix(oid, col.Oid+".") && (found == nil || len(col.Oid) > len(found.Oid)) {
+			found = col
+		}
+	}
+	if found == nil {
+		return nil, "", false
+	}
+	return found, oid[len(found.Oid)+1:], true
+}
+
+// converts a snmp value according to value_type, returns false if the type can't be represented
+func snmpTableValue(col *SNMPTableColumn, variable gosnmp.SnmpPDU) (interface{}, bool) {
+	switch variable.Type {
+	case gosnmp.OctetString:
+		if col.ValueType == "hex" {
+			val := fmt.Sprintf("% x", variable.Value.([]byte))
+			return strings.ReplaceAll(val, " ", ":"), true
+		}
+		return string(variable.Value.([]byte)), true
+	case gosnmp.TimeTicks, gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.Counter64, gosnmp.Uinteger32:
+		return variable.Value, true
+	case gosnmp.OpaqueFloat, gosnmp.OpaqueDouble, gosnmp.IPAddress, gosnmp.ObjectIdentifier:
+		return variable.Value, true
+	case gosnmp.Null:
+		return "", true
+	}
+	return nil, false
+}
+
+// prepares the result of the "table" preset, one entry per row index.
+// The unit of a column is set as "<name>.unit" next to its value
+func (fm *Frontman) prepareSNMPTableResult(scope snmpCounterScope, check *SNMPCheckData, packets []gosnmp.SnmpPDU) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	rows := make(map[string]map[string]interface{})
+
+	for _, variable := range packets {
+		if err := oidToError(variable.Name); err != nil {
+			return make(map[string]interface{}), err
+		}
+
+		col, idx, ok := check.tableColumnForOid(variable.Name)
+		if !ok {
+			continue
+		}
+
+		val, ok := snmpTableValue(col, variable)
+		if !ok {
+			logrus.Debugf("SNMP unhandled return type %#v for %s: %v", variable.Type, variable.Name, variable.Value)
+			continue
+		}
+
+		if col.ValueType == "raw" && variable.Type == gosnmp.Integer {
+			if enum, ok := fm.snmpEnumValue(col.Oid, variable.Value.(int)); ok {
+				val = enum
+			}
+		}
+
+		if col.ValueType == "delta" || col.ValueType == "delta_per_sec" {
+			val = fm.snmpTableDelta(scope, col, variable)
+			if val == nil {
+				// first measure, no previous value to compare with
+				continue
+			}
+		}
+
+		row, ok := rows[idx]
+		if !ok {
+			row = map[string]interface{}{
+				"index": idx,
+			}
+			rows[idx] = row
+			m[idx] = row
+		}
+		row[col.Name] = val
+		if col.Unit != "" {
+			row[col.Name+".unit"] = col.Unit
+		}
+		if col.Name == check.LabelColumn {
+			row["label"] = fmt.Sprint(val)
+		}
+	}
+
+	return m, nil
+}
+
+// calculates the delta of a counter column from the previous measure, nil if there is none
+func (fm *Frontman) snmpTableDelta(scope snmpCounterScope, col *SNMPTableColumn, variable gosnmp.SnmpPDU) interface{} {
+	val, _ := new(big.Float).SetInt(gosnmp.ToBigInt(variable.Value)).Float64()
+
+	d, delaySeconds, ok := fm.updateSNMPCounter(scope, variable.Name, val, snmpCounterBits(variable.Type))
+	if !ok {
+		return nil
+	}
+	if col.ValueType == "delta_per_sec" {
+		return jsonFloat64(d / delaySeconds)
+	}
+	return jsonFloat64(d)
+}
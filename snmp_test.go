@@ -4,10 +4,20 @@ package frontman
 // $ FRONTMAN_SNMPD_IP="172.16.72.169" FRONTMAN_SNMPD_COMMUNITY=public go test -v -run TestSNMP
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/soniah/gosnmp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -565,7 +575,1060 @@ func TestOidToHumanReadable(t *testing.T) {
 	assert.Equal(t, "ifOperStatus", v)
 }
 
-func TestDelta(t *testing.T) {
-	assert.Equal(t, uint(1), delta(1, 2))
-	assert.Equal(t, uint(1), delta(2, 1))
+func TestSNMPUptimeWrapped(t *testing.T) {
+	// polled every 5 minutes
+	assert.True(t, snmpUptimeWrapped(math.MaxUint32-10000, 20000, 300))
+	assert.True(t, snmpUptimeWrapped(math.MaxUint32-10000, 25000, 300))
+	// rebooted 2 minutes ago
+	assert.False(t, snmpUptimeWrapped(math.MaxUint32-10000, 12000, 300))
+	// rebooted long before the wrap was due
+	assert.False(t, snmpUptimeWrapped(1000000, 20000, 300))
+	// polled once a day
+	assert.True(t, snmpUptimeWrapped(math.MaxUint32-100, 8640000, 86400))
+	assert.False(t, snmpUptimeWrapped(math.MaxUint32-100, 100000, 86400))
+}
+
+func TestSNMPCounterStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontman.snmpstate")
+	store := newSNMPCounterStore(path)
+	device1 := snmpCounterScope{checkUUID: "check1", device: "10.0.0.1:161", uptime: 1000}
+	device2 := snmpCounterScope{checkUUID: "check1", device: "10.0.0.2:161", uptime: 1000}
+
+	_, _, ok := store.update(device1, "ifInOctets.1", 100, 32)
+	assert.False(t, ok)
+	_, _, ok = store.update(device2, "ifInOctets.1", 5000, 32)
+	assert.False(t, ok)
+
+	d, seconds, ok := store.update(device1, "ifInOctets.1", 150, 32)
+	assert.True(t, ok)
+	assert.Equal(t, float64(50), d)
+	assert.True(t, seconds > 0)
+
+	// gauges report the absolute difference
+	store.update(device1, "hrStorageUsed.1", 100, 0)
+	d, _, _ = store.update(device1, "hrStorageUsed.1", 80, 0)
+	assert.Equal(t, float64(20), d)
+
+	// 32 bit counter wrapped
+	store.update(device1, "ifOutOctets.1", math.MaxUint32-9, 32)
+	d, _, ok = store.update(device1, "ifOutOctets.1", 10, 32)
+	assert.True(t, ok)
+	assert.Equal(t, float64(20), d)
+
+	// a large decrease is a reset and not a wrap
+	store.update(device1, "ifOutOctets.1", 1000, 32)
+	_, _, ok = store.update(device1, "ifOutOctets.1", 10, 32)
+	assert.False(t, ok)
+
+	// device restarted
+	device2.uptime = 10
+	_, _, ok = store.update(device2, "ifInOctets.1", 6000, 32)
+	assert.False(t, ok)
+
+	// sysUpTime wrapped after 497 days
+	device1.uptime = math.MaxUint32 - 50
+	store.update(device1, "ifInOctets.1", 200, 32)
+	device1.uptime = 100
+	d, _, ok = store.update(device1, "ifInOctets.1", 300, 32)
+	assert.True(t, ok)
+	assert.Equal(t, float64(100), d)
+
+	// state survives a restart of frontman
+	device2.uptime = 20
+	require.Nil(t, store.save())
+	store = newSNMPCounterStore(path)
+	require.Nil(t, store.load())
+	d, _, ok = store.update(device2, "ifInOctets.1", 6500, 32)
+	assert.True(t, ok)
+	assert.Equal(t, float64(500), d)
+
+	require.Nil(t, ioutil.WriteFile(path, []byte("{broken"), 0600))
+	assert.NotNil(t, newSNMPCounterStore(path).load())
+}
+
+func TestSNMPPresetTable(t *testing.T) {
+	cfg := NewConfig()
+	fm := helperCreateFrontman(t, cfg)
+
+	columns := []SNMPTableColumn{
+		{Oid: "1.3.6.1.2.1.25.2.3.1.3", Name: "descr"},
+		{Oid: ".1.3.6.1.2.1.25.2.3.1.6", Name: "used", Unit: "blocks"},
+		{Oid: ".1.3.6.1.2.1.25.2.3.1.7.", Name: "failures_rate", ValueType: "delta_per_sec"},
+		{Oid: ".1.3.6.1.2.1.2.2.1.6", Name: "mac", ValueType: "hex"},
+	}
+	check := &SNMPCheckData{
+		Preset:      "table",
+		Columns:     columns,
+		LabelColumn: "descr",
+	}
+	oids, form, err := check.presetToOids()
+	require.Nil(t, err)
+	require.Equal(t, "walk", form)
+	require.Equal(t, ".1.3.6.1.2.1.25.2.3.1.3", oids[0])
+	// the columns of the queued check are left untouched
+	assert.Equal(t, "1.3.6.1.2.1.25.2.3.1.3", columns[0].Oid)
+	assert.Equal(t, "", columns[0].ValueType)
+
+	packets := func(failures uint) []gosnmp.SnmpPDU {
+		return []gosnmp.SnmpPDU{
+			{Name: ".1.3.6.1.2.1.25.2.3.1.3.1", Type: gosnmp.OctetString, Value: []byte("/")},
+			{Name: ".1.3.6.1.2.1.25.2.3.1.3.31", Type: gosnmp.OctetString, Value: []byte("/boot")},
+			{Name: ".1.3.6.1.2.1.25.2.3.1.6.1", Type: gosnmp.Gauge32, Value: uint(100)},
+			{Name: ".1.3.6.1.2.1.25.2.3.1.7.1", Type: gosnmp.Counter32, Value: failures},
+			{Name: ".1.3.6.1.2.1.25.2.3.1.6.31", Type: gosnmp.Gauge32, Value: uint(10)},
+			{Name: ".1.3.6.1.2.1.2.2.1.6.1", Type: gosnmp.OctetString, Value: []byte{0xde, 0xad}},
+		}
+	}
+
+	m, err := fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, packets(100))
+	require.Nil(t, err)
+	require.Len(t, m, 2)
+	row := m["1"].(map[string]interface{})
+	assert.Equal(t, "1", row["index"])
+	assert.Equal(t, "/", row["label"])
+	assert.Equal(t, uint(100), row["used"])
+	assert.Equal(t, "blocks", row["used.unit"])
+	assert.Equal(t, "de:ad", row["mac"])
+	assert.NotContains(t, row, "mac.unit")
+	assert.NotContains(t, row, "failures_rate")
+	assert.Equal(t, "/boot", m["31"].(map[string]interface{})["label"])
+
+	m, err = fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, packets(150))
+	require.Nil(t, err)
+	row = m["1"].(map[string]interface{})
+	require.Contains(t, row, "failures_rate")
+	assert.Equal(t, true, row["failures_rate"].(jsonFloat64) > 0)
+}
+
+func TestSNMPPresetTableInvalidColumns(t *testing.T) {
+	check := &SNMPCheckData{Preset: "table"}
+	_, _, err := check.presetToOids()
+	assert.NotNil(t, err)
+
+	check.Columns = []SNMPTableColumn{{Oid: ".1.3.6.1.2.1.25.2.3.1.3", Name: "descr"}}
+	check.LabelColumn = "name"
+	_, _, err = check.presetToOids()
+	assert.NotNil(t, err)
+
+	check.LabelColumn = ""
+	check.Columns[0].ValueType = "average"
+	_, _, err = check.presetToOids()
+	assert.NotNil(t, err)
+
+	check.Columns = []SNMPTableColumn{
+		{Oid: ".1.3.6.1.2.1.25.2.3.1.3", Name: "descr"},
+		{Oid: "1.3.6.1.2.1.25.2.3.1.3", Name: "descr2"},
+	}
+	_, _, err = check.presetToOids()
+	assert.NotNil(t, err)
+}
+
+const testMIB = `
+TEST-IF-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Counter64, mib-2 FROM SNMPv2-SMI
+    TEXTUAL-CONVENTION                          FROM SNMPv2-TC;
+
+testIfMIB MODULE-IDENTITY
+    LAST-UPDATED "200006140000Z"
+    ORGANIZATION "IETF" -- inline -- CONTACT-INFO "none"
+    DESCRIPTION  "Subset of IF-MIB, ::= { fake 1 } inside a string"
+    ::= { mib-2 31 }
+
+TestAdminStatus ::= TEXTUAL-CONVENTION
+    STATUS       current
+    DESCRIPTION  "Admin status"
+    SYNTAX       INTEGER { up(1), down(2), testing(3) }
+
+interfaces   OBJECT IDENTIFIER ::= { mib-2 2 }
+ifTable      OBJECT IDENTIFIER ::= { interfaces 2 }
+ifEntry      OBJECT IDENTIFIER ::= { ifTable 1 }
+ifXEntry     OBJECT IDENTIFIER ::= { iso org(3) dod(6) internet(1) mgmt(2) mib-2(1) 31 1 1 1 }
+
+ifAdminStatus OBJECT-TYPE
+    SYNTAX      TestAdminStatus
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "The desired state of the interface."
+    ::= { ifEntry 7 }
+
+ifOperStatus OBJECT-TYPE
+    SYNTAX  INTEGER {
+                up(1),        -- ready to pass packets
+                down(2),
+                lowerLayerDown(7)
+            }
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The current operational state of the interface."
+    DEFVAL      { up }
+    ::= { ifEntry 8 }
+
+ifHCInOctets OBJECT-TYPE
+    SYNTAX      Counter64
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The total number of octets received on the interface."
+    ::= { ifXEntry 6 }
+
+END
+`
+
+func helperLoadTestMIB(t *testing.T) *Frontman {
+	t.Helper()
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "TEST-IF-MIB.txt"), []byte(testMIB), 0644))
+
+	cfg := NewConfig()
+	cfg.SNMPMIBDir = dir
+	return helperCreateFrontman(t, cfg)
+}
+
+func TestSNMPMIBResolve(t *testing.T) {
+	fm := helperLoadTestMIB(t)
+
+	for name, expected := range map[string]string{
+		"TEST-IF-MIB::ifHCInOctets.3": ".1.3.6.1.2.1.31.1.1.1.6.3",
+		"ifOperStatus":                ".1.3.6.1.2.1.2.2.1.8",
+		"TEST-IF-MIB::testIfMIB":      ".1.3.6.1.2.1.31",
+		"1.3.6.1.2.1.1.1.0":           ".1.3.6.1.2.1.1.1.0",
+	} {
+		oid, err := fm.mibs.Resolve(name)
+		require.Nil(t, err, name)
+		assert.Equal(t, expected, oid, name)
+	}
+
+	_, err := fm.mibs.Resolve("IF-MIB::ifHCInOctets")
+	assert.NotNil(t, err)
+
+	name, ok := fm.snmpOidName(".1.3.6.1.2.1.2.2.1.8.12")
+	assert.True(t, ok)
+	assert.Equal(t, "TEST-IF-MIB::ifOperStatus.12", name)
+
+	_, ok = fm.snmpOidName(".1.3.6.1.4.1.9.1")
+	assert.False(t, ok)
+
+	enum, ok := fm.snmpEnumValue(".1.3.6.1.2.1.2.2.1.8.12", 7)
+	assert.True(t, ok)
+	assert.Equal(t, "lowerLayerDown", enum)
+
+	enum, ok = fm.snmpEnumValue(".1.3.6.1.2.1.2.2.1.7.12", 2)
+	assert.True(t, ok)
+	assert.Equal(t, "down", enum)
+}
+
+func TestSNMPMIBSymbolicCheck(t *testing.T) {
+	fm := helperLoadTestMIB(t)
+
+	check := &SNMPCheckData{
+		Preset:    "oid",
+		Oid:       "TEST-IF-MIB::ifOperStatus.2",
+		ValueType: "raw",
+	}
+	require.Nil(t, fm.resolveSNMPCheckOids(check))
+	assert.Equal(t, ".1.3.6.1.2.1.2.2.1.8.2", check.Oid)
+
+	m, err := fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.2.2.1.8.2", Type: gosnmp.Integer, Value: 2},
+	})
+	require.Nil(t, err)
+	res := m[".1.3.6.1.2.1.2.2.1.8.2"].(map[string]interface{})
+	assert.Equal(t, "down", res["value"])
+	assert.Equal(t, "TEST-IF-MIB::ifOperStatus.2", res["oid_name"])
+
+	columns := []SNMPTableColumn{
+		{Oid: "ifOperStatus"},
+		{Oid: "TEST-IF-MIB::ifHCInOctets", Name: "in"},
+	}
+	check = &SNMPCheckData{
+		Preset:  "table",
+		Columns: columns,
+	}
+	require.Nil(t, fm.resolveSNMPCheckOids(check))
+	assert.Equal(t, "ifOperStatus", check.Columns[0].Name)
+	assert.Equal(t, SNMPTableColumn{Oid: "ifOperStatus"}, columns[0])
+	_, _, err = check.presetToOids()
+	require.Nil(t, err)
+
+	m, err = fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.2.2.1.8.1", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: uint64(1234)},
+	})
+	require.Nil(t, err)
+	row := m["1"].(map[string]interface{})
+	assert.Equal(t, "up", row["ifOperStatus"])
+	assert.Equal(t, uint64(1234), row["in"])
+
+	check.Columns[0].Oid = "IF-MIB::unknownObject"
+	assert.NotNil(t, fm.resolveSNMPCheckOids(check))
+}
+
+func TestSNMPPresetBandwidthHighCapacity(t *testing.T) {
+	cfg := NewConfig()
+	fm := helperCreateFrontman(t, cfg)
+
+	check := &SNMPCheckData{Preset: "bandwidth", Protocol: protocolSNMPv1}
+	oids, _, err := check.presetToOids()
+	require.Nil(t, err)
+	assert.NotContains(t, oids, ".1.3.6.1.2.1.31.1.1.1.6")
+
+	check.Protocol = protocolSNMPv2
+	oids, _, err = check.presetToOids()
+	require.Nil(t, err)
+	assert.Contains(t, oids, ".1.3.6.1.2.1.31.1.1.1.6")
+
+	// interface 1 supports 64-bit counters, interface 2 only 32-bit counters
+	packets := func(octets uint64, octets32 uint) []gosnmp.SnmpPDU {
+		return []gosnmp.SnmpPDU{
+			{Name: ".1.3.6.1.2.1.2.2.1.8.1", Type: gosnmp.Integer, Value: ifOperStatusUp},
+			{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: gosnmp.Integer, Value: ifTypeEthernetCsmacd},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.1.1", Type: gosnmp.OctetString, Value: []byte("eth0")},
+			{Name: ".1.3.6.1.2.1.2.2.1.5.1", Type: gosnmp.Gauge32, Value: uint(math.MaxUint32)},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.15.1", Type: gosnmp.Gauge32, Value: uint(10000)},
+			{Name: ".1.3.6.1.2.1.2.2.1.10.1", Type: gosnmp.Counter32, Value: uint(octets % (1 << 32))},
+			{Name: ".1.3.6.1.2.1.2.2.1.16.1", Type: gosnmp.Counter32, Value: uint(0)},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.6.1", Type: gosnmp.Counter64, Value: octets},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.10.1", Type: gosnmp.Counter64, Value: uint64(0)},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.7.1", Type: gosnmp.Counter64, Value: octets / 1000},
+
+			{Name: ".1.3.6.1.2.1.2.2.1.8.2", Type: gosnmp.Integer, Value: ifOperStatusUp},
+			{Name: ".1.3.6.1.2.1.2.2.1.3.2", Type: gosnmp.Integer, Value: ifTypeEthernetCsmacd},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.1.2", Type: gosnmp.OctetString, Value: []byte("eth1")},
+			{Name: ".1.3.6.1.2.1.2.2.1.5.2", Type: gosnmp.Gauge32, Value: uint(100000000)},
+			{Name: ".1.3.6.1.2.1.2.2.1.10.2", Type: gosnmp.Counter32, Value: octets32},
+			{Name: ".1.3.6.1.2.1.2.2.1.16.2", Type: gosnmp.Counter32, Value: uint(0)},
+		}
+	}
+
+	scope := snmpCounterScope{checkUUID: t.Name()}
+	m, err := fm.prepareSNMPResult(scope, check, packets(1<<40, math.MaxUint32-999))
+	require.Nil(t, err)
+	eth0 := m["1"].(map[string]interface{})
+	assert.Equal(t, uint(10000), eth0["ifSpeed_mbps"])
+	assert.Equal(t, 64, eth0["ifCounterBits"])
+	assert.NotContains(t, eth0, "ifIn_Bps")
+	eth1 := m["2"].(map[string]interface{})
+	assert.Equal(t, uint(100), eth1["ifSpeed_mbps"])
+	assert.Equal(t, 32, eth1["ifCounterBits"])
+
+	// pretend the first poll was 10 seconds ago
+	for key, c := range fm.snmpCounters.counters {
+		c.Timestamp = c.Timestamp.Add(-10 * time.Second)
+		fm.snmpCounters.counters[key] = c
+	}
+
+	// the 32-bit counter of eth0 wraps several times, eth1 wraps once
+	m, err = fm.prepareSNMPResult(scope, check, packets(1<<40+1<<34, 1000))
+	require.Nil(t, err)
+	eth0 = m["1"].(map[string]interface{})
+	require.Contains(t, eth0, "ifIn_Bps")
+	assert.InEpsilon(t, (1<<34)/10, float64(eth0["ifIn_Bps"].(jsonFloat64)), 0.001)
+	assert.InEpsilon(t, (1<<34)/1000/10, float64(eth0["ifInUcast_pps"].(jsonFloat64)), 0.001)
+	assert.InEpsilon(t, 137.44, float64(eth0["ifInUtilization_percent"].(jsonFloat64)), 0.001)
+	assert.Equal(t, jsonFloat64(0), eth0["ifOut_Bps"])
+
+	eth1 = m["2"].(map[string]interface{})
+	require.Contains(t, eth1, "ifIn_Bps")
+	assert.Equal(t, jsonFloat64(200), eth1["ifIn_Bps"])
+}
+
+func TestSNMPInterfaceFilter(t *testing.T) {
+	cfg := NewConfig()
+	fm := helperCreateFrontman(t, cfg)
+
+	iface := func(idx, ifType, adminStatus, operStatus int, name, alias string) []gosnmp.SnmpPDU {
+		suffix := "." + strconv.Itoa(idx)
+		return []gosnmp.SnmpPDU{
+			{Name: ".1.3.6.1.2.1.2.2.1.3" + suffix, Type: gosnmp.Integer, Value: ifType},
+			{Name: ".1.3.6.1.2.1.2.2.1.7" + suffix, Type: gosnmp.Integer, Value: adminStatus},
+			{Name: ".1.3.6.1.2.1.2.2.1.8" + suffix, Type: gosnmp.Integer, Value: operStatus},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.1" + suffix, Type: gosnmp.OctetString, Value: []byte(name)},
+			{Name: ".1.3.6.1.2.1.31.1.1.1.18" + suffix, Type: gosnmp.OctetString, Value: []byte(alias)},
+			{Name: ".1.3.6.1.2.1.2.2.1.14" + suffix, Type: gosnmp.Counter32, Value: uint(0)},
+		}
+	}
+	var packets []gosnmp.SnmpPDU
+	packets = append(packets, iface(1, 6, 1, 1, "eth0", "uplink")...)
+	packets = append(packets, iface(2, 6, 1, 2, "eth1", "server rack 3")...)
+	packets = append(packets, iface(3, 161, 1, 1, "bond0", "")...)
+	packets = append(packets, iface(4, 135, 1, 1, "vlan100", "")...)
+	packets = append(packets, iface(5, 6, 2, 2, "eth2", "unused")...)
+
+	indexes := func(filter *SNMPInterfaceFilter) []string {
+		check := &SNMPCheckData{Preset: "porterrors", InterfaceFilter: filter}
+		m, err := fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, packets)
+		require.Nil(t, err)
+		var res []string
+		for idx := range m {
+			res = append(res, idx)
+		}
+		return res
+	}
+
+	assert.ElementsMatch(t, []string{"1"}, indexes(nil))
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4", "5"}, indexes(&SNMPInterfaceFilter{}))
+	assert.ElementsMatch(t, []string{"1", "3"}, indexes(&SNMPInterfaceFilter{IncludeTypes: []int{6, 161}, OperStatus: []string{"up"}}))
+	assert.ElementsMatch(t, []string{"1", "2", "5"}, indexes(&SNMPInterfaceFilter{ExcludeTypes: []int{161, 135}}))
+	assert.ElementsMatch(t, []string{"2"}, indexes(&SNMPInterfaceFilter{AdminStatus: []string{"up"}, OperStatus: []string{"down"}}))
+	assert.ElementsMatch(t, []string{"1", "2"}, indexes(&SNMPInterfaceFilter{IncludeName: "^eth", ExcludeName: "unused"}))
+	assert.ElementsMatch(t, []string{"2"}, indexes(&SNMPInterfaceFilter{IncludeName: "rack"}))
+	assert.ElementsMatch(t, []string{"3", "4"}, indexes(&SNMPInterfaceFilter{IncludeIndexes: []int{3, 4, 5}, ExcludeIndexes: []int{5}}))
+
+	check := &SNMPCheckData{Preset: "porterrors"}
+	m, err := fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, packets)
+	require.Nil(t, err)
+	eth0 := m["1"].(map[string]interface{})
+	assert.Equal(t, "uplink", eth0["ifAlias"])
+	assert.Equal(t, 1, eth0["ifAdminStatus"])
+	assert.Equal(t, 1, eth0["ifOperStatus"])
+
+	check.InterfaceFilter = &SNMPInterfaceFilter{OperStatus: []string{"broken"}}
+	_, err = fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, packets)
+	assert.NotNil(t, err)
+
+	check.InterfaceFilter = &SNMPInterfaceFilter{IncludeName: "eth("}
+	_, err = fm.prepareSNMPResult(snmpCounterScope{checkUUID: t.Name()}, check, packets)
+	assert.NotNil(t, err)
+}
+
+func TestSNMPHostResourcesPresets(t *testing.T) {
+	cfg := NewConfig()
+	fm := helperCreateFrontman(t, cfg)
+	scope := snmpCounterScope{checkUUID: t.Name()}
+
+	prepare := func(preset string, packets []gosnmp.SnmpPDU) map[string]interface{} {
+		check := &SNMPCheckData{Preset: preset}
+		_, _, err := check.presetToOids()
+		require.Nil(t, err)
+		m, err := fm.prepareSNMPResult(scope, check, packets)
+		require.Nil(t, err)
+		return m
+	}
+
+	m := prepare("cpu", []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.25.3.3.1.2.196608", Type: gosnmp.Integer, Value: 10},
+		{Name: ".1.3.6.1.2.1.25.3.3.1.2.196609", Type: gosnmp.Integer, Value: 25},
+	})
+	assert.Equal(t, jsonFloat64(25), m["196609"].(map[string]interface{})["load_percent"])
+	assert.Equal(t, jsonFloat64(17.5), m["average"].(map[string]interface{})["load_percent"])
+
+	storage := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.25.2.2.0", Type: gosnmp.Integer, Value: 2048},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.2.1", Type: gosnmp.ObjectIdentifier, Value: hrStorageRam},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.3.1", Type: gosnmp.OctetString, Value: []byte("Physical memory")},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.4.1", Type: gosnmp.Integer, Value: 1024},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.5.1", Type: gosnmp.Integer, Value: 2048},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.6.1", Type: gosnmp.Integer, Value: 512},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.2.31", Type: gosnmp.ObjectIdentifier, Value: hrStorageFixedDisk},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.3.31", Type: gosnmp.OctetString, Value: []byte("/")},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.4.31", Type: gosnmp.Integer, Value: 4096},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.5.31", Type: gosnmp.Integer, Value: 1000},
+		{Name: ".1.3.6.1.2.1.25.2.3.1.6.31", Type: gosnmp.Integer, Value: 750},
+	}
+	m = prepare("storage", storage)
+	require.Len(t, m, 1)
+	root := m["31"].(map[string]interface{})
+	assert.Equal(t, "/", root["descr"])
+	assert.Equal(t, jsonFloat64(4096000), root["total_B"])
+	assert.Equal(t, jsonFloat64(75), root["used_percent"])
+
+	m = prepare("memory", storage)
+	assert.Equal(t, jsonFloat64(2048*1024), m["memory.total_B"])
+	assert.Equal(t, jsonFloat64(512*1024), m["memory.ram.used_B"])
+	assert.Equal(t, jsonFloat64(25), m["memory.ram.used_percent"])
+
+	m = prepare("processes", []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.25.1.5.0", Type: gosnmp.Gauge32, Value: uint(2)},
+		{Name: ".1.3.6.1.2.1.25.1.6.0", Type: gosnmp.Gauge32, Value: uint(120)},
+		{Name: ".1.3.6.1.2.1.25.1.7.0", Type: gosnmp.NoSuchObject, Value: nil},
+	})
+	assert.Equal(t, map[string]interface{}{"system.users": uint(2), "system.processes": uint(120)}, m)
+
+	m = prepare("loadavg", []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.4.1.2021.10.1.3.1", Type: gosnmp.OctetString, Value: []byte("0.52")},
+		{Name: ".1.3.6.1.4.1.2021.10.1.3.2", Type: gosnmp.OctetString, Value: []byte("0.40")},
+		{Name: ".1.3.6.1.4.1.2021.10.1.3.3", Type: gosnmp.OctetString, Value: []byte("0.31")},
+	})
+	assert.Equal(t, jsonFloat64(0.52), m["load.1m"])
+	assert.Equal(t, jsonFloat64(0.31), m["load.15m"])
+
+	m = prepare("sensors", []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.47.1.1.1.1.7.1", Type: gosnmp.OctetString, Value: []byte("Chassis")},
+		{Name: ".1.3.6.1.2.1.47.1.1.1.1.7.10", Type: gosnmp.OctetString, Value: []byte("CPU temperature")},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.1.10", Type: gosnmp.Integer, Value: 8},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.2.10", Type: gosnmp.Integer, Value: 9},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.3.10", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.4.10", Type: gosnmp.Integer, Value: 455},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.5.10", Type: gosnmp.Integer, Value: 1},
+		{Name: ".1.3.6.1.2.1.47.1.1.1.1.7.11", Type: gosnmp.OctetString, Value: []byte("PSU 1")},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.1.11", Type: gosnmp.Integer, Value: 4},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.2.11", Type: gosnmp.Integer, Value: 8},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.3.11", Type: gosnmp.Integer, Value: 0},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.4.11", Type: gosnmp.Integer, Value: 12050},
+		{Name: ".1.3.6.1.2.1.99.1.1.1.5.11", Type: gosnmp.Integer, Value: 3},
+	})
+	require.Len(t, m, 2)
+	cpu := m["10"].(map[string]interface{})
+	assert.Equal(t, "CPU temperature", cpu["name"])
+	assert.Equal(t, "celsius", cpu["type"])
+	assert.Equal(t, "ok", cpu["status"])
+	assert.InDelta(t, 45.5, float64(cpu["value"].(jsonFloat64)), 0.0001)
+	psu := m["11"].(map[string]interface{})
+	assert.Equal(t, "nonoperational", psu["status"])
+	assert.NotContains(t, psu, "value")
+
+	m = prepare("ups", []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.33.1.2.1.0", Type: gosnmp.Integer, Value: 3},
+		{Name: ".1.3.6.1.2.1.33.1.2.2.0", Type: gosnmp.Integer, Value: 300},
+		{Name: ".1.3.6.1.2.1.33.1.2.4.0", Type: gosnmp.Integer, Value: 40},
+		{Name: ".1.3.6.1.2.1.33.1.2.5.0", Type: gosnmp.Integer, Value: 271},
+		{Name: ".1.3.6.1.2.1.33.1.4.1.0", Type: gosnmp.Integer, Value: 5},
+	})
+	assert.Equal(t, "batteryLow", m["ups.battery.status"])
+	assert.Equal(t, uint(300), m["ups.battery.on_battery_s"])
+	assert.Equal(t, uint(40), m["ups.battery.charge_percent"])
+	assert.InDelta(t, 27.1, float64(m["ups.battery.voltage_V"].(jsonFloat64)), 0.0001)
+	assert.Equal(t, "battery", m["ups.output.source"])
+
+	_, _, err := (&SNMPCheckData{Preset: "unknown"}).presetToOids()
+	assert.NotNil(t, err)
+}
+
+func helperStartSNMPTrapReceiver(t *testing.T, fm *Frontman) *snmpTrapReceiver {
+	t.Helper()
+	r, err := newSNMPTrapReceiver(fm, &fm.Config.SNMPTrap, fm.resultsChan)
+	require.Nil(t, err)
+	r.conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+	go r.serve()
+	return r
+}
+
+func helperReceiveSNMPTrapResult(t *testing.T, fm *Frontman) Result {
+	t.Helper()
+	select {
+	case res := <-fm.resultsChan:
+		return res
+	case <-time.After(2 * time.Second):
+		t.Fatal("no trap result received")
+	}
+	return Result{}
+}
+
+// localizes a SHA key like described in RFC 3414 A.2.2, gosnmp does this only after engine discovery
+func helperSNMPLocalizedKey(password, engineID string) []byte {
+	h := sha1.New()
+	for i := 0; i < 1048576; i++ {
+		h.Write([]byte{password[i%len(password)]})
+	}
+	key := h.Sum(nil)
+
+	h = sha1.New()
+	h.Write(key)
+	h.Write([]byte(engineID))
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+func TestSNMPTrapReceiver(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.SNMPTrap.Communities = []string{"traps"}
+	cfg.SNMPTrap.Users = []SNMPTrapUser{{
+		Username:               "trapuser",
+		SecurityLevel:          "authPriv",
+		AuthenticationProtocol: "sha",
+		AuthenticationPassword: "authsecret",
+		PrivacyProtocol:        "des",
+		PrivacyPassword:        "privsecret",
+	}}
+	fm := helperCreateFrontman(t, cfg)
+	r := helperStartSNMPTrapReceiver(t, fm)
+	defer r.conn.Close()
+	addr := r.conn.LocalAddr().(*net.UDPAddr)
+
+	linkDown := []gosnmp.SnmpPDU{
+		{Name: snmpSysUpTimeVarbind, Type: gosnmp.TimeTicks, Value: uint32(1234)},
+		{Name: snmpTrapOidVarbind, Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.3"},
+		{Name: ".1.3.6.1.2.1.2.2.1.1.7", Type: gosnmp.Integer, Value: 7},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.7", Type: gosnmp.OctetString, Value: "eth7"},
+	}
+
+	t.Run("v2c trap", func(t *testing.T) {
+		sender := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(addr.Port), Version: gosnmp.Version2c, Community: "traps", Timeout: time.Second}
+		require.Nil(t, sender.Connect())
+		defer sender.Conn.Close()
+		_, err := sender.SendTrap(gosnmp.SnmpTrap{Variables: linkDown})
+		require.Nil(t, err)
+
+		res := helperReceiveSNMPTrapResult(t, fm)
+		assert.Equal(t, "snmpTrap", res.CheckType)
+		assert.Equal(t, "127.0.0.1", res.Measurements["snmpTrap.source"])
+		assert.Equal(t, "v2c", res.Measurements["snmpTrap.version"])
+		assert.Equal(t, "trap", res.Measurements["snmpTrap.type"])
+		assert.Equal(t, "traps", res.Measurements["snmpTrap.community"])
+		assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", res.Measurements["snmpTrap.oid"])
+		assert.EqualValues(t, 1234, res.Measurements["snmpTrap.uptime"])
+		assert.Equal(t, []map[string]interface{}{
+			{"oid": ".1.3.6.1.2.1.2.2.1.1.7", "value": 7},
+			{"oid": ".1.3.6.1.2.1.2.2.1.2.7", "value": "eth7"},
+		}, res.Measurements["snmpTrap.varbinds"])
+	})
+
+	t.Run("v2c unknown community", func(t *testing.T) {
+		sender := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(addr.Port), Version: gosnmp.Version2c, Community: "public", Timeout: time.Second}
+		require.Nil(t, sender.Connect())
+		defer sender.Conn.Close()
+		_, err := sender.SendTrap(gosnmp.SnmpTrap{Variables: linkDown})
+		require.Nil(t, err)
+
+		select {
+		case res := <-fm.resultsChan:
+			t.Fatalf("unexpected result %v", res)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("v1 trap", func(t *testing.T) {
+		sender := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(addr.Port), Version: gosnmp.Version1, Community: "traps", Timeout: time.Second}
+		require.Nil(t, sender.Connect())
+		defer sender.Conn.Close()
+		_, err := sender.SendTrap(gosnmp.SnmpTrap{
+			Variables:    linkDown[2:],
+			Enterprise:   ".1.3.6.1.4.1.8072",
+			AgentAddress: "10.0.0.1",
+			GenericTrap:  6,
+			SpecificTrap: 42,
+			Timestamp:    300,
+		})
+		require.Nil(t, err)
+
+		res := helperReceiveSNMPTrapResult(t, fm)
+		assert.Equal(t, "v1", res.Measurements["snmpTrap.version"])
+		assert.Equal(t, ".1.3.6.1.4.1.8072.0.42", res.Measurements["snmpTrap.oid"])
+		assert.Equal(t, "10.0.0.1", res.Measurements["snmpTrap.agent_address"])
+		assert.EqualValues(t, 300, res.Measurements["snmpTrap.uptime"])
+	})
+
+	t.Run("v2c inform", func(t *testing.T) {
+		inform := &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: "traps",
+			PDUType:   gosnmp.InformRequest,
+			RequestID: 4711,
+			Variables: linkDown,
+		}
+		data, err := inform.MarshalMsg()
+		require.Nil(t, err)
+
+		conn, err := net.DialUDP("udp", nil, addr)
+		require.Nil(t, err)
+		defer conn.Close()
+		_, err = conn.Write(data)
+		require.Nil(t, err)
+
+		res := helperReceiveSNMPTrapResult(t, fm)
+		assert.Equal(t, "inform", res.Measurements["snmpTrap.type"])
+		assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", res.Measurements["snmpTrap.oid"])
+
+		buf := make([]byte, 1500)
+		require.Nil(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, err := conn.Read(buf)
+		require.Nil(t, err)
+		ack := (&gosnmp.GoSNMP{}).UnmarshalTrap(buf[:n])
+		require.NotNil(t, ack)
+		assert.Equal(t, gosnmp.GetResponse, ack.PDUType)
+		assert.Equal(t, uint32(4711), ack.RequestID)
+		assert.Len(t, ack.Variables, len(linkDown))
+	})
+
+	t.Run("malformed v2c inform", func(t *testing.T) {
+		// gosnmp panics while decoding the varbinds, before the community is checked
+		data, err := hex.DecodeString("304002010104067075626c6963a7330204000000050201000201003025300d06082b06010201010300" +
+			"430105301406402b06010603010104012c06062b0601040101")
+		require.Nil(t, err)
+		_, err = r.handleRecover(data, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.NotNil(t, err)
+
+		conn, err := net.DialUDP("udp", nil, addr)
+		require.Nil(t, err)
+		defer conn.Close()
+		_, err = conn.Write(data)
+		require.Nil(t, err)
+
+		// the receiver keeps running
+		sender := &gosnmp.GoSNMP{Target: "127.0.0.1", Port: uint16(addr.Port), Version: gosnmp.Version2c, Community: "traps", Timeout: time.Second}
+		require.Nil(t, sender.Connect())
+		defer sender.Conn.Close()
+		_, err = sender.SendTrap(gosnmp.SnmpTrap{Variables: linkDown})
+		require.Nil(t, err)
+		res := helperReceiveSNMPTrapResult(t, fm)
+		assert.Equal(t, "trap", res.Measurements["snmpTrap.type"])
+	})
+
+	t.Run("v3 inform", func(t *testing.T) {
+		conn, err := net.DialUDP("udp", nil, addr)
+		require.Nil(t, err)
+		defer conn.Close()
+
+		discard := log.New(ioutil.Discard, "", 0)
+		send := func(packet *gosnmp.SnmpPacket) {
+			data, err := packet.MarshalMsg()
+			require.Nil(t, err)
+			_, err = conn.Write(data)
+			require.Nil(t, err)
+		}
+		// decodes the next message from the receiver with the security parameters
+		receive := func(flags gosnmp.SnmpV3MsgFlags, sp *gosnmp.UsmSecurityParameters) *gosnmp.SnmpPacket {
+			buf := make([]byte, 1500)
+			require.Nil(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+			n, err := conn.Read(buf)
+			require.Nil(t, err)
+			sp.Logger = discard
+			packet := (&gosnmp.GoSNMP{Version: gosnmp.Version3, SecurityModel: gosnmp.UserSecurityModel, MsgFlags: flags, SecurityParameters: sp}).UnmarshalTrap(buf[:n])
+			require.NotNil(t, packet)
+			return packet
+		}
+
+		// engine discovery
+		send(&gosnmp.SnmpPacket{
+			Version:            gosnmp.Version3,
+			MsgFlags:           gosnmp.NoAuthNoPriv | gosnmp.Reportable,
+			SecurityModel:      gosnmp.UserSecurityModel,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{},
+			MsgID:              1,
+			PDUType:            gosnmp.GetRequest,
+			RequestID:          1,
+		})
+		report := receive(gosnmp.NoAuthNoPriv, &gosnmp.UsmSecurityParameters{})
+		assert.Equal(t, gosnmp.Report, report.PDUType)
+		assert.Equal(t, uint32(1), report.MsgID)
+		require.Len(t, report.Variables, 1)
+		assert.Equal(t, snmpUnknownEngineIDsOid, report.Variables[0].Name)
+		engine := report.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		assert.Equal(t, r.engine.id, engine.AuthoritativeEngineID)
+		assert.Equal(t, r.engine.boots, engine.AuthoritativeEngineBoots)
+
+		userParams := func() *gosnmp.UsmSecurityParameters {
+			return &gosnmp.UsmSecurityParameters{
+				UserName:               "trapuser",
+				AuthenticationProtocol: gosnmp.SHA,
+				PrivacyProtocol:        gosnmp.DES,
+				SecretKey:              helperSNMPLocalizedKey("authsecret", engine.AuthoritativeEngineID),
+				PrivacyKey:             helperSNMPLocalizedKey("privsecret", engine.AuthoritativeEngineID),
+			}
+		}
+		inform := func(boots, engineTime uint32) *gosnmp.SnmpPacket {
+			sp := userParams()
+			sp.AuthoritativeEngineID = engine.AuthoritativeEngineID
+			sp.AuthoritativeEngineBoots = boots
+			sp.AuthoritativeEngineTime = engineTime
+			sp.PrivacyParameters = []byte{0, 0, 0, 1, 0xde, 0xad, 0xbe, 0xef}
+			return &gosnmp.SnmpPacket{
+				Version:            gosnmp.Version3,
+				MsgFlags:           gosnmp.AuthPriv | gosnmp.Reportable,
+				SecurityModel:      gosnmp.UserSecurityModel,
+				SecurityParameters: sp,
+				MsgID:              2,
+				ContextEngineID:    engine.AuthoritativeEngineID,
+				PDUType:            gosnmp.InformRequest,
+				RequestID:          4712,
+				Variables:          linkDown,
+			}
+		}
+
+		// the sender learns the engine time from an authenticated report
+		send(inform(engine.AuthoritativeEngineBoots, engine.AuthoritativeEngineTime+snmpTimeWindow+100))
+		report = receive(gosnmp.AuthNoPriv, userParams())
+		assert.Equal(t, gosnmp.Report, report.PDUType)
+		assert.Equal(t, uint32(4712), report.RequestID)
+		assert.Equal(t, snmpNotInTimeWindowsOid, report.Variables[0].Name)
+
+		send(inform(engine.AuthoritativeEngineBoots, report.SecurityParameters.(*gosnmp.UsmSecurityParameters).AuthoritativeEngineTime))
+		res := helperReceiveSNMPTrapResult(t, fm)
+		assert.Equal(t, "v3", res.Measurements["snmpTrap.version"])
+		assert.Equal(t, "inform", res.Measurements["snmpTrap.type"])
+		assert.Equal(t, "trapuser", res.Measurements["snmpTrap.username"])
+		assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", res.Measurements["snmpTrap.oid"])
+
+		ack := receive(gosnmp.AuthPriv, userParams())
+		assert.Equal(t, gosnmp.GetResponse, ack.PDUType)
+		assert.Equal(t, uint32(2), ack.MsgID)
+		assert.Equal(t, uint32(4712), ack.RequestID)
+		assert.Len(t, ack.Variables, len(linkDown))
+
+		// wrong password
+		wrong := inform(engine.AuthoritativeEngineBoots, r.engine.time())
+		wrong.SecurityParameters.(*gosnmp.UsmSecurityParameters).SecretKey = helperSNMPLocalizedKey("wrongsecret", engine.AuthoritativeEngineID)
+		send(wrong)
+		report = receive(gosnmp.NoAuthNoPriv, &gosnmp.UsmSecurityParameters{})
+		assert.Equal(t, snmpWrongDigestsOid, report.Variables[0].Name)
+		select {
+		case res := <-fm.resultsChan:
+			t.Fatalf("unexpected result %v", res)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("v3 trap", func(t *testing.T) {
+		sender := &gosnmp.GoSNMP{
+			Target:        "127.0.0.1",
+			Port:          uint16(addr.Port),
+			Version:       gosnmp.Version3,
+			SecurityModel: gosnmp.UserSecurityModel,
+			MsgFlags:      gosnmp.AuthPriv,
+			Timeout:       time.Second,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{
+				UserName:                 "trapuser",
+				AuthoritativeEngineID:    "8000000001020304",
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  100,
+				AuthenticationProtocol:   gosnmp.SHA,
+				AuthenticationPassphrase: "authsecret",
+				PrivacyProtocol:          gosnmp.DES,
+				PrivacyPassphrase:        "privsecret",
+				SecretKey:                helperSNMPLocalizedKey("authsecret", "8000000001020304"),
+				PrivacyKey:               helperSNMPLocalizedKey("privsecret", "8000000001020304"),
+			},
+		}
+		require.Nil(t, sender.Connect())
+		defer sender.Conn.Close()
+		_, err := sender.SendTrap(gosnmp.SnmpTrap{Variables: linkDown})
+		require.Nil(t, err)
+
+		res := helperReceiveSNMPTrapResult(t, fm)
+		assert.Equal(t, "v3", res.Measurements["snmpTrap.version"])
+		assert.Equal(t, "trapuser", res.Measurements["snmpTrap.username"])
+		assert.Equal(t, ".1.3.6.1.6.3.1.1.5.3", res.Measurements["snmpTrap.oid"])
+
+		// wrong password
+		sender.SecurityParameters.(*gosnmp.UsmSecurityParameters).SecretKey = helperSNMPLocalizedKey("wrongsecret", "8000000001020304")
+		_, err = sender.SendTrap(gosnmp.SnmpTrap{Variables: linkDown})
+		require.Nil(t, err)
+
+		select {
+		case res := <-fm.resultsChan:
+			t.Fatalf("unexpected result %v", res)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+// lengths overflowing int on 32-bit platforms are rejected before slicing the message
+func TestSNMPTrapInvalidLength(t *testing.T) {
+	tests := []struct {
+		data          string
+		versionFailed bool
+	}{
+		{"3084ffffffff020103", true},
+		{"300602840000000103", true},
+		{"3009020103308480000000", false},
+		{"3018020103300d020101020201000401040201030484ffffffff", false},
+	}
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.data)
+		require.Nil(t, err)
+		_, err = snmpMessageVersion(data)
+		assert.Equal(t, test.versionFailed, err != nil, test.data)
+		_, err = parseSNMPv3Message(data)
+		assert.EqualError(t, err, "invalid length", test.data)
+	}
+
+	_, _, err := berHeader([]byte{0x02, 0x84, 0xff, 0xff, 0xff, 0xff})
+	assert.EqualError(t, err, "invalid length")
+	_, _, err = berField([]byte{0x02, 0x84, 0x7f, 0xff, 0xff, 0xff}, 0, 0x02)
+	assert.EqualError(t, err, "invalid length")
+	header, length, err := berHeader([]byte{0x04, 0x83, 0x01, 0x00, 0x00})
+	require.Nil(t, err)
+	assert.Equal(t, 5, header)
+	assert.Equal(t, 1<<16, length)
+}
+
+func TestSNMPStatelessCounters(t *testing.T) {
+	cfg := NewConfig()
+	fm := helperCreateFrontman(t, cfg)
+
+	assert.True(t, (&SNMPCheckData{Preset: "bandwidth"}).usesCounters())
+	assert.True(t, (&SNMPCheckData{Preset: "oid", ValueType: "delta_per_sec"}).usesCounters())
+	assert.False(t, (&SNMPCheckData{Preset: "oid", ValueType: "raw"}).usesCounters())
+	assert.True(t, (&SNMPCheckData{Preset: "table", Columns: []SNMPTableColumn{{Oid: ".1", ValueType: "delta"}}}).usesCounters())
+	assert.False(t, (&SNMPCheckData{Preset: "cpu"}).usesCounters())
+
+	check := &SNMPCheckData{Preset: "oid", Oid: ".1.3.6.1.2.1.2.2.1.10.1", ValueType: "delta"}
+	packets := func(val uint) []gosnmp.SnmpPDU {
+		return []gosnmp.SnmpPDU{{Name: check.Oid, Type: gosnmp.Counter32, Value: val}}
+	}
+
+	// samples of a stateless run are not kept by frontman
+	scope := snmpCounterScope{checkUUID: t.Name(), counters: newSNMPCounterStore("")}
+	_, err := fm.prepareSNMPResult(scope, check, packets(100))
+	require.Nil(t, err)
+	m, err := fm.prepareSNMPResult(scope, check, packets(150))
+	require.Nil(t, err)
+	assert.EqualValues(t, 50, m[check.Oid].(map[string]interface{})["value"])
+	assert.Empty(t, fm.snmpCounters.counters)
+}
+
+func TestSNMPCounterStateWriter(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SNMPStateFile = filepath.Join(t.TempDir(), "snmpstate")
+	fm := helperCreateFrontman(t, cfg)
+	fm.startSNMPCounterStateWriter()
+
+	scope := snmpCounterScope{checkUUID: t.Name()}
+	fm.updateSNMPCounter(scope, ".1.3.6.1.2.1.2.2.1.10.1", 100, 32)
+
+	// checks run meanwhile are not held up by the writer
+	done := make(chan struct{})
+	go func() {
+		fm.processInput(nil, true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("processInput waits for the snmp counter state writer")
+	}
+
+	// the state is written once interrupted
+	close(fm.InterruptChan)
+	fm.TerminateQueue.Wait()
+	store := newSNMPCounterStore(cfg.SNMPStateFile)
+	require.Nil(t, store.load())
+	assert.Contains(t, store.counters, scope.key(".1.3.6.1.2.1.2.2.1.10.1"))
+}
+
+func TestBuildSNMPParameters(t *testing.T) {
+	check := &SNMPCheckData{
+		Connect:         "127.0.0.1",
+		Port:            161,
+		Protocol:        protocolSNMPv3,
+		SecurityLevel:   "noAuthNoPriv",
+		Username:        "user",
+		ContextName:     "vlan-10",
+		ContextEngineID: "0x80001f8880",
+		Retries:         2,
+		MaxRepetitions:  10,
+	}
+	params, err := buildSNMPParameters(check)
+	require.Nil(t, err)
+	assert.Equal(t, 2, params.Retries)
+	assert.Equal(t, uint8(10), params.MaxRepetitions)
+	assert.Equal(t, "vlan-10", params.ContextName)
+	assert.Equal(t, "\x80\x00\x1f\x88\x80", params.ContextEngineID)
+
+	check.ContextEngineID = "xyz"
+	_, err = buildSNMPParameters(check)
+	assert.EqualError(t, err, "invalid context_engine_id: encoding/hex: invalid byte: U+0078 'x'")
+
+	check.ContextEngineID = ""
+	check.MaxRepetitions = 256
+	_, err = buildSNMPParameters(check)
+	assert.EqualError(t, err, "max_repetitions must be between 1 and 255")
+}
+
+// answers GET and GETNEXT requests from the table, GETBULK requests are ignored like by some old agents
+func helperStartGetNextAgent(t *testing.T, table []gosnmp.SnmpPDU) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.Nil(t, err)
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, remote, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			// gosnmp can't decode GET requests, they only differ from GETNEXT requests in the PDU tag
+			offset, err := snmpCommunityPDUOffset(buf[:n])
+			if err != nil {
+				continue
+			}
+			get := gosnmp.PDUType(buf[offset]) == gosnmp.GetRequest
+			if get {
+				buf[offset] = byte(gosnmp.GetNextRequest)
+			}
+			req := (&gosnmp.GoSNMP{}).UnmarshalTrap(buf[:n])
+			if req == nil || req.PDUType != gosnmp.GetNextRequest {
+				continue
+			}
+			var variables []gosnmp.SnmpPDU
+			if get {
+				for _, v := range req.Variables {
+					value := gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject}
+					for _, pdu := range table {
+						if pdu.Name == v.Name {
+							value = pdu
+						}
+					}
+					variables = append(variables, value)
+				}
+			} else {
+				next := gosnmp.SnmpPDU{Name: req.Variables[0].Name, Type: gosnmp.EndOfMibView}
+				for _, pdu := range table {
+					if oidLess(req.Variables[0].Name, pdu.Name) {
+						next = pdu
+						break
+					}
+				}
+				variables = append(variables, next)
+			}
+			resp := &gosnmp.SnmpPacket{
+				Version:   req.Version,
+				Community: req.Community,
+				PDUType:   gosnmp.GetResponse,
+				RequestID: req.RequestID,
+				Variables: variables,
+			}
+			data, _ := resp.MarshalMsg()
+			_, _ = conn.WriteToUDP(data, remote)
+		}
+	}()
+	return conn
+}
+
+func oidLess(a, b string) bool {
+	as, bs := strings.Split(strings.Trim(a, "."), "."), strings.Split(strings.Trim(b, "."), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func TestSNMPWalkFallback(t *testing.T) {
+	table := []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.2.2.1.2.1", Type: gosnmp.OctetString, Value: "eth0"},
+		{Name: ".1.3.6.1.2.1.2.2.1.2.2", Type: gosnmp.OctetString, Value: "eth1"},
+		{Name: ".1.3.6.1.2.1.2.2.1.3.1", Type: gosnmp.Integer, Value: 6},
+	}
+	conn := helperStartGetNextAgent(t, table)
+	defer conn.Close()
+
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		params := &gosnmp.GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+			Version:   version,
+			Community: "public",
+			Timeout:   200 * time.Millisecond,
+		}
+		require.Nil(t, params.Connect())
+
+		packets, err := fetchSNMPPackets(params, []string{".1.3.6.1.2.1.2.2.1.2"}, "walk")
+		require.Nil(t, err, version)
+		require.Len(t, packets, 2, version)
+		assert.Equal(t, []byte("eth1"), packets[1].Value)
+
+		packets, err = fetchSNMPPackets(params, []string{".1.3.6.1.2.1.2.2.1.2.2"}, "bulk")
+		require.Nil(t, err, version)
+		require.Len(t, packets, 1, version)
+		assert.Equal(t, ".1.3.6.1.2.1.2.2.1.3.1", packets[0].Name)
+
+		params.Conn.Close()
+	}
 }
@@ -0,0 +1,426 @@
+package frontman
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	snmpTrapOidVarbind   = ".1.3.6.1.6.3.1.1.4.1.0" // SNMPv2-MIB::snmpTrapOID.0
+	snmpSysUpTimeVarbind = ".1.3.6.1.2.1.1.3.0"     // SNMPv2-MIB::sysUpTime.0
+	snmpGenericTrapsOid  = ".1.3.6.1.6.3.1.1.5"     // SNMPv2-MIB::snmpTraps, RFC 3584 mapping of v1 generic traps
+)
+
+// max size of a SNMP message we accept
+const snmpTrapMaxMessageSize = 65535
+
+// snmpTrapReceiver listens for SNMP traps and informs and sends them as results to the hub
+type snmpTrapReceiver struct {
+	fm          *Frontman
+	conn        *net.UDPConn
+	communities map[string]bool
+	users       []*gosnmp.GoSNMP
+	engine      *snmpEngine // authoritative for SNMPv3 informs
+
+	// the results pipeline, fm.resultsChan is replaced by the check handler of the HTTP listener
+	results chan<- Result
+}
+
+func newSNMPTrapReceiver(fm *Frontman, cfg *SNMPTrapConfig, results chan<- Result) (*snmpTrapReceiver, error) {
+	r := &snmpTrapReceiver{
+		fm:          fm,
+		communities: make(map[string]bool),
+		results:     results,
+	}
+	for _, community := range cfg.Communities {
+		r.communities[community] = true
+	}
+
+	for i, user := range cfg.Users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("users[%d]: username is empty", i)
+		}
+		params, err := buildSNMPParameters(&SNMPCheckData{
+			Protocol:               "v3",
+			SecurityLevel:          user.SecurityLevel,
+			Username:               user.Username,
+			AuthenticationProtocol: user.AuthenticationProtocol,
+			AuthenticationPassword: user.AuthenticationPassword,
+			PrivacyProtocol:        user.PrivacyProtocol,
+			PrivacyPassword:        user.PrivacyPassword,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("users[%d]: %s", i, err)
+		}
+		// the USM parameters log while decoding and fail without a logger
+		params.SecurityParameters.(*gosnmp.UsmSecurityParameters).Logger = log.New(ioutil.Discard, "", 0)
+		r.users = append(r.users, params)
+	}
+
+	var err error
+	if r.engine, err = newSNMPEngine(cfg.EngineID, r.users); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// runSNMPTrapReceiver receives SNMP traps on Config.SNMPTrap.Listen until frontman is interrupted
+// and sends them to results
+func (fm *Frontman) runSNMPTrapReceiver(results chan<- Result) {
+	r, err := newSNMPTrapReceiver(fm, &fm.Config.SNMPTrap, results)
+	if err != nil {
+		logrus.Errorf("snmp trap: invalid configuration: %s", err)
+		return
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", fm.Config.SNMPTrap.Listen)
+	if err != nil {
+		logrus.Errorf("snmp trap: invalid listen address: %s", err)
+		return
+	}
+	r.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		logrus.Errorf("snmp trap: failed to listen: %s", err)
+		return
+	}
+	logrus.Infof("snmp trap: listening on %s", r.conn.LocalAddr())
+
+	go func() {
+		<-fm.InterruptChan
+		r.conn.Close()
+	}()
+
+	r.serve()
+}
+
+func (r *snmpTrapReceiver) serve() {
+	buf := make([]byte, snmpTrapMaxMessageSize)
+	for {
+		n, remote, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-r.fm.InterruptChan:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			logrus.Errorf("snmp trap: failed to receive: %s", err)
+			return
+		}
+
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		res, err := r.handleRecover(msg, remote)
+		if err != nil {
+			logrus.Debugf("snmp trap: dropped message from %s: %s", remote, err)
+			continue
+		}
+		r.results <- *res
+	}
+}
+
+// handles the message, a malformed one gosnmp panics on is dropped instead of stopping frontman
+func (r *snmpTrapReceiver) handleRecover(msg []byte, remote *net.UDPAddr) (res *Result, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			res, err = nil, fmt.Errorf("failed to decode: %v", p)
+		}
+	}()
+	return r.handle(msg, remote)
+}
+
+// decodes the message, acknowledges informs and returns the result to send to the hub
+func (r *snmpTrapReceiver) handle(msg []byte, remote *net.UDPAddr) (*Result, error) {
+	version, err := snmpMessageVersion(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var packet *gosnmp.SnmpPacket
+	switch version {
+	case gosnmp.Version1, gosnmp.Version2c:
+		packet, err = r.decodeCommunityMessage(msg)
+	case gosnmp.Version3:
+		packet, err = r.decodeUSMMessage(msg, remote)
+	default:
+		err = fmt.Errorf("unsupported version %d", version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if packet.PDUType == gosnmp.InformRequest {
+		if err := r.acknowledgeInform(packet, remote); err != nil {
+			logrus.Warnf("snmp trap: failed to acknowledge inform from %s: %s", remote, err)
+		}
+	}
+
+	return r.fm.snmpTrapResult(packet, remote), nil
+}
+
+func (r *snmpTrapReceiver) decodeCommunityMessage(msg []byte) (*gosnmp.SnmpPacket, error) {
+	pduOffset, err := snmpCommunityPDUOffset(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// gosnmp can't decode informs, but they only differ from SNMPv2 traps in the PDU tag
+	inform := gosnmp.PDUType(msg[pduOffset]) == gosnmp.InformRequest
+	if inform {
+		msg[pduOffset] = byte(gosnmp.SNMPv2Trap)
+	}
+
+	packet := (&gosnmp.GoSNMP{}).UnmarshalTrap(msg)
+	if packet == nil {
+		return nil, fmt.Errorf("failed to decode")
+	}
+	if len(r.communities) > 0 && !r.communities[packet.Community] {
+		return nil, fmt.Errorf("unknown community '%s'", packet.Community)
+	}
+	if inform {
+		packet.PDUType = gosnmp.InformRequest
+	}
+	return packet, nil
+}
+
+// decodes informs with the local engine, for traps tries the configured users until one authenticates the message
+func (r *snmpTrapReceiver) decodeUSMMessage(msg []byte, remote *net.UDPAddr) (*gosnmp.SnmpPacket, error) {
+	if m, err := parseSNMPv3Message(msg); err == nil && m.flags&gosnmp.Reportable != 0 && (m.engineID == "" || m.engineID == r.engine.id) {
+		// the receiver is the authoritative engine of informs and of the discovery preceding them,
+		// traps are sent with the engine id of the sender
+		packet, report, err := r.engine.process(msg)
+		if report != nil {
+			if _, err := r.conn.WriteToUDP(report, remote); err != nil {
+				logrus.Warnf("snmp trap: failed to send report to %s: %s", remote, err)
+			}
+		}
+		return packet, err
+	}
+
+	for _, params := range r.users {
+		// decoding modifies the message
+		buf := make([]byte, len(msg))
+		copy(buf, msg)
+
+		packet := params.UnmarshalTrap(buf)
+		if packet == nil {
+			continue
+		}
+		sp, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if !ok || sp.UserName != params.SecurityParameters.(*gosnmp.UsmSecurityParameters).UserName {
+			continue
+		}
+		return packet, nil
+	}
+	return nil, fmt.Errorf("no configured user could decode the message")
+}
+
+// sends a response with the request id and the varbinds of the inform
+func (r *snmpTrapReceiver) acknowledgeInform(inform *gosnmp.SnmpPacket, remote *net.UDPAddr) error {
+	response := &gosnmp.SnmpPacket{
+		Version:         inform.Version,
+		Community:       inform.Community,
+		ContextEngineID: inform.ContextEngineID,
+		ContextName:     inform.ContextName,
+		PDUType:         gosnmp.GetResponse,
+		RequestID:       inform.RequestID,
+		Variables:       snmpResponseVariables(inform.Variables),
+	}
+	marshal := response.MarshalMsg
+	if inform.Version == gosnmp.Version3 {
+		marshal = func() ([]byte, error) {
+			return r.engine.response(inform, response)
+		}
+	}
+	data, err := marshal()
+	if err != nil {
+		// the request id is enough for the sender to match the response
+		response.Variables = nil
+		if data, err = marshal(); err != nil {
+			return err
+		}
+	}
+	_, err = r.conn.WriteToUDP(data, remote)
+	return err
+}
+
+// converts decoded varbinds to the value types gosnmp expects when encoding
+func snmpResponseVariables(variables []gosnmp.SnmpPDU) []gosnmp.SnmpPDU {
+	res := make([]gosnmp.SnmpPDU, 0, len(variables))
+	for _, v := range variables {
+		switch v.Type {
+		case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+			if val, ok := v.Value.(uint); ok {
+				v.Value = uint32(val)
+			}
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// builds the result of a received trap
+func (fm *Frontman) snmpTrapResult(packet *gosnmp.SnmpPacket, remote *net.UDPAddr) *Result {
+	m := map[string]interface{}{
+		"snmpTrap.source":  remote.IP.String(),
+		"snmpTrap.version": snmpVersionName(packet.Version),
+		"snmpTrap.type":    "trap",
+	}
+	if packet.PDUType == gosnmp.InformRequest {
+		m["snmpTrap.type"] = "inform"
+	}
+	if packet.Version == gosnmp.Version3 {
+		if sp, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+			m["snmpTrap.username"] = sp.UserName
+		}
+	} else {
+		m["snmpTrap.community"] = packet.Community
+	}
+
+	var trapOid string
+	if packet.PDUType == gosnmp.Trap {
+		trapOid = snmpV1TrapOid(packet.Enterprise, packet.GenericTrap, packet.SpecificTrap)
+		m["snmpTrap.agent_address"] = packet.AgentAddress
+		m["snmpTrap.uptime"] = packet.Timestamp
+	}
+
+	var varbinds []map[string]interface{}
+	for _, variable := range packet.Variables {
+		name := normalizeSNMPOid(variable.Name)
+		switch {
+		case name == snmpSysUpTimeVarbind:
+			m["snmpTrap.uptime"] = variable.Value
+			continue
+		case name == snmpTrapOidVarbind:
+			if oid, ok := variable.Value.(string); ok {
+				trapOid = normalizeSNMPOid(oid)
+			}
+			continue
+		}
+
+		val, ok := snmpTableValue(&SNMPTableColumn{}, variable)
+		if !ok {
+			logrus.Debugf("snmp trap: unhandled type %#v for %s: %v", variable.Type, name, variable.Value)
+			continue
+		}
+		vb := map[string]interface{}{"oid": name, "value": val}
+		if oidName, ok := fm.snmpOidName(name); ok {
+			vb["name"] = oidName
+		}
+		if variable.Type == gosnmp.Integer {
+			if enum, ok := fm.snmpEnumValue(name, variable.Value.(int)); ok {
+				vb["value"] = enum
+			}
+		}
+		varbinds = append(varbinds, vb)
+	}
+
+	m["snmpTrap.oid"] = trapOid
+	if oidName, ok := fm.snmpOidName(trapOid); ok {
+		m["snmpTrap.name"] = oidName
+	}
+	m["snmpTrap.varbinds"] = varbinds
+
+	return &Result{
+		CheckType:    "snmpTrap",
+		Timestamp:    time.Now().Unix(),
+		Measurements: m,
+	}
+}
+
+// translates the fields of a SNMPv1 trap to the SNMPv2 trap oid like described in RFC 3584
+func snmpV1TrapOid(enterprise string, genericTrap, specificTrap int) string {
+	if genericTrap >= 0 && genericTrap < 6 {
+		return fmt.Sprintf("%s.%d", snmpGenericTrapsOid, genericTrap+1)
+	}
+	return fmt.Sprintf("%s.0.%d", normalizeSNMPOid(enterprise), specificTrap)
+}
+
+func normalizeSNMPOid(oid string) string {
+	if oid == "" || strings.HasPrefix(oid, ".") {
+		return oid
+	}
+	return "." + oid
+}
+
+func snmpVersionName(version gosnmp.SnmpVersion) string {
+	switch version {
+	case gosnmp.Version1:
+		return "v1"
+	case gosnmp.Version2c:
+		return "v2c"
+	case gosnmp.Version3:
+		return "v3"
+	}
+	return fmt.Sprintf("%d", version)
+}
+
+// parses the tag and length of a BER encoded field, returns the size of the header and the length of the content.
+// Lengths of more than 3 bytes are rejected, they exceed any SNMP message and overflow int on 32-bit platforms
+func berHeader(data []byte) (header int, length int, err error) {
+	if len(data) < 2 {
+		return 0, 0, fmt.Errorf("truncated message")
+	}
+	if data[1] < 0x80 {
+		return 2, int(data[1]), nil
+	}
+	n := int(data[1] & 0x7f)
+	if n == 0 || n > 3 || len(data) < 2+n {
+		return 0, 0, fmt.Errorf("invalid length")
+	}
+	for _, b := range data[2 : 2+n] {
+		length = length<<8 | int(b)
+	}
+	if length < 0 {
+		return 0, 0, fmt.Errorf("invalid length")
+	}
+	return 2 + n, length, nil
+}
+
+// returns the version field of a SNMP message
+func snmpMessageVersion(msg []byte) (gosnmp.SnmpVersion, error) {
+	if len(msg) == 0 || gosnmp.PDUType(msg[0]) != gosnmp.Sequence {
+		return 0, fmt.Errorf("not a SNMP message")
+	}
+	header, _, err := berHeader(msg)
+	if err != nil {
+		return 0, err
+	}
+	versionHeader, versionLength, err := berHeader(msg[header:])
+	if err != nil {
+		return 0, err
+	}
+	if gosnmp.Asn1BER(msg[header]) != gosnmp.Integer || versionLength != 1 || len(msg) < header+versionHeader+1 {
+		return 0, fmt.Errorf("invalid version field")
+	}
+	return gosnmp.SnmpVersion(msg[header+versionHeader]), nil
+}
+
+// returns the offset of the PDU in a SNMPv1 or SNMPv2c message
+func snmpCommunityPDUOffset(msg []byte) (int, error) {
+	offset, _, err := berHeader(msg)
+	if err != nil {
+		return 0, err
+	}
+	// skip version and community
+	for i := 0; i < 2; i++ {
+		header, length, err := berHeader(msg[offset:])
+		if err != nil {
+			return 0, err
+		}
+		offset += header + length
+		if offset >= len(msg) {
+			return 0, fmt.Errorf("truncated message")
+		}
+	}
+	return offset, nil
+}
@@ -0,0 +1,548 @@
+package frontman
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soniah/gosnmp"
+)
+
+// SNMP-USER-BASED-SM-MIB counters reported to senders of informs, see RFC 3414 section 3.2
+const (
+	snmpUnsupportedSecLevelsOid = ".1.3.6.1.6.3.15.1.1.1.0"
+	snmpNotInTimeWindowsOid     = ".1.3.6.1.6.3.15.1.1.2.0"
+	snmpUnknownUserNamesOid     = ".1.3.6.1.6.3.15.1.1.3.0"
+	snmpUnknownEngineIDsOid     = ".1.3.6.1.6.3.15.1.1.4.0"
+	snmpWrongDigestsOid         = ".1.3.6.1.6.3.15.1.1.5.0"
+	snmpDecryptionErrorsOid     = ".1.3.6.1.6.3.15.1.1.6.0"
+)
+
+// max difference in seconds between the engine time of an inform and the local engine
+const snmpTimeWindow = 150
+
+// snmpEngine is the local SNMPv3 engine of the trap receiver.
+// It is authoritative for informs, senders discover its id, boots and time from the reports it sends (RFC 3414)
+type snmpEngine struct {
+	id      string
+	boots   uint32
+	started time.Time
+	users   map[string]*snmpEngineUser
+
+	lock     sync.Mutex
+	counters map[string]uint32
+}
+
+// keys of a SNMPv3 user localized to the engine id
+type snmpEngineUser struct {
+	name         string
+	level        gosnmp.SnmpV3MsgFlags
+	authProtocol gosnmp.SnmpV3AuthProtocol
+	privProtocol gosnmp.SnmpV3PrivProtocol
+	authKey      []byte
+	privKey      []byte
+}
+
+// a SNMPv3 message decoded up to the scoped PDU
+type snmpV3Message struct {
+	msgID      uint32
+	flags      gosnmp.SnmpV3MsgFlags
+	engineID   string
+	boots      uint32
+	time       uint32
+	userName   string
+	authParams []byte
+	authOffset int // position of authParams in the message
+	privParams []byte
+	scopedPDU  []byte // encrypted if the privacy flag is set
+}
+
+// newSNMPEngine creates the engine with the users of the trap receiver, engineID is a hex string or empty
+func newSNMPEngine(engineID string, users []*gosnmp.GoSNMP) (*snmpEngine, error) {
+	e := &snmpEngine{
+		started:  time.Now(),
+		users:    make(map[string]*snmpEngineUser),
+		counters: make(map[string]uint32),
+	}
+	// boots have to increase with every restart as long as the engine id stays the same
+	e.boots = uint32(e.started.Unix())
+
+	if engineID != "" {
+		id, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(engineID), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid engine_id: %s", err)
+		}
+		if len(id) < 5 || len(id) > 32 {
+			return nil, fmt.Errorf("invalid engine_id: expected 5 to 32 bytes, got %d", len(id))
+		}
+		e.id = string(id)
+	} else {
+		e.id = defaultSNMPEngineID()
+	}
+
+	for _, params := range users {
+		sp := params.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+		if _, exists := e.users[sp.UserName]; exists {
+			continue
+		}
+		user := &snmpEngineUser{
+			name:         sp.UserName,
+			level:        params.MsgFlags & gosnmp.AuthPriv,
+			authProtocol: sp.AuthenticationProtocol,
+			privProtocol: sp.PrivacyProtocol,
+		}
+		if user.level&gosnmp.AuthNoPriv != 0 {
+			user.authKey = snmpLocalizedKey(sp.AuthenticationProtocol, sp.AuthenticationPassphrase, e.id)
+		}
+		if user.level == gosnmp.AuthPriv {
+			user.privKey = snmpLocalizedKey(sp.AuthenticationProtocol, sp.PrivacyPassphrase, e.id)
+		}
+		e.users[user.name] = user
+	}
+	return e, nil
+}
+
+// derives an engine id in the text format of RFC 3411 from the hostname
+func defaultSNMPEngineID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "frontman"
+	}
+	id := "\x80\x00\x00\x00\x04" + hostname
+	if len(id) > 32 {
+		id = id[0:32]
+	}
+	return id
+}
+
+// time returns the seconds since the engine was started
+func (e *snmpEngine) time() uint32 {
+	return uint32(time.Since(e.started) / time.Second)
+}
+
+// process decodes an inform addressed to the engine.
+// report is a message to send back to the sender if the inform was refused
+func (e *snmpEngine) process(msg []byte) (packet *gosnmp.SnmpPacket, report []byte, err error) {
+	m, err := parseSNMPv3Message(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.engineID != e.id {
+		// engine discovery, the sender learns the id from the report
+		report, _ = e.report(m, nil, snmpUnknownEngineIDsOid)
+		if m.engineID == "" {
+			return nil, report, fmt.Errorf("engine id discovery")
+		}
+		return nil, report, fmt.Errorf("unknown engine id %x", m.engineID)
+	}
+
+	user := e.users[m.userName]
+	if user == nil {
+		report, _ = e.report(m, nil, snmpUnknownUserNamesOid)
+		return nil, report, fmt.Errorf("unknown user '%s'", m.userName)
+	}
+	level := m.flags & gosnmp.AuthPriv
+	if level != user.level {
+		report, _ = e.report(m, nil, snmpUnsupportedSecLevelsOid)
+		return nil, report, fmt.Errorf("security level doesn't match the configuration of user '%s'", m.userName)
+	}
+
+	if level&gosnmp.AuthNoPriv != 0 && !user.authentic(msg, m) {
+		report, _ = e.report(m, nil, snmpWrongDigestsOid)
+		return nil, report, fmt.Errorf("wrong digest for user '%s'", m.userName)
+	}
+
+	scopedPDU := m.scopedPDU
+	if level == gosnmp.AuthPriv {
+		if scopedPDU, err = user.decrypt(m.scopedPDU, m.privParams); err != nil {
+			report, _ = e.report(m, nil, snmpDecryptionErrorsOid)
+			return nil, report, err
+		}
+	}
+	contextEngineID, contextName, pdu, err := parseSNMPScopedPDU(scopedPDU)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if level&gosnmp.AuthNoPriv != 0 && !e.inTimeWindow(m) {
+		// the authenticated report lets the sender synchronize boots and time
+		m.scopedPDU = scopedPDU
+		report, _ = e.report(m, user, snmpNotInTimeWindowsOid)
+		return nil, report, fmt.Errorf("not in time window")
+	}
+
+	if gosnmp.PDUType(pdu[0]) != gosnmp.InformRequest {
+		return nil, nil, fmt.Errorf("unsupported PDU type %#x", pdu[0])
+	}
+	packet, err = unmarshalSNMPPDU(pdu)
+	if err != nil {
+		return nil, nil, err
+	}
+	packet.Version = gosnmp.Version3
+	packet.PDUType = gosnmp.InformRequest
+	packet.Community = ""
+	packet.MsgID = m.msgID
+	packet.MsgFlags = level
+	packet.SecurityModel = gosnmp.UserSecurityModel
+	packet.SecurityParameters = &gosnmp.UsmSecurityParameters{UserName: m.userName}
+	packet.ContextEngineID = contextEngineID
+	packet.ContextName = contextName
+	return packet, nil, nil
+}
+
+// inTimeWindow checks the timeliness of an authenticated message, see RFC 3414 section 3.2 step 7
+func (e *snmpEngine) inTimeWindow(m *snmpV3Message) bool {
+	if m.boots != e.boots {
+		return false
+	}
+	diff := int64(m.time) - int64(e.time())
+	return diff >= -snmpTimeWindow && diff <= snmpTimeWindow
+}
+
+// report increments the counter and returns a report to the sender of the message if it requested one.
+// Reports are authenticated if user is set
+func (e *snmpEngine) report(m *snmpV3Message, user *snmpEngineUser, oid string) ([]byte, error) {
+	e.lock.Lock()
+	e.counters[oid]++
+	count := e.counters[oid]
+	e.lock.Unlock()
+
+	if m.flags&gosnmp.Reportable == 0 {
+		return nil, nil
+	}
+
+	var requestID uint32
+	if m.flags&gosnmp.AuthPriv != gosnmp.AuthPriv || user != nil {
+		// the request id is only known if the scoped PDU could be read
+		if _, _, pdu, err := parseSNMPScopedPDU(m.scopedPDU); err == nil {
+			requestID = snmpPDURequestID(pdu)
+		}
+	}
+
+	level := gosnmp.NoAuthNoPriv
+	userName := m.userName
+	if user != nil {
+		level = gosnmp.AuthNoPriv
+	} else if m.engineID != e.id {
+		userName = ""
+	}
+	return e.marshal(user, level, userName, m.msgID, &gosnmp.SnmpPacket{
+		PDUType:   gosnmp.Report,
+		RequestID: requestID,
+		Variables: []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Counter32, Value: count}},
+	})
+}
+
+// marshal encodes a message of the engine with the security level, the keys of user are used if it's authenticated
+func (e *snmpEngine) marshal(user *snmpEngineUser, level gosnmp.SnmpV3MsgFlags, userName string, msgID uint32, packet *gosnmp.SnmpPacket) ([]byte, error) {
+	sp := &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    e.id,
+		AuthoritativeEngineBoots: e.boots,
+		AuthoritativeEngineTime:  e.time(),
+		UserName:                 userName,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}
+	if level&gosnmp.AuthNoPriv != 0 {
+		sp.AuthenticationProtocol = user.authProtocol
+		sp.SecretKey = user.authKey
+	}
+	if level == gosnmp.AuthPriv {
+		// DES salt: engine boots and a random integer, RFC 3414 section 8.1.1.1
+		sp.PrivacyProtocol = user.privProtocol
+		sp.PrivacyKey = user.privKey
+		sp.PrivacyParameters = make([]byte, 8)
+		binary.BigEndian.PutUint32(sp.PrivacyParameters, e.boots)
+		if _, err := rand.Read(sp.PrivacyParameters[4:]); err != nil {
+			return nil, err
+		}
+	}
+
+	packet.Version = gosnmp.Version3
+	packet.MsgFlags = level
+	packet.MsgID = msgID
+	packet.SecurityModel = gosnmp.UserSecurityModel
+	packet.SecurityParameters = sp
+	if packet.ContextEngineID == "" {
+		packet.ContextEngineID = e.id
+	}
+	return packet.MarshalMsg()
+}
+
+// response encodes the response to an inform decoded by process
+func (e *snmpEngine) response(inform, response *gosnmp.SnmpPacket) ([]byte, error) {
+	userName := inform.SecurityParameters.(*gosnmp.UsmSecurityParameters).UserName
+	user := e.users[userName]
+	if user == nil {
+		return nil, fmt.Errorf("unknown user '%s'", userName)
+	}
+	return e.marshal(user, inform.MsgFlags&gosnmp.AuthPriv, userName, inform.MsgID, response)
+}
+
+// authentic verifies the HMAC-96 of the message, see RFC 3414 section 6.3.2 and 7.3.2
+func (u *snmpEngineUser) authentic(msg []byte, m *snmpV3Message) bool {
+	if len(m.authParams) != 12 {
+		return false
+	}
+	buf := make([]byte, len(msg))
+	copy(buf, msg)
+	copy(buf[m.authOffset:m.authOffset+12], make([]byte, 12))
+
+	mac := hmac.New(snmpAuthHash(u.authProtocol), u.authKey)
+	mac.Write(buf)
+	return hmac.Equal(mac.Sum(nil)[0:12], m.authParams)
+}
+
+// decrypt returns the plain text of a DES encrypted scoped PDU, see RFC 3414 section 8.3.2
+func (u *snmpEngineUser) decrypt(data, privParams []byte) ([]byte, error) {
+	if u.privProtocol != gosnmp.DES {
+		return nil, fmt.Errorf("unsupported privacy protocol")
+	}
+	if len(privParams) != 8 || len(data) == 0 || len(data)%des.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted PDU")
+	}
+	block, err := des.NewCipher(u.privKey[0:8])
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, des.BlockSize)
+	for i := range iv {
+		iv[i] = u.privKey[8+i] ^ privParams[i]
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	return plain, nil
+}
+
+func snmpAuthHash(protocol gosnmp.SnmpV3AuthProtocol) func() hash.Hash {
+	if protocol == gosnmp.SHA {
+		return sha1.New
+	}
+	return md5.New
+}
+
+// snmpLocalizedKey derives the key of a password and localizes it to the engine id, see RFC 3414 A.2
+func snmpLocalizedKey(protocol gosnmp.SnmpV3AuthProtocol, password, engineID string) []byte {
+	h := snmpAuthHash(protocol)()
+	buf := make([]byte, 64)
+	for count := 0; count < 1048576; count += len(buf) {
+		for i := range buf {
+			buf[i] = password[(count+i)%len(password)]
+		}
+		h.Write(buf)
+	}
+	key := h.Sum(nil)
+
+	h.Reset()
+	h.Write(key)
+	h.Write([]byte(engineID))
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+// parseSNMPv3Message decodes the header and the USM security parameters of a SNMPv3 message
+func parseSNMPv3Message(msg []byte) (*snmpV3Message, error) {
+	m := &snmpV3Message{}
+	pos, _, err := berField(msg, 0, byte(gosnmp.Sequence))
+	if err != nil {
+		return nil, err
+	}
+	// version
+	if _, pos, err = berField(msg, pos, byte(gosnmp.Integer)); err != nil {
+		return nil, err
+	}
+
+	// msgGlobalData: msgID, msgMaxSize, msgFlags, msgSecurityModel
+	start, end, err := berField(msg, pos, byte(gosnmp.Sequence))
+	if err != nil {
+		return nil, err
+	}
+	pos = end
+	var fields [4][]byte
+	tags := [4]byte{byte(gosnmp.Integer), byte(gosnmp.Integer), byte(gosnmp.OctetString), byte(gosnmp.Integer)}
+	for i := range fields {
+		var s int
+		if s, start, err = berField(msg, start, tags[i]); err != nil {
+			return nil, err
+		}
+		fields[i] = msg[s:start]
+	}
+	msgID, err := berInt(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	m.msgID = uint32(msgID)
+	if len(fields[2]) != 1 {
+		return nil, fmt.Errorf("invalid msgFlags")
+	}
+	m.flags = gosnmp.SnmpV3MsgFlags(fields[2][0])
+	if model, err := berInt(fields[3]); err != nil || model != int64(gosnmp.UserSecurityModel) {
+		return nil, fmt.Errorf("unsupported security model")
+	}
+
+	// msgSecurityParameters: OCTET STRING containing the USM parameters
+	start, end, err = berField(msg, pos, byte(gosnmp.OctetString))
+	if err != nil {
+		return nil, err
+	}
+	pos = end
+	if start, _, err = berField(msg, start, byte(gosnmp.Sequence)); err != nil {
+		return nil, err
+	}
+	tags = [4]byte{byte(gosnmp.OctetString), byte(gosnmp.Integer), byte(gosnmp.Integer), byte(gosnmp.OctetString)}
+	for i := range fields {
+		var s int
+		if s, start, err = berField(msg, start, tags[i]); err != nil {
+			return nil, err
+		}
+		fields[i] = msg[s:start]
+	}
+	m.engineID = string(fields[0])
+	boots, err := berInt(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	engineTime, err := berInt(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	m.boots, m.time = uint32(boots), uint32(engineTime)
+	m.userName = string(fields[3])
+
+	s, e, err := berField(msg, start, byte(gosnmp.OctetString))
+	if err != nil {
+		return nil, err
+	}
+	m.authParams, m.authOffset = msg[s:e], s
+	if s, e, err = berField(msg, e, byte(gosnmp.OctetString)); err != nil {
+		return nil, err
+	}
+	m.privParams = msg[s:e]
+
+	// msgData: plain text scoped PDU or encrypted OCTET STRING
+	if m.flags&gosnmp.AuthPriv == gosnmp.AuthPriv {
+		s, e, err = berField(msg, pos, byte(gosnmp.OctetString))
+		if err != nil {
+			return nil, err
+		}
+		m.scopedPDU = msg[s:e]
+	} else {
+		if _, e, err = berField(msg, pos, byte(gosnmp.Sequence)); err != nil {
+			return nil, err
+		}
+		m.scopedPDU = msg[pos:e]
+	}
+	return m, nil
+}
+
+// parseSNMPScopedPDU returns the context and the PDU of a plain text scoped PDU, trailing padding is ignored
+func parseSNMPScopedPDU(data []byte) (contextEngineID, contextName string, pdu []byte, err error) {
+	start, end, err := berField(data, 0, byte(gosnmp.Sequence))
+	if err != nil {
+		return "", "", nil, err
+	}
+	s, pos, err := berField(data, start, byte(gosnmp.OctetString))
+	if err != nil {
+		return "", "", nil, err
+	}
+	contextEngineID = string(data[s:pos])
+	if s, pos, err = berField(data, pos, byte(gosnmp.OctetString)); err != nil {
+		return "", "", nil, err
+	}
+	contextName = string(data[s:pos])
+
+	if pos >= end {
+		return "", "", nil, fmt.Errorf("missing PDU")
+	}
+	_, e, err := berField(data[0:end], pos, data[pos])
+	if err != nil {
+		return "", "", nil, err
+	}
+	return contextEngineID, contextName, data[pos:e], nil
+}
+
+// snmpPDURequestID returns the request id of a PDU, 0 if it can't be read
+func snmpPDURequestID(pdu []byte) uint32 {
+	header, _, err := berHeader(pdu)
+	if err != nil {
+		return 0
+	}
+	s, e, err := berField(pdu, header, byte(gosnmp.Integer))
+	if err != nil {
+		return 0
+	}
+	id, err := berInt(pdu[s:e])
+	if err != nil {
+		return 0
+	}
+	return uint32(id)
+}
+
+// unmarshalSNMPPDU decodes a PDU with gosnmp by wrapping it into a SNMPv2c trap message
+func unmarshalSNMPPDU(pdu []byte) (*gosnmp.SnmpPacket, error) {
+	body := []byte{byte(gosnmp.Integer), 1, byte(gosnmp.Version2c), byte(gosnmp.OctetString), 0, byte(gosnmp.SNMPv2Trap)}
+	body = append(body, pdu[1:]...)
+	msg := append([]byte{byte(gosnmp.Sequence)}, berLength(len(body))...)
+	msg = append(msg, body...)
+
+	packet := (&gosnmp.GoSNMP{}).UnmarshalTrap(msg)
+	if packet == nil {
+		return nil, fmt.Errorf("failed to decode PDU")
+	}
+	return packet, nil
+}
+
+// berField reads the field with the expected tag at pos, returns the start and end of its content
+func berField(data []byte, pos int, tag byte) (start, end int, err error) {
+	if pos >= len(data) || data[pos] != tag {
+		return 0, 0, fmt.Errorf("expected tag %#x at offset %d", tag, pos)
+	}
+	header, length, err := berHeader(data[pos:])
+	if err != nil {
+		return 0, 0, err
+	}
+	start, end = pos+header, pos+header+length
+	if length < 0 || end < start {
+		return 0, 0, fmt.Errorf("invalid length")
+	}
+	if end > len(data) {
+		return 0, 0, fmt.Errorf("truncated message")
+	}
+	return start, end, nil
+}
+
+// berInt decodes the content of a BER INTEGER
+func berInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, fmt.Errorf("invalid integer")
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+// berLength encodes the length of a BER field
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
@@ -0,0 +1,551 @@
+package frontman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// max size of a spool segment file before a new one is started
+const spoolSegmentBytes = 4 << 20
+
+// number of results waiting to be written to the spool
+const spoolQueueSize = 100
+
+const (
+	spoolSegmentExt = ".jsonl"
+	spoolAckFile    = "ack.json"
+)
+
+// position of a result in the spool
+type spoolPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// resultSpool is a write-ahead log of results not accepted by the hub yet.
+// Results are appended as JSON lines to segment files,
+// the ack file keeps the position of the first result not sent
+type resultSpool struct {
+	dir          string
+	maxBytes     int64
+	maxAge       time.Duration
+	segmentBytes int64
+
+	lock     sync.Mutex
+	segments []uint64 // oldest first, results are appended to the last one
+	writer   *os.File
+	written  int64 // size of the last segment
+	ack      spoolPosition
+	pending  int   // results not sent
+	size     int64 // size of all segments
+}
+
+// openResultSpool opens the spool in dir and continues with the results not sent before
+func openResultSpool(dir string, maxBytes int64, maxAge time.Duration) (*resultSpool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &resultSpool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		maxAge:       maxAge,
+		segmentBytes: spoolSegmentBytes,
+	}
+	// keep a few segments, so the oldest can be dropped without losing most of the spool
+	if maxBytes > 0 && maxBytes/4 < s.segmentBytes {
+		s.segmentBytes = maxBytes / 4
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if seq, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), spoolSegmentExt), 10, 64); err == nil && strings.HasSuffix(f.Name(), spoolSegmentExt) {
+			s.segments = append(s.segments, seq)
+		}
+	}
+
+	if err := s.readAck(); err != nil {
+		return nil, err
+	}
+
+	var kept []uint64
+	for _, seq := range s.segments {
+		if seq < s.ack.Segment {
+			// all results were sent
+			if err := os.Remove(s.segmentPath(seq)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		kept = append(kept, seq)
+	}
+	s.segments = kept
+
+	if len(s.segments) > 0 {
+		// a crash could have left a partially written result behind
+		if err := truncatePartialLine(s.segmentPath(s.segments[len(s.segments)-1])); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, seq := range s.segments {
+		fi, err := os.Stat(s.segmentPath(seq))
+		if err != nil {
+			return nil, err
+		}
+		s.size += fi.Size()
+
+		n, err := s.countResults(seq)
+		if err != nil {
+			return nil, err
+		}
+		s.pending += n
+	}
+
+	next := s.ack.Segment + 1
+	if len(s.segments) > 0 && s.segments[len(s.segments)-1] >= next {
+		next = s.segments[len(s.segments)-1] + 1
+	}
+	if err := s.openSegment(next); err != nil {
+		return nil, err
+	}
+
+	if s.pending > 0 {
+		logrus.Infof("result spool: %d unsent results found in %s", s.pending, dir)
+	}
+	return s, nil
+}
+
+func (s *resultSpool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+func (s *resultSpool) readAck() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, spoolAckFile))
+	if os.IsNotExist(err) {
+		if len(s.segments) > 0 {
+			s.ack = spoolPosition{Segment: s.segments[0]}
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.ack)
+}
+
+// writes the ack file atomically, so a crash never leaves a position pointing to sent results
+func (s *resultSpool) writeAck(pos spoolPosition) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, spoolAckFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func truncatePartialLine(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete == len(data) {
+		return nil
+	}
+	logrus.Warnf("result spool: dropping incomplete result at the end of %s", path)
+	return os.Truncate(path, int64(complete))
+}
+
+// returns the number of results in the segment not sent yet
+func (s *resultSpool) countResults(seq uint64) (int, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if seq == s.ack.Segment {
+		if _, err := f.Seek(s.ack.Offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	r := bufio.NewReader(f)
+	for {
+		_, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func (s *resultSpool) openSegment(seq uint64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.writer = f
+	s.written = 0
+	s.segments = append(s.segments, seq)
+	return nil
+}
+
+// append writes the results to disk, they are kept until commit or the size limit is exceeded
+func (s *resultSpool) append(results []Result) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.written > 0 && s.written+int64(buf.Len()) > s.segmentBytes {
+		if err := s.writer.Close(); err != nil {
+			return err
+		}
+		if err := s.openSegment(s.segments[len(s.segments)-1] + 1); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.writer.Write(buf.Bytes())
+	s.written += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := s.writer.Sync(); err != nil {
+		return err
+	}
+	s.pending += len(results)
+
+	return s.dropOldest()
+}
+
+// drops the oldest segments while the spool exceeds maxBytes
+func (s *resultSpool) dropOldest() error {
+	dropped := 0
+	for s.maxBytes > 0 && s.size > s.maxBytes && len(s.segments) > 1 {
+		seq := s.segments[0]
+		n, err := s.countResults(seq)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(s.segmentPath(seq))
+		if err != nil {
+			return err
+		}
+
+		next := spoolPosition{Segment: s.segments[1]}
+		if err := s.writeAck(next); err != nil {
+			return err
+		}
+		s.ack = next
+		s.pending -= n
+		dropped += n
+
+		if err := os.Remove(s.segmentPath(seq)); err != nil {
+			return err
+		}
+		s.size -= fi.Size()
+		s.segments = s.segments[1:]
+	}
+	if dropped > 0 {
+		logrus.Errorf("result spool exceeds %d bytes, dropped the %d oldest results", s.maxBytes, dropped)
+	}
+	return nil
+}
+
+// next reads up to max results to send in order. Results older than maxAge are skipped.
+// end and consumed must be passed to commit once the results were sent
+func (s *resultSpool) next(max int) (results []Result, end spoolPosition, consumed int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	end = s.ack
+	expired := 0
+	for _, seq := range s.segments {
+		if seq < end.Segment {
+			continue
+		} else if seq > end.Segment {
+			end = spoolPosition{Segment: seq}
+		}
+
+		f, err := os.Open(s.segmentPath(seq))
+		if err != nil {
+			return nil, s.ack, 0, err
+		}
+		if _, err := f.Seek(end.Offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, s.ack, 0, err
+		}
+
+		r := bufio.NewReader(f)
+		for len(results) < max {
+			line, err := r.ReadBytes('\n')
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				f.Close()
+				return nil, s.ack, 0, err
+			}
+			end.Offset += int64(len(line))
+			consumed++
+
+			var res Result
+			if err := json.Unmarshal(line, &res); err != nil {
+				logrus.Warnf("result spool: skipping unreadable result in %s: %s", f.Name(), err)
+				continue
+			}
+			if s.maxAge > 0 && time.Since(time.Unix(res.Timestamp, 0)) > s.maxAge {
+				expired++
+				continue
+			}
+			results = append(results, res)
+		}
+		f.Close()
+
+		if len(results) >= max {
+			break
+		}
+	}
+
+	if expired > 0 {
+		logrus.Warnf("result spool: skipping %d results older than %v", expired, s.maxAge)
+	}
+	return results, end, consumed, nil
+}
+
+// commit marks the results up to end as sent and removes segments not needed anymore
+func (s *resultSpool) commit(end spoolPosition, consumed int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.commitLocked(end, consumed)
+}
+
+func (s *resultSpool) commitLocked(end spoolPosition, consumed int) error {
+	if end.Segment < s.ack.Segment {
+		// the segment was dropped meanwhile as the spool exceeded maxBytes
+		return nil
+	}
+	if err := s.writeAck(end); err != nil {
+		return err
+	}
+	s.ack = end
+	s.pending -= consumed
+
+	for len(s.segments) > 1 && s.segments[0] < end.Segment {
+		path := s.segmentPath(s.segments[0])
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		s.size -= fi.Size()
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// discard marks all results as sent
+func (s *resultSpool) discard() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	end := spoolPosition{Segment: s.segments[len(s.segments)-1], Offset: s.written}
+	return s.commitLocked(end, s.pending)
+}
+
+// stats returns the number of results not sent and the size of the spool in bytes
+func (s *resultSpool) stats() (int, int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.pending, s.size
+}
+
+func (s *resultSpool) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.writer.Close()
+}
+
+// writes the queued results to the spool, used in continuous mode.
+// Once frontman is interrupted the queue is drained and the spool closed before TerminateQueue is done
+func (fm *Frontman) startResultSpoolWriter() {
+	fm.TerminateQueue.Add(1)
+	go func() {
+		defer fm.TerminateQueue.Done()
+		fm.spoolResultsContinuous()
+		if err := fm.spool.close(); err != nil {
+			logrus.Errorf("result spool: failed to close: %s", err)
+		}
+	}()
+}
+
+// writes the queued results to the spool until frontman is interrupted
+func (fm *Frontman) spoolResultsContinuous() {
+	for {
+		select {
+		case <-fm.InterruptChan:
+			// keep the results queued so far and those the stream hands back when it stops
+			streamStopped := fm.stream.stopped()
+			for {
+				select {
+				case <-streamStopped:
+					for len(fm.spoolQueue) > 0 {
+						fm.spoolQueuedResults(nil)
+					}
+					return
+				case res := <-fm.spoolQueue:
+					fm.spoolQueuedResults([]Result{res})
+				}
+			}
+		case res := <-fm.spoolQueue:
+			fm.spoolQueuedResults([]Result{res})
+		}
+	}
+}
+
+// writes batch and the results waiting in spoolQueue to the spool with a single write
+func (fm *Frontman) spoolQueuedResults(batch []Result) {
+collect:
+	for len(batch) < fm.Config.SenderBatchSize {
+		select {
+		case res := <-fm.spoolQueue:
+			batch = append(batch, res)
+		default:
+			break collect
+		}
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := fm.spool.append(batch); err != nil {
+		logrus.Errorf("result spool: failed to write %d results: %s", len(batch), err)
+	}
+}
+
+// sends the spooled results to the hub in order until frontman is interrupted.
+// Unsent results stay in the spool and are sent after the next start
+func (fm *Frontman) sendSpooledResultsContinuous() {
+	sendInterval := secToDuration(fm.Config.SenderInterval)
+	if sendInterval <= 0 {
+		sendInterval = 250 * time.Millisecond
+	}
+
+	for {
+		select {
+		case <-fm.InterruptChan:
+			pending, _ := fm.spool.stats()
+			logrus.Infof("sendSpooledResultsContinuous interrupt caught, keeping %d results in the spool", pending)
+			return
+		case <-time.After(sendInterval):
+			fm.sendSpooledResults()
+		}
+	}
+}
+
+// sends batches of spooled results until the spool is empty or sending fails
+func (fm *Frontman) sendSpooledResults() {
+	for {
+		select {
+		case <-fm.InterruptChan:
+			return
+		default:
+		}
+
+		if err := fm.hubBackoff.paused(time.Now()); err != nil {
+			return
+		}
+
+		results, end, consumed, err := fm.spool.next(fm.Config.SenderBatchSize)
+		if err != nil {
+			logrus.Errorf("result spool: failed to read results: %s", err)
+			return
+		}
+		if consumed == 0 {
+			return
+		}
+
+		if len(results) > 0 {
+			b, contentType, err := fm.marshalResults(results)
+			if err != nil {
+				logrus.Errorf("result spool: %s", err)
+				return
+			}
+
+			err = fm.postToHub(b, contentType, len(results))
+			switch err.(type) {
+			case nil:
+				fm.statsLock.Lock()
+				fm.stats.CheckResultsSentToHub += uint64(len(results))
+				fm.statsLock.Unlock()
+			case ErrorHubUnavailable:
+				return
+			case ErrorHubResetContent:
+				logrus.Debugf("result spool cleared")
+				if err := fm.spool.discard(); err != nil {
+					logrus.Errorf("result spool: %s", err)
+				}
+				return
+			case ErrorHubGeneral:
+				logrus.Errorf("postToHub error: %s", err.Error())
+				if !fm.Config.DiscardOnHTTPResponseError {
+					return
+				}
+			default:
+				logrus.Errorf("postToHub error: %s", err.Error())
+				if !fm.Config.DiscardOnHTTPConnectError {
+					return
+				}
+			}
+		}
+
+		// committed right after the hub accepted the batch, it's only sent twice if frontman dies in between
+		if err := fm.spool.commit(end, consumed); err != nil {
+			logrus.Errorf("result spool: failed to commit sent results: %s", err)
+			return
+		}
+	}
+}
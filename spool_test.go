@@ -0,0 +1,185 @@
+package frontman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func helperSpoolResults(from, to int) []Result {
+	var results []Result
+	for i := from; i < to; i++ {
+		results = append(results, Result{CheckUUID: fmt.Sprintf("check-%d", i), Timestamp: time.Now().Unix()})
+	}
+	return results
+}
+
+func resultUUIDs(results []Result) []string {
+	res := []string{}
+	for _, r := range results {
+		res = append(res, r.CheckUUID)
+	}
+	return res
+}
+
+func TestResultSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openResultSpool(dir, 0, time.Hour)
+	require.Nil(t, err)
+	require.Nil(t, s.append(helperSpoolResults(0, 5)))
+
+	results, end, consumed, err := s.next(2)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"check-0", "check-1"}, resultUUIDs(results))
+	assert.Equal(t, 2, consumed)
+	require.Nil(t, s.commit(end, consumed))
+
+	// not committed results are sent again
+	results, _, _, err = s.next(2)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"check-2", "check-3"}, resultUUIDs(results))
+
+	// a crash while writing a result leaves an incomplete line behind
+	f, err := os.OpenFile(s.segmentPath(s.segments[len(s.segments)-1]), os.O_APPEND|os.O_WRONLY, 0600)
+	require.Nil(t, err)
+	_, err = f.WriteString(`{"checkUuid":"incompl`)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	require.Nil(t, s.close())
+
+	// after a restart the spool continues after the committed results
+	s, err = openResultSpool(dir, 0, time.Hour)
+	require.Nil(t, err)
+	pending, _ := s.stats()
+	assert.Equal(t, 3, pending)
+
+	require.Nil(t, s.append([]Result{
+		{CheckUUID: "expired", Timestamp: time.Now().Add(-2 * time.Hour).Unix()},
+		{CheckUUID: "check-5", Timestamp: time.Now().Unix()},
+	}))
+
+	results, end, consumed, err = s.next(10)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"check-2", "check-3", "check-4", "check-5"}, resultUUIDs(results))
+	assert.Equal(t, 5, consumed)
+	require.Nil(t, s.commit(end, consumed))
+
+	pending, _ = s.stats()
+	assert.Equal(t, 0, pending)
+	_, _, consumed, err = s.next(10)
+	require.Nil(t, err)
+	assert.Equal(t, 0, consumed)
+
+	// sent segments are removed
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, files, 2)
+	require.Nil(t, s.close())
+}
+
+func TestResultSpoolMaxBytes(t *testing.T) {
+	s, err := openResultSpool(t.TempDir(), 4096, 0)
+	require.Nil(t, err)
+	defer s.close()
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, s.append(helperSpoolResults(i, i+1)))
+	}
+
+	pending, size := s.stats()
+	assert.True(t, size <= 4096, "spool size %d", size)
+	assert.True(t, pending > 0 && pending < 100, "%d pending", pending)
+
+	// the newest results are kept
+	results, _, _, err := s.next(100)
+	require.Nil(t, err)
+	require.Len(t, results, pending)
+	assert.Equal(t, "check-99", results[len(results)-1].CheckUUID)
+}
+
+func TestSpoolResultsContinuous(t *testing.T) {
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.SenderBatchSize = 2
+	cfg.ResultSpool.Dir = t.TempDir()
+	fm := helperCreateFrontman(t, cfg)
+	require.NotNil(t, fm.spool)
+
+	// results handed to the HTTP sender are queued, nothing else is taken from resultsChan
+	fm.queueResults(helperSpoolResults(0, 5))
+	fm.resultsChan <- Result{CheckUUID: "unsent"}
+
+	fm.spoolQueuedResults(nil)
+	pending, _ := fm.spool.stats()
+	assert.Equal(t, 2, pending)
+
+	// the queue is written and the spool closed once interrupted
+	fm.startResultSpoolWriter()
+	close(fm.InterruptChan)
+	fm.TerminateQueue.Wait()
+	pending, _ = fm.spool.stats()
+	assert.Equal(t, 5, pending)
+	assert.Len(t, fm.resultsChan, 1)
+	assert.True(t, errors.Is(fm.spool.close(), os.ErrClosed))
+
+	results, _, _, err := fm.spool.next(100)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"check-0", "check-1", "check-2", "check-3", "check-4"}, resultUUIDs(results))
+}
+
+func TestSendSpooledResults(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	fail := true
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var results Results
+		if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, resultUUIDs(results.Results)...)
+	}))
+	defer hub.Close()
+
+	cfg, _ := HandleAllConfigSetup(DefaultCfgPath)
+	cfg.HubURL = hub.URL
+	cfg.HubGzip = false
+	cfg.SenderBatchSize = 2
+	cfg.HubRetry.InitialDelay = 0
+	cfg.ResultSpool.Dir = t.TempDir()
+	fm := helperCreateFrontman(t, cfg)
+	require.NotNil(t, fm.spool)
+
+	require.Nil(t, fm.spool.append(helperSpoolResults(0, 5)))
+
+	// the hub is down, results are kept
+	fm.sendSpooledResults()
+	pending, _ := fm.spool.stats()
+	assert.Equal(t, 5, pending)
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+
+	fm.sendSpooledResults()
+	pending, _ = fm.spool.stats()
+	assert.Equal(t, 0, pending)
+	assert.Equal(t, []string{"check-0", "check-1", "check-2", "check-3", "check-4"}, received)
+	require.Nil(t, fm.spool.close())
+}
@@ -19,20 +19,21 @@ func certName(cert *x509.Certificate) string {
 	return fmt.Sprintf("'%s' issued by %s", cert.Subject.CommonName, cert.Issuer.CommonName)
 }
 
-func (fm *Frontman) runSSLCheck(hostname string, port int, service string) (m MeasurementsMap, err error) {
+func (fm *Frontman) runSSLCheck(ctx context.Context, hostname string, port int, service string) (m MeasurementsMap, err error) {
 	service = strings.ToLower(service)
 
+	control := fm.policy.dialControl(hostname)
 	if net.ParseIP(hostname) != nil {
 		hostname = ""
 	}
 
 	if port == 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), timeoutPortLookup)
+		lookupCtx, cancel := context.WithTimeout(ctx, timeoutPortLookup)
 		defer cancel()
 
 		if p, exists := defaultPortByService[service]; exists {
 			port = p
-		} else if p, lerr := net.DefaultResolver.LookupPort(ctx, "tcp", service); p > 0 {
+		} else if p, lerr := net.DefaultResolver.LookupPort(lookupCtx, "tcp", service); p > 0 {
 			port = p
 		} else if lerr != nil {
 			err = fmt.Errorf("failed to auto-determine port for '%s': %s", service, lerr.Error())
@@ -47,13 +48,11 @@ func (fm *Frontman) runSSLCheck(hostname string, port int, service string) (m Me
 	}
 
 	addr := fmt.Sprintf("%s:%d", hostname, port)
-	dialer := net.Dialer{Timeout: secToDuration(fm.Config.NetTCPTimeout)}
-	connection, err := tls.DialWithDialer(
-		&dialer,
-		"tcp",
-		addr,
-		&tls.Config{ServerName: hostname},
-	)
+	dialer := tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: secToDuration(fm.Config.NetTCPTimeout), Control: control},
+		Config:    &tls.Config{ServerName: hostname},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		logrus.Debugf("serviceCheck: SSL check %s for '%s' failed: %s", addr, hostname, err.Error())
 		if strings.HasPrefix(err.Error(), "tls:") {
@@ -64,6 +63,7 @@ func (fm *Frontman) runSSLCheck(hostname string, port int, service string) (m Me
 		return
 	}
 
+	connection := conn.(*tls.Conn)
 	defer connection.Close()
 
 	remainingValidity, firstCertToExpire := findCertRemainingValidity(connection.ConnectionState().VerifiedChains)
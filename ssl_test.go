@@ -3,6 +3,7 @@
 package frontman
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -84,12 +85,12 @@ func TestFrontman_runSSLCheck(t *testing.T) {
 	fm := helperCreateFrontman(t, cfg)
 
 	for _, badSSLHost := range badSSL {
-		_, err := fm.runSSLCheck(badSSLHost, 443, "https")
+		_, err := fm.runSSLCheck(context.Background(), badSSLHost, 443, "https")
 		assert.Error(t, err, badSSLHost)
 	}
 
 	for _, goodSSLHost := range goodSSL {
-		_, err := fm.runSSLCheck(goodSSLHost, 443, "https")
+		_, err := fm.runSSLCheck(context.Background(), goodSSLHost, 443, "https")
 		assert.NoError(t, err, goodSSLHost)
 	}
 }
@@ -2,6 +2,7 @@ package frontman
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -14,28 +15,30 @@ import (
 )
 
 var defaultPortByService = map[string]int{
-	"dns":   53,
-	"ftp":   21,
-	"ftps":  990,
-	"http":  80,
-	"https": 443,
-	"iax2":  4569,
-	"imap":  143,
-	"imaps": 993,
-	"ldap":  389,
-	"ldaps": 636,
-	"nntp":  119,
-	"pop3":  110,
-	"pop3s": 995,
-	"smtp":  25,
-	"smtps": 465,
-	"ssh":   22,
-	"sip":   5060,
+	"dns":    53,
+	"ftp":    21,
+	"ftps":   990,
+	"http":   80,
+	"https":  443,
+	"iax2":   4569,
+	"imap":   143,
+	"imaps":  993,
+	"ldap":   389,
+	"ldaps":  636,
+	"nntp":   119,
+	"ntp":    123,
+	"pop3":   110,
+	"pop3s":  995,
+	"radius": 1812,
+	"smtp":   25,
+	"smtps":  465,
+	"ssh":    22,
+	"sip":    5060,
 }
 
 var errorFailedToVerifyService = errors.New("Failed to verify service")
 
-func (fm *Frontman) runTCPCheck(hostname string, port int, service string) (MeasurementsMap, error) {
+func (fm *Frontman) runTCPCheck(ctx context.Context, hostname string, port int, service string) (MeasurementsMap, error) {
 	service = strings.ToLower(service)
 
 	// Check if we have to autodetect port by service name
@@ -65,14 +68,16 @@ func (fm *Frontman) runTCPCheck(hostname string, port int, service string) (Meas
 	addr := fmt.Sprintf("%s:%d", hostname, port)
 
 	// Open connection to the specified addr
-	conn, err := net.DialTimeout("tcp", addr, secToDuration(fm.Config.NetTCPTimeout))
+	dialer := net.Dialer{Timeout: secToDuration(fm.Config.NetTCPTimeout), Control: fm.policy.dialControl(hostname)}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	m[prefix+"connectTime_s"] = time.Since(started).Seconds()
 	if err != nil {
 		return m, err
 	}
 	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
 
-	err = conn.SetDeadline(time.Now().Add(secToDuration(fm.Config.NetTCPTimeout)))
+	err = conn.SetDeadline(contextDeadline(ctx, secToDuration(fm.Config.NetTCPTimeout)))
 	if err != nil {
 		return m, fmt.Errorf("can't set tcp conn timeout: %s", err.Error())
 	}
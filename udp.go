@@ -2,19 +2,26 @@ package frontman
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 
 	"github.com/cloudradar-monitoring/frontman/pkg/iax"
+	"github.com/cloudradar-monitoring/frontman/pkg/ntp"
+	"github.com/cloudradar-monitoring/frontman/pkg/radius"
 	"github.com/cloudradar-monitoring/frontman/pkg/utils"
 )
 
-func (fm *Frontman) runUDPCheck(hostname string, port int, service string) (MeasurementsMap, error) {
+func (fm *Frontman) runUDPCheck(ctx context.Context, hostname string, port int, service string, data *ServiceCheckData) (MeasurementsMap, error) {
 	// Check if we have to autodetect port by service name
 	if port <= 0 {
 		// Lookup service by default port
@@ -41,23 +48,28 @@ func (fm *Frontman) runUDPCheck(hostname string, port int, service string) (Meas
 
 	checkTimeout := secToDuration(fm.Config.NetUDPTimeout)
 
-	addr := fmt.Sprintf("%s:%d", hostname, port)
+	addr := net.JoinHostPort(hostname, strconv.Itoa(port))
 
 	// Open connection to the specified addr
-	conn, err := net.DialTimeout("udp", addr, checkTimeout)
+	dialer := net.Dialer{Timeout: checkTimeout, Control: fm.policy.dialControl(hostname)}
+	conn, err := dialer.DialContext(ctx, "udp", addr)
 	m[prefix+"connectTime_s"] = time.Since(started).Seconds()
 	if err != nil {
 		return m, err
 	}
 	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
 
-	err = conn.SetDeadline(time.Now().Add(checkTimeout))
+	err = conn.SetDeadline(contextDeadline(ctx, checkTimeout))
 	if err != nil {
 		return m, fmt.Errorf("can't set UDP conn timeout: %s", err.Error())
 	}
 
 	// Execute the check
-	err = executeUDPServiceCheck(conn.(*net.UDPConn), checkTimeout, service, hostname)
+	serviceMeasurements, err := fm.executeUDPServiceCheck(conn.(*net.UDPConn), checkTimeout, service, hostname, data)
+	for key, val := range serviceMeasurements {
+		m[prefix+key] = val
+	}
 	if err != nil {
 		return m, fmt.Errorf("failed to verify '%s' service on %d port: %s", service, port, err.Error())
 	}
@@ -69,9 +81,15 @@ func (fm *Frontman) runUDPCheck(hostname string, port int, service string) (Meas
 }
 
 // executeUDPServiceCheck executes a check based on the passed protocol name on the given connection
-func executeUDPServiceCheck(conn *net.UDPConn, udpTimeout time.Duration, service, hostname string) error {
+// returns service specific measurements without the check prefix, if any
+func (fm *Frontman) executeUDPServiceCheck(conn *net.UDPConn, udpTimeout time.Duration, service, hostname string, data *ServiceCheckData) (MeasurementsMap, error) {
 	var err error
+	var m MeasurementsMap
 	switch service {
+	case "ntp":
+		m, err = checkNTP(conn, udpTimeout, secToDuration(fm.Config.NTPMaxOffset))
+	case "radius":
+		m, err = checkRADIUS(conn, udpTimeout, data, fm.Config.NodeName)
 	case "sip":
 		err = checkSIP(conn, hostname, udpTimeout)
 	case "iax2":
@@ -79,13 +97,210 @@ func executeUDPServiceCheck(conn *net.UDPConn, udpTimeout time.Duration, service
 	case "dns":
 		// minimal DNS test just verifies connection is established
 	case "udp":
-		// In the previous call to net.Dial the test basically already happened while establishing the connection
-		// so we don't have to do anything additional here.
+		m, err = checkUDPRequestResponse(conn, udpTimeout, data)
 	default:
 		err = fmt.Errorf("unknown service '%s'", service)
 	}
 
-	return err
+	return m, err
+}
+
+// errorUDPPortUnreachable is returned when the target answered with ICMP port unreachable
+var errorUDPPortUnreachable = errors.New("port unreachable: got ICMP destination unreachable response")
+
+// isUDPPortUnreachable returns true if err was caused by an ICMP port unreachable message.
+// The kernel reports them as "connection refused" on connected UDP sockets
+func isUDPPortUnreachable(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// decodeUDPPayload returns the raw bytes of a payload configured as text or hex string
+func decodeUDPPayload(payload, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return []byte(payload), nil
+	case "hex":
+		// allow common separators like "de ad be ef" or "de:ad:be:ef"
+		payload = strings.NewReplacer(" ", "", ":", "", "0x", "").Replace(payload)
+		return hex.DecodeString(payload)
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+// matchUDPResponse verifies the response against the expected regular expression or hex encoded prefix
+func matchUDPResponse(response []byte, expected, format string) error {
+	if expected == "" {
+		return nil
+	}
+
+	switch strings.ToLower(format) {
+	case "", "regex":
+		rexp, err := regexp.Compile(expected)
+		if err != nil {
+			return fmt.Errorf("invalid expectedResponse: %s", err.Error())
+		}
+		if !rexp.Match(response) {
+			return fmt.Errorf("invalid response: expected to match '%s' but got '%s'", expected, string(response))
+		}
+	case "hex":
+		prefix, err := decodeUDPPayload(expected, "hex")
+		if err != nil {
+			return fmt.Errorf("invalid expectedResponse: %s", err.Error())
+		}
+		if !bytes.HasPrefix(response, prefix) {
+			return fmt.Errorf("invalid response: expected to start with '% x' but got '% x'", prefix, response)
+		}
+	default:
+		return fmt.Errorf("unknown expectedResponseFormat '%s'", format)
+	}
+
+	return nil
+}
+
+// checkUDPRequestResponse sends the configured payload and verifies the response.
+// Without a payload an empty datagram is sent, the port counts as open unless it is refused with ICMP port unreachable
+func checkUDPRequestResponse(conn *net.UDPConn, timeout time.Duration, data *ServiceCheckData) (MeasurementsMap, error) {
+	payload, err := decodeUDPPayload(data.Payload, data.PayloadFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %s", err.Error())
+	}
+
+	sentAt := time.Now()
+	_ = conn.SetWriteDeadline(sentAt.Add(timeout))
+	_, err = conn.Write(payload)
+	if err != nil {
+		if isUDPPortUnreachable(err) {
+			return nil, errorUDPPortUnreachable
+		}
+		return nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var response = make([]byte, 65535)
+	n, err := conn.Read(response)
+	if err != nil {
+		if isUDPPortUnreachable(err) {
+			return nil, errorUDPPortUnreachable
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			if len(payload) == 0 && data.ExpectedResponse == "" {
+				// silence is all we can expect from most services after an empty datagram
+				return nil, nil
+			}
+			return nil, fmt.Errorf("no response received within %.1fs", timeout.Seconds())
+		}
+		return nil, err
+	}
+
+	m := MeasurementsMap{
+		"responseTime_s": time.Since(sentAt).Seconds(),
+		"bytesReceived":  n,
+	}
+
+	return m, matchUDPResponse(response[0:n], data.ExpectedResponse, data.ExpectedResponseFormat)
+}
+
+func checkRADIUS(conn *net.UDPConn, timeout time.Duration, data *ServiceCheckData, nasIdentifier string) (MeasurementsMap, error) {
+	expectedCode := byte(radius.CodeAccessAccept)
+	switch strings.ToLower(data.RadiusExpectedReply) {
+	case "", "accept":
+	case "reject":
+		expectedCode = radius.CodeAccessReject
+	default:
+		return nil, fmt.Errorf("unknown radiusExpectedReply '%s'", data.RadiusExpectedReply)
+	}
+
+	req, packet, err := radius.NewAccessRequest(data.RadiusSecret, data.RadiusUsername, data.RadiusPassword, nasIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	m := MeasurementsMap{}
+
+	sentAt := time.Now()
+	_ = conn.SetWriteDeadline(sentAt.Add(timeout))
+	_, err = conn.Write(packet)
+	if err != nil {
+		return m, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var b = make([]byte, 4096)
+	n, err := conn.Read(b)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			m["reply"] = "timeout"
+			return m, fmt.Errorf("no response received within %.1fs", timeout.Seconds())
+		}
+		if isUDPPortUnreachable(err) {
+			return m, errorUDPPortUnreachable
+		}
+		return m, err
+	}
+	m["responseTime_s"] = time.Since(sentAt).Seconds()
+
+	resp, err := req.ParseResponse(b[0:n])
+	if err != nil {
+		return m, err
+	}
+	m["reply"] = radius.CodeName(resp.Code)
+
+	if resp.Code != expectedCode {
+		err = fmt.Errorf("got %s, expected %s", radius.CodeName(resp.Code), radius.CodeName(expectedCode))
+		if resp.ReplyMessage != "" {
+			err = fmt.Errorf("%s: %s", err.Error(), resp.ReplyMessage)
+		}
+		return m, err
+	}
+
+	return m, nil
+}
+
+func checkNTP(conn *net.UDPConn, timeout time.Duration, maxOffset time.Duration) (MeasurementsMap, error) {
+	sentAt := time.Now()
+	_ = conn.SetWriteDeadline(sentAt.Add(timeout))
+	_, err := conn.Write(ntp.GetRequestPacket(sentAt))
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var b = make([]byte, 128)
+	n, err := conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ntp.ParseResponse(b[0:n], sentAt, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	m := MeasurementsMap{
+		"offset_s":         resp.Offset.Seconds(),
+		"roundTripDelay_s": resp.RTT.Seconds(),
+		"stratum":          int(resp.Stratum),
+		"referenceId":      resp.ReferenceID,
+		"leapIndicator":    int(resp.Leap),
+	}
+
+	if !resp.IsSynchronized() {
+		return m, fmt.Errorf("server is not synchronized (stratum %d, leap indicator %d)", resp.Stratum, resp.Leap)
+	}
+
+	offset := resp.Offset
+	if offset < 0 {
+		offset = -offset
+	}
+	if maxOffset > 0 && offset > maxOffset {
+		return m, fmt.Errorf("clock offset of %.3fs exceeds the threshold of %.3fs", resp.Offset.Seconds(), maxOffset.Seconds())
+	}
+
+	return m, nil
 }
 
 func checkSIP(conn *net.UDPConn, hostname string, timeout time.Duration) error {
@@ -0,0 +1,285 @@
+package frontman
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// helperUDPServer starts a local UDP server answering each request with the output of respond.
+// No answer is sent if respond returns nil
+func helperUDPServer(t *testing.T, respond func(req []byte) []byte) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := respond(buf[0:n]); resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// ntpReply builds a server reply to req with the server clock shifted by offset
+func ntpReply(req []byte, stratum byte, leap byte, offset time.Duration) []byte {
+	resp := make([]byte, 48)
+	resp[0] = leap<<6 | 4<<3 | 4
+	resp[1] = stratum
+	copy(resp[12:16], "GPS\x00")
+	copy(resp[24:32], req[40:48])
+
+	now := time.Now().Add(offset)
+	sec := uint64(now.Unix() + 2208988800)
+	frac := uint64(now.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint64(resp[32:], sec<<32|frac)
+	binary.BigEndian.PutUint64(resp[40:], sec<<32|frac)
+	return resp
+}
+
+func TestNTPUDPCheck(t *testing.T) {
+	cfg := NewConfig()
+	cfg.NetUDPTimeout = 1
+	fm := helperCreateFrontman(t, cfg)
+
+	t.Run("synchronized", func(t *testing.T) {
+		port := helperUDPServer(t, func(req []byte) []byte {
+			return ntpReply(req, 1, 0, 0)
+		})
+		prefix := "net.udp.ntp." + strconv.Itoa(port) + "."
+
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "ntp", &ServiceCheckData{})
+		require.Nil(t, err)
+		require.Equal(t, 1, m[prefix+"success"])
+		require.Equal(t, 1, m[prefix+"stratum"])
+		require.Equal(t, "GPS", m[prefix+"referenceId"])
+		require.Equal(t, 0, m[prefix+"leapIndicator"])
+		require.InDelta(t, 0, m[prefix+"offset_s"], 0.1)
+		require.Contains(t, m, prefix+"roundTripDelay_s")
+	})
+
+	t.Run("offset-exceeded", func(t *testing.T) {
+		port := helperUDPServer(t, func(req []byte) []byte {
+			return ntpReply(req, 2, 0, 5*time.Second)
+		})
+		prefix := "net.udp.ntp." + strconv.Itoa(port) + "."
+
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "ntp", &ServiceCheckData{})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "exceeds the threshold")
+		require.Equal(t, 0, m[prefix+"success"])
+		require.InDelta(t, 5, m[prefix+"offset_s"], 0.1)
+		require.Equal(t, "71.80.83.0", m[prefix+"referenceId"])
+	})
+
+	t.Run("unsynchronized", func(t *testing.T) {
+		port := helperUDPServer(t, func(req []byte) []byte {
+			return ntpReply(req, 16, 3, 0)
+		})
+		prefix := "net.udp.ntp." + strconv.Itoa(port) + "."
+
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "ntp", &ServiceCheckData{})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "not synchronized")
+		require.Equal(t, 0, m[prefix+"success"])
+		require.Equal(t, 16, m[prefix+"stratum"])
+	})
+}
+
+func TestGenericUDPCheck(t *testing.T) {
+	cfg := NewConfig()
+	cfg.NetUDPTimeout = 0.5
+	fm := helperCreateFrontman(t, cfg)
+
+	echoPort := helperUDPServer(t, func(req []byte) []byte {
+		return append([]byte("echo:"), req...)
+	})
+	prefix := "net.udp.udp." + strconv.Itoa(echoPort) + "."
+
+	t.Run("text-payload-regex", func(t *testing.T) {
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", echoPort, "udp", &ServiceCheckData{
+			Payload:          "hello",
+			ExpectedResponse: "^echo:h.llo$",
+		})
+		require.Nil(t, err)
+		require.Equal(t, 1, m[prefix+"success"])
+		require.Equal(t, 10, m[prefix+"bytesReceived"])
+		require.Contains(t, m, prefix+"responseTime_s")
+	})
+
+	t.Run("hex-payload-prefix", func(t *testing.T) {
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", echoPort, "udp", &ServiceCheckData{
+			Payload:                "de:ad be ef",
+			PayloadFormat:          "hex",
+			ExpectedResponse:       "6563686f3adead",
+			ExpectedResponseFormat: "hex",
+		})
+		require.Nil(t, err)
+		require.Equal(t, 1, m[prefix+"success"])
+	})
+
+	t.Run("response-mismatch", func(t *testing.T) {
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", echoPort, "udp", &ServiceCheckData{
+			Payload:          "hello",
+			ExpectedResponse: "^pong",
+		})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "expected to match")
+		require.Equal(t, 0, m[prefix+"success"])
+	})
+
+	t.Run("no-response", func(t *testing.T) {
+		port := helperUDPServer(t, func(req []byte) []byte {
+			return nil
+		})
+
+		_, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "udp", &ServiceCheckData{Payload: "hello"})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "no response received")
+	})
+
+	t.Run("no-payload", func(t *testing.T) {
+		port := helperUDPServer(t, func(req []byte) []byte {
+			return nil
+		})
+
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "udp", &ServiceCheckData{})
+		require.Nil(t, err)
+		require.Equal(t, 1, m["net.udp.udp."+strconv.Itoa(port)+".success"])
+	})
+
+	t.Run("port-unreachable", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.Nil(t, err)
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		_ = conn.Close()
+
+		_, err = fm.runUDPCheck(context.Background(), "127.0.0.1", port, "udp", &ServiceCheckData{Payload: "hello"})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), errorUDPPortUnreachable.Error())
+
+		_, err = fm.runUDPCheck(context.Background(), "127.0.0.1", port, "udp", &ServiceCheckData{})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), errorUDPPortUnreachable.Error())
+	})
+}
+
+// radiusReply answers an Access-Request with Access-Accept if the PAP password equals password
+func radiusReply(req []byte, secret, password string) []byte {
+	// decrypt the first 16 bytes of User-Password, enough for short test passwords
+	attrs := req[20:]
+	var decoded []byte
+	for len(attrs) >= 2 {
+		if attrs[0] == 2 {
+			hash := md5.Sum(append([]byte(secret), req[4:20]...))
+			for i := 0; i < 16; i++ {
+				decoded = append(decoded, attrs[2+i]^hash[i])
+			}
+		}
+		attrs = attrs[attrs[1]:]
+	}
+
+	code := byte(3)
+	if string(bytes.TrimRight(decoded, "\x00")) == password {
+		code = 2
+	}
+
+	resp := []byte{code, req[1], 0, 20}
+	resp = append(resp, req[4:20]...)
+	if code == 3 {
+		msg := "bad credentials"
+		resp = append(resp, 18, byte(len(msg)+2))
+		resp = append(resp, msg...)
+	}
+	binary.BigEndian.PutUint16(resp[2:], uint16(len(resp)))
+
+	hash := md5.Sum(append(append([]byte{}, resp...), secret...))
+	copy(resp[4:20], hash[:])
+	return resp
+}
+
+func TestRADIUSUDPCheck(t *testing.T) {
+	cfg := NewConfig()
+	cfg.NetUDPTimeout = 0.5
+	fm := helperCreateFrontman(t, cfg)
+
+	port := helperUDPServer(t, func(req []byte) []byte {
+		return radiusReply(req, "s3cret", "testing123")
+	})
+	prefix := "net.udp.radius." + strconv.Itoa(port) + "."
+
+	t.Run("accept", func(t *testing.T) {
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "radius", &ServiceCheckData{
+			RadiusSecret:   "s3cret",
+			RadiusUsername: "frontman",
+			RadiusPassword: "testing123",
+		})
+		require.Nil(t, err)
+		require.Equal(t, 1, m[prefix+"success"])
+		require.Equal(t, "Access-Accept", m[prefix+"reply"])
+		require.Contains(t, m, prefix+"responseTime_s")
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "radius", &ServiceCheckData{
+			RadiusSecret:   "s3cret",
+			RadiusUsername: "frontman",
+			RadiusPassword: "wrong",
+		})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "got Access-Reject, expected Access-Accept: bad credentials")
+		require.Equal(t, 0, m[prefix+"success"])
+		require.Equal(t, "Access-Reject", m[prefix+"reply"])
+	})
+
+	t.Run("expected-reject", func(t *testing.T) {
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "radius", &ServiceCheckData{
+			RadiusSecret:        "s3cret",
+			RadiusUsername:      "frontman",
+			RadiusPassword:      "wrong",
+			RadiusExpectedReply: "reject",
+		})
+		require.Nil(t, err)
+		require.Equal(t, 1, m[prefix+"success"])
+	})
+
+	t.Run("wrong-secret", func(t *testing.T) {
+		_, err := fm.runUDPCheck(context.Background(), "127.0.0.1", port, "radius", &ServiceCheckData{
+			RadiusSecret:   "other",
+			RadiusUsername: "frontman",
+			RadiusPassword: "testing123",
+		})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "wrong shared secret")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		silentPort := helperUDPServer(t, func(req []byte) []byte {
+			return nil
+		})
+
+		m, err := fm.runUDPCheck(context.Background(), "127.0.0.1", silentPort, "radius", &ServiceCheckData{
+			RadiusSecret:   "s3cret",
+			RadiusUsername: "frontman",
+			RadiusPassword: "testing123",
+		})
+		require.NotNil(t, err)
+		require.Equal(t, "timeout", m["net.udp.radius."+strconv.Itoa(silentPort)+".reply"])
+	})
+}
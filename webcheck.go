@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -55,20 +56,41 @@ loopDom:
 }
 
 func (fm *Frontman) newHTTPTransport(ignoreSSLErrors *bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   15 * time.Second,
+		KeepAlive: 0,
+		DualStack: true,
+	}
 	t := &http.Transport{
-		DisableKeepAlives: true,
-		Proxy:             http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   15 * time.Second,
-			KeepAlive: 0,
-			DualStack: true,
-		}).DialContext,
+		DisableKeepAlives:     true,
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
 		MaxIdleConns:          1,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       &tls.Config{},
 	}
 
+	if fm.policy != nil {
+		// the policy applies to the addresses of the targets, connections to a proxy are made on their behalf
+		var proxies sync.Map
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			u, err := http.ProxyFromEnvironment(req)
+			if u != nil {
+				proxies.Store(proxyAddr(u), true)
+			}
+			return u, err
+		}
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := *dialer
+			if _, ok := proxies.Load(addr); !ok {
+				host, _, _ := net.SplitHostPort(addr)
+				d.Control = fm.policy.dialControl(host)
+			}
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
 	valueProvided := ignoreSSLErrors != nil
 	if (valueProvided && *ignoreSSLErrors) ||
 		(!valueProvided && fm.Config.IgnoreSSLErrors) {
@@ -107,7 +129,7 @@ func (check WebCheck) uniqueID() string {
 	return check.UUID
 }
 
-func (check WebCheck) run(fm *Frontman) (*Result, error) {
+func (check WebCheck) run(ctx context.Context, fm *Frontman) (*Result, error) {
 
 	res := &Result{
 		Node:         fm.Config.NodeName,
@@ -148,7 +170,7 @@ func (check WebCheck) run(fm *Frontman) (*Result, error) {
 
 	check.Check.Method = strings.ToUpper(check.Check.Method)
 
-	ctx, cancel := context.WithTimeout(context.Background(), secToDuration(timeout))
+	ctx, cancel := context.WithTimeout(ctx, secToDuration(timeout))
 	defer cancel()
 
 	url, err := normalizeURLPort(check.Check.URL)
@@ -283,6 +305,15 @@ func (check WebCheck) run(fm *Frontman) (*Result, error) {
 	return res, nil
 }
 
+// proxyAddr returns the address http.Transport dials for a proxy
+func proxyAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080"}[u.Scheme]
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
 func (fm *Frontman) newClientWithOptions(transport *http.Transport, maxRedirects int) *http.Client {
 	client := &http.Client{Transport: transport}
 
@@ -295,6 +326,10 @@ func (fm *Frontman) newClientWithOptions(transport *http.Transport, maxRedirects
 			}
 		}
 
+		if err := fm.policy.allowURL(req.Context(), req.URL); err != nil {
+			return err
+		}
+
 		if maxRedirects <= 0 {
 			logrus.Println("redirects are not allowed")
 			return http.ErrUseLastResponse